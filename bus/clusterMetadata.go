@@ -1,124 +1,44 @@
 package bus
 
 import (
-	"bufio"
-	"fmt"
-	"io"
+	"errors"
 	"iris/config"
+	"iris/serializer/pb"
 	"log"
-	"net"
-	"strconv"
-	"strings"
 )
 
-func (b *Bus) HandleMetadata(conn net.Conn) {
-	reader := bufio.NewReader(conn)
-	err := b.HandleIncomingClusterMetadata(reader)
-	if err != nil {
-		log.Printf("Error handling incoming cluster metadata: %v", err)
-		conn.Write([]byte(fmt.Sprintf("ERR: Failed to process incoming metadata: %v\n", err)))
-	} else {
-		conn.Write([]byte("METADATA_RECEIVED_SUCCESS\n"))
-	}
-}
-
-// HandleIncomingClusterMetadata processes metadata received from another node.
+// HandleMetadata processes metadata received from another node.
 // This is typically used by a joining node to sync its view of the cluster.
-func (b *Bus) HandleIncomingClusterMetadata(reader *bufio.Reader) error {
+// CLUSTER_METADATA ClusterMetadata{ranges, nodes}
+func (b *Bus) HandleMetadata(req *pb.ClusterMetadata) error {
 	newMetadata := []*config.SlotRange{}
 	newNodeMap := map[string]*config.Node{}
 
 	log.Println("Starting to handle incoming cluster metadata...")
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				log.Println("Connection closed by peer during metadata sync.")
-				break
-			}
-			return fmt.Errorf("failed to read metadata line: %w", err)
-		}
-		line = strings.TrimSpace(line)
-
-		if line == "CLUSTER_METADATA_END" {
-			log.Println("Received CLUSTER_METADATA_END. Finishing metadata sync.")
-			break
-		}
-		if line == "CLUSTER_METADATA_BEGIN" {
-			log.Println("Received CLUSTER_METADATA_BEGIN.")
-			continue
-		}
-		if !strings.HasPrefix(line, "SLOT") {
-			log.Printf("Skipping unrecognized metadata line: %q", line)
-			continue
-		}
-
-		fmt.Printf("Receiver Metadata: %s\n", line)
-
-		// Expected format:
-		// SLOT <start> <end> <MASTERID@ADDR> <Node1ID@ADDR1>,<Node2ID@ADDR2>,...
-		parts := strings.Fields(line)
-		if len(parts) < 5 {
-			log.Printf("Skipping malformed SLOT line (not enough parts): %q", line)
+	for _, n := range req.Nodes {
+		if n.ServerId == "" {
+			log.Printf("Skipping node entry without ID: %v", n)
 			continue
 		}
+		node := config.NodeFromProto(n)
+		newNodeMap[node.ServerID] = &node
+	}
 
-		start, err := strconv.ParseUint(parts[1], 10, 16)
-		if err != nil {
-			return fmt.Errorf("invalid slot start %q: %w", parts[1], err)
-		}
-		end, err := strconv.ParseUint(parts[2], 10, 16)
-		if err != nil {
-			return fmt.Errorf("invalid slot end %q: %w", parts[2], err)
-		}
-
-		masterParts := strings.Split(parts[3], "@")
-		if len(masterParts) != 2 {
-			return fmt.Errorf("invalid master node format: %q", parts[3])
+	for _, r := range req.Ranges {
+		sr := config.SlotRangeFromProto(r)
+		if _, _, err := slotBounds(r.Start, r.End); err != nil {
+			return err
 		}
-		masterID, masterAddr := masterParts[0], masterParts[1]
-
 		// Ensure master node exists in node map
-		if _, ok := newNodeMap[masterID]; !ok {
-			newNodeMap[masterID] = &config.Node{
-				ServerID: masterID,
-				Addr:     masterAddr,
-			}
+		if _, ok := newNodeMap[sr.MasterID]; !ok {
+			return errors.New("range master " + sr.MasterID + " is not in the node list")
 		}
-
-		var slotNodes []string
-		nodeEntries := strings.Split(parts[4], ",")
-		for _, entry := range nodeEntries {
-			if entry == "" || entry == "NONE" {
-				continue
-			}
-			nodeParts := strings.Split(entry, "@")
-			if len(nodeParts) != 2 {
-				log.Printf("Skipping malformed node entry %q", entry)
-				continue
-			}
-			id, addr := nodeParts[0], nodeParts[1]
-
-			if _, ok := newNodeMap[id]; !ok {
-				newNodeMap[id] = &config.Node{
-					ServerID: id,
-					Addr:     addr,
-				}
-			}
-			slotNodes = append(slotNodes, id)
-		}
-
-		newMetadata = append(newMetadata, &config.SlotRange{
-			Start:    uint16(start),
-			End:      uint16(end),
-			MasterID: masterID,
-			Nodes:    slotNodes,
-		})
+		newMetadata = append(newMetadata, &sr)
 	}
 
 	// state mutation + locking happens inside config.Server
 	b.server.ApplyClusterMetadata(newMetadata, newNodeMap)
-
+	log.Println("Finished metadata sync.")
 	return nil
 }
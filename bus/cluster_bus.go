@@ -3,12 +3,15 @@ package bus
 import (
 	"bufio"
 	"io"
+	"iris/buspool"
 	"iris/config"
 	"iris/engine"
 	"iris/gossip"
+	"iris/serializer/pb"
 	"log"
 	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,14 +19,17 @@ type Bus struct {
 	server *config.Server
 	db     *engine.Engine
 	gossip *gossip.Gossip
+	routes map[pb.BusCommand]route
 }
 
 func NewBus(server *config.Server, db *engine.Engine, gossip *gossip.Gossip) *Bus {
-	return &Bus{
+	b := &Bus{
 		server: server,
 		db:     db,
 		gossip: gossip,
 	}
+	b.routes = b.buildRoutes()
+	return b
 }
 
 func (b *Bus) NewBusRoute() {
@@ -57,6 +63,8 @@ func (b *Bus) handleConnection(conn net.Conn) {
 	defer b.server.Wg.Done()
 	defer conn.Close()
 	reader := bufio.NewReader(conn)
+	var writeMu sync.Mutex // serializes the responses of multiplexed requests
+	slots := make(chan struct{}, BUS_MAX_CONN_REQUESTS)
 	for {
 		if b.server.ShuttingDown.Load() {
 			log.Println("[INFO] Bus connection closing due to b.server shutdown")
@@ -73,17 +81,23 @@ func (b *Bus) handleConnection(conn net.Conn) {
 
 		trimmedCmd := strings.TrimSpace(line)
 
-		// Special handling for SNAPSHOT: it has binary data following the text command
-		// We need to handle it before the buffered reader interferes
-		if strings.ToUpper(trimmedCmd) == "SNAPSHOT" {
-			// For SNAPSHOT, we need to use the raw connection without bufio interference
-			// Close the current connection and let the sender establish a new one for binary data
-			// Actually, SNAPSHOT data comes on the same connection right after this line
-			// We pass the reader to HandleClusterSnapshot so it can continue reading from the buffered stream
-			b.HandleClusterSnapshot(reader, conn)
+		// peers send framed protobuf requests through the connection pool
+		if strings.HasPrefix(trimmedCmd, "#") {
+			id, length, err := buspool.ParseFrameHeader(trimmedCmd)
+			if err != nil {
+				log.Printf("[WARN]: invalid bus frame %q: %v\n", trimmedCmd, err)
+				break
+			}
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				log.Printf("[WARN]: failed to read bus frame #%d: %v\n", id, err)
+				break
+			}
+			b.handleFramedRequest(id, payload, conn, &writeMu, slots)
 			continue
 		}
 
-		b.HandleClusterCommand(trimmedCmd, conn)
+		// plain text lines are operator commands
+		b.HandleAdminCommand(trimmedCmd, conn)
 	}
 }
@@ -1,92 +1,234 @@
 package bus
 
 import (
+	"errors"
+	"fmt"
+	"iris/serializer/pb"
+	"log"
 	"net"
-	"strings"
-)
-
-func (b *Bus) HandleClusterCommand(cmd string, conn net.Conn) {
-	// log.Printf("HandleClusterCommand received: %s", cmd)
-	parts := strings.Fields(cmd)
-	if len(parts) == 0 {
-		conn.Write([]byte("ERR empty command\n"))
-		return
-	}
-
-	// log.Printf("Routing command: %s", strings.ToUpper(parts[0]))
-
-	switch strings.ToUpper(parts[0]) {
-	case "JOIN":
-		{
-			b.HandleJoin(conn, parts)
-			b.db.SaveServerMetadata(b.server)
-		}
 
-	case "PREPARE":
-		{
-			HandlePrepare(conn, parts, b.server)
-			b.db.SaveServerMetadata(b.server)
-		}
-	case "REP":
-		{
-			b.HandleReplication(conn, parts)
-		}
+	"google.golang.org/protobuf/proto"
+)
 
-	case "COMMIT":
-		{
-			b.HandleCommit(conn, parts)
-			b.db.SaveServerMetadata(b.server)
-		}
+// route binds a bus command to the message it carries and the handler that serves it.
+type route struct {
+	newRequest func() proto.Message
+	handle     func(peer net.Addr, req proto.Message) (proto.Message, error)
+	// the cluster metadata is persisted after the handler ran
+	saveMetadata bool
+}
 
-	case "SHOW":
-		{
-			b.HandleShow(conn)
-		}
+// buildRoutes returns the dispatch table of the bus, one entry per BusCommand.
+func (b *Bus) buildRoutes() map[pb.BusCommand]route {
+	return map[pb.BusCommand]route{
+		pb.BusCommand_BUS_PING: {
+			newRequest: func() proto.Message { return &pb.Empty{} },
+			handle: func(_ net.Addr, _ proto.Message) (proto.Message, error) {
+				return nil, nil
+			},
+		},
+		pb.BusCommand_HELLO: {
+			newRequest: func() proto.Message { return &pb.Hello{} },
+			handle: func(peer net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleHello(peer, req.(*pb.Hello))
+			},
+		},
+		pb.BusCommand_JOIN: {
+			newRequest: func() proto.Message { return &pb.JoinRequest{} },
+			handle: func(peer net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleJoin(peer, req.(*pb.JoinRequest))
+			},
+			saveMetadata: true,
+		},
+		pb.BusCommand_PREPARE: {
+			newRequest: func() proto.Message { return &pb.PrepareRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, HandlePrepare(req.(*pb.PrepareRequest), b.server)
+			},
+			saveMetadata: true,
+		},
+		pb.BusCommand_COMMIT: {
+			newRequest: func() proto.Message { return &pb.CommitRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleCommit(req.(*pb.CommitRequest))
+			},
+			saveMetadata: true,
+		},
+		pb.BusCommand_SNAPSHOT: {
+			newRequest: func() proto.Message { return &pb.ClusterSnapshot{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleClusterSnapshot(req.(*pb.ClusterSnapshot))
+			},
+		},
+		pb.BusCommand_REQ_METADATA: {
+			newRequest: func() proto.Message { return &pb.Empty{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleReqMetadata(req.(*pb.Empty))
+			},
+		},
+		pb.BusCommand_CLUSTER_METADATA: {
+			newRequest: func() proto.Message { return &pb.ClusterMetadata{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleMetadata(req.(*pb.ClusterMetadata))
+			},
+		},
+		pb.BusCommand_CMU: {
+			newRequest: func() proto.Message { return &pb.MetadataUpdate{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleClusterMetdataUpdate(req.(*pb.MetadataUpdate))
+			},
+			saveMetadata: true,
+		},
+		pb.BusCommand_LEAVE: {
+			newRequest: func() proto.Message { return &pb.LeaveRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleLeave(req.(*pb.LeaveRequest))
+			},
+			saveMetadata: true,
+		},
+		pb.BusCommand_HEARTBEAT: {
+			newRequest: func() proto.Message { return &pb.HeartbeatRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleHeartbeat(req.(*pb.HeartbeatRequest))
+			},
+		},
+		pb.BusCommand_REQ_VOTE: {
+			newRequest: func() proto.Message { return &pb.VoteRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleReqVote(req.(*pb.VoteRequest))
+			},
+		},
+		pb.BusCommand_SUSPECT_LEADER: {
+			newRequest: func() proto.Message { return &pb.SuspectLeaderRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleSuspectLeader(req.(*pb.SuspectLeaderRequest))
+			},
+		},
+		pb.BusCommand_INS: {
+			newRequest: func() proto.Message { return &pb.InsertRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleINS(req.(*pb.InsertRequest))
+			},
+		},
+		pb.BusCommand_REP: {
+			newRequest: func() proto.Message { return &pb.ReplicateRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleReplication(req.(*pb.ReplicateRequest))
+			},
+		},
+		pb.BusCommand_REP_BATCH: {
+			newRequest: func() proto.Message { return &pb.ReplicateBatch{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleReplicateBatch(req.(*pb.ReplicateBatch))
+			},
+		},
+		pb.BusCommand_SST_CHUNK: {
+			newRequest: func() proto.Message { return &pb.SstChunk{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleSSTChunk(req.(*pb.SstChunk))
+			},
+		},
+		pb.BusCommand_SST_INGEST: {
+			newRequest: func() proto.Message { return &pb.SstIngest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleSSTIngest(req.(*pb.SstIngest))
+			},
+		},
+		pb.BusCommand_REPL_OFFSET: {
+			newRequest: func() proto.Message { return &pb.ReplicationOffset{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleReplicationOffset(req.(*pb.ReplicationOffset))
+			},
+		},
+		pb.BusCommand_RGET: {
+			newRequest: func() proto.Message { return &pb.RemoteGetRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleRemoteGet(req.(*pb.RemoteGetRequest))
+			},
+		},
+		pb.BusCommand_GOSSIP: {
+			newRequest: func() proto.Message { return &pb.GossipMessage{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleGossip(req.(*pb.GossipMessage))
+			},
+		},
+		pb.BusCommand_PING: {
+			newRequest: func() proto.Message { return &pb.PingRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandlePing(req.(*pb.PingRequest))
+			},
+		},
+		pb.BusCommand_PING_REQ: {
+			newRequest: func() proto.Message { return &pb.PingReqRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandlePingReq(req.(*pb.PingReqRequest))
+			},
+		},
+		pb.BusCommand_NODE_DEAD: {
+			newRequest: func() proto.Message { return &pb.NodeDeadRequest{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return nil, b.HandleNodeDead(req.(*pb.NodeDeadRequest))
+			},
+		},
+		pb.BusCommand_SHOW: {
+			newRequest: func() proto.Message { return &pb.Empty{} },
+			handle: func(_ net.Addr, req proto.Message) (proto.Message, error) {
+				return b.HandleShow(req.(*pb.Empty))
+			},
+		},
+	}
+}
 
-	case "CLUSTER_METADATA_BEGIN":
-		{
-			b.HandleMetadata(conn)
-		}
+// HandleClusterCommand decodes a BusRequest, runs the handler registered for its
+// command and wraps the result into the BusResponse sent back to the peer.
+func (b *Bus) HandleClusterCommand(peer net.Addr, payload []byte) *pb.BusResponse {
+	reply, err := b.dispatch(peer, payload)
+	if err != nil {
+		return &pb.BusResponse{Error: err.Error()}
+	}
+	if reply == nil {
+		return &pb.BusResponse{}
+	}
+	body, err := proto.Marshal(reply)
+	if err != nil {
+		return &pb.BusResponse{Error: fmt.Sprintf("failed to encode reply: %v", err)}
+	}
+	return &pb.BusResponse{Body: body}
+}
 
-	case "INS":
-		{
-			b.HandleINS(conn, parts)
-		}
+func (b *Bus) dispatch(peer net.Addr, payload []byte) (proto.Message, error) {
+	envelope := &pb.BusRequest{}
+	if err := proto.Unmarshal(payload, envelope); err != nil {
+		return nil, fmt.Errorf("invalid bus request: %w", err)
+	}
 
-	case "CMU":
-		{
-			b.HandleClusterMetdataUpdate(conn, parts)
-			b.db.SaveServerMetadata(b.server)
-		}
-	case "LEAVE":
-		{
-			b.HandleLeave(conn, parts)
-			b.db.SaveServerMetadata(b.server)
-		}
+	r, ok := b.routes[envelope.Command]
+	if !ok {
+		return nil, errors.New("unknown command " + envelope.Command.String())
+	}
 
-	case "HEARTBEAT":
-		{
-			b.HandleHeartbeat(conn, parts)
-		}
+	req := r.newRequest()
+	if err := proto.Unmarshal(envelope.Body, req); err != nil {
+		return nil, fmt.Errorf("invalid %s request: %w", envelope.Command, err)
+	}
 
-	case "SUSPECT_LEADER":
-		{
-			b.HandleSuspectLeader(conn, parts)
-		}
+	reply, err := r.handle(peer, req)
+	if err != nil {
+		log.Printf("[WARN]: %s from %s failed: %v\n", envelope.Command, peer, err)
+	}
+	if r.saveMetadata {
+		b.db.SaveServerMetadata(b.server)
+	}
+	return reply, err
+}
 
-	case "REQ_METADATA":
-		{
-			b.HandleReqMetadata(conn, parts)
-		}
-	case "REQ_VOTE":
-		{
-			b.HandleReqVote(conn, parts)
-		}
-	case "GOSSIP":
-		{
-			b.HandleGossip(conn, parts)
-		}
-	default:
-		conn.Write([]byte("ERR unknown command\n"))
+// slotBounds validates a slot range received from a peer.
+func slotBounds(start, end uint32) (uint16, uint16, error) {
+	if start > 65535 {
+		return 0, 0, errors.New("invalid START value")
+	}
+	if end > 65535 {
+		return 0, 0, errors.New("invalid END value")
 	}
+	return uint16(start), uint16(end), nil
 }
@@ -3,12 +3,17 @@ package bus
 import (
 	"fmt"
 	"iris/config"
-	"log"
-	"net"
+	"iris/serializer/pb"
 	"strings"
+	"time"
 )
 
-func(b *Bus) HandleShow(conn net.Conn) {
+func (b *Bus) HandleShow(_ *pb.Empty) (*pb.ShowResponse, error) {
+	return &pb.ShowResponse{Text: b.showText()}, nil
+}
+
+// showText renders the view of the cluster from this node for SHOW.
+func (b *Bus) showText() string {
 	serverID, host, addr, busPort, version, totalNodes, totalSlots :=
 		b.server.GetBasicInfo()
 	nodes := b.server.GetNodesSnapshot()
@@ -39,12 +44,31 @@ func(b *Bus) HandleShow(conn net.Conn) {
 		version, totalNodes, totalSlots,
 	))
 
+	response.WriteString(fmt.Sprintf(
+		"Bus Protocol: v%d | Cluster Minimum: v%d | Cluster Capabilities: %s\n",
+		config.BUS_PROTOCOL_VERSION, b.server.ClusterProtocolVersion(), strings.Join(b.server.ClusterCapabilities(), ","),
+	))
+
+	partitionMode := "NO"
+	if b.server.InMinorityPartition() {
+		partitionMode = fmt.Sprintf("YES (policy: %s)", b.server.GetPartitionPolicy())
+	}
+	response.WriteString(fmt.Sprintf("Minority Partition: %s\n", partitionMode))
+
+	response.WriteString("--- Groups ---\n")
+	for _, g := range b.server.GetGroupStatuses() {
+		response.WriteString(fmt.Sprintf(
+			"  Group: %s | Status: %s | Nodes: %s\n",
+			g.Name, g.Status, strings.Join(g.Nodes, ","),
+		))
+	}
+
 	// List all nodes in the cluster (with ResourceScore)
 	response.WriteString("--- Nodes in Cluster ---\n")
 	for _, node := range nodes {
 		response.WriteString(fmt.Sprintf(
-			"  ServerID: %s | Addr: %s | ResourceScore: %.6f\n",
-			node.ServerID, node.Addr, node.ResourceScore,
+			"  ServerID: %s | Addr: %s | Status: %s | ResourceScore: %.6f | Protocol: %s\n",
+			node.ServerID, node.Addr, node.Status, node.ResourceScore, protocolLabel(b.server.GetPeerProtocol(node.ServerID)),
 		))
 	}
 
@@ -79,14 +103,54 @@ func(b *Bus) HandleShow(conn net.Conn) {
 			}
 
 			response.WriteString(fmt.Sprintf(
-				"  [%d] Start:%d | End:%d | MasterID: %s | Nodes: %s\n",
-				i, sr.Start, sr.End, sr.MasterID, nodesStr,
+				"  [%d] Start:%d | End:%d | MasterID: %s | Nodes: %s | AsyncCrossGroup: %t\n",
+				i, sr.Start, sr.End, sr.MasterID, nodesStr, sr.AsyncCrossGroup,
 			))
 		}
 	}
 
+	// Batched streams to the synchronous replicas of the ranges mastered here
+	if b.db.Stream != nil {
+		if streams := b.db.Stream.Streams(); len(streams) > 0 {
+			response.WriteString("--- Replication Streams ---\n")
+			for _, st := range streams {
+				response.WriteString(fmt.Sprintf(
+					"  Replica: %s | Queued: %d | Acked: %d | InFlight: %d | Retrying: %d | Resyncing: %t\n",
+					st.NodeID, st.LastSeq, st.AckedSeq, st.InFlight, st.Retrying, st.Resyncing,
+				))
+			}
+		}
+	}
+
+	// Async cross-group replication lag (only ranges mastered here have streams)
+	if b.db.Async != nil {
+		if lags := b.db.Async.Lag(); len(lags) > 0 {
+			response.WriteString("--- Async Replication Lag ---\n")
+			for _, l := range lags {
+				response.WriteString(fmt.Sprintf(
+					"  Group: %s | Replicas: %d | Pending: %d | Lag: %s | Dropped: %d | Resyncing: %d\n",
+					l.Group, l.Replicas, l.Pending, l.Lag.Truncate(time.Millisecond), l.Dropped, l.Resyncing,
+				))
+			}
+		}
+		if offsets := b.db.Async.AppliedOffsets(); len(offsets) > 0 {
+			response.WriteString("--- Async Replica Offsets ---\n")
+			for _, o := range offsets {
+				response.WriteString(fmt.Sprintf(
+					"  Master: %s | Offset: %d | Staleness: %s | Dropped: %d\n",
+					o.MasterID, o.Seq, o.Staleness.Truncate(time.Millisecond), o.Dropped,
+				))
+			}
+		}
+	}
+
 	response.WriteString("---------------\n")
-	if _, err := conn.Write([]byte(response.String())); err != nil {
-		log.Printf("Error writing response: %v", err)
+	return response.String()
+}
+
+func protocolLabel(version uint32) string {
+	if version == 0 {
+		return "unknown"
 	}
+	return fmt.Sprintf("v%d", version)
 }
@@ -0,0 +1,177 @@
+package bus
+
+import (
+	"fmt"
+	"iris/engine"
+	"iris/serializer/pb"
+	"iris/utils"
+	"net"
+	"strings"
+	"time"
+)
+
+// HandleAdminCommand serves the plain text commands an operator can type on the bus port.
+// SHOW
+// CMU ASYNC ON|OFF START END : async replication to the replicas outside the master's group
+// GC [RUN] : report of the local data in ranges this node no longer holds, RUN deletes what is past the grace period
+// COMPACT [START END] : compaction of the slots START-END, of the whole keyspace without a range
+// METRICS : LSM shape, amplification and disk usage of the storage backend, value checksum and compression counters
+// FLUSH : memtables to L0
+// ENCRYPTION [ROTATE] : keys and sealing state of the stored values, ROTATE reads the key file again and seals the values with its last key
+func (b *Bus) HandleAdminCommand(cmd string, conn net.Conn) {
+	parts := strings.Fields(cmd)
+	if len(parts) == 0 {
+		conn.Write([]byte("ERR empty command\n"))
+		return
+	}
+
+	switch strings.ToUpper(parts[0]) {
+	case "SHOW":
+		{
+			conn.Write([]byte(b.showText()))
+		}
+	case "CMU":
+		{
+			if len(parts) != 5 || strings.ToUpper(parts[1]) != "ASYNC" {
+				conn.Write([]byte("ERR: invalid format, CMU ASYNC ON|OFF START END\n"))
+				return
+			}
+			mode := strings.ToUpper(parts[2])
+			if mode != "ON" && mode != "OFF" {
+				conn.Write([]byte("ERR: invalid mode, expected ON or OFF\n"))
+				return
+			}
+			start, err := utils.ParseUint16(parts[3])
+			if err != nil {
+				conn.Write([]byte("ERR: invalid START value\n"))
+				return
+			}
+			end, err := utils.ParseUint16(parts[4])
+			if err != nil {
+				conn.Write([]byte("ERR: invalid END value\n"))
+				return
+			}
+
+			req := &pb.MetadataUpdate{
+				Op:      pb.MetadataUpdateOp_ASYNC_REPLICATION,
+				Start:   uint32(start),
+				End:     uint32(end),
+				Enabled: mode == "ON",
+			}
+			err = b.HandleClusterMetdataUpdate(req)
+			b.db.SaveServerMetadata(b.server)
+			if err != nil {
+				conn.Write([]byte(fmt.Sprintf("ERR: %s\n", err.Error())))
+				return
+			}
+			conn.Write([]byte("CMU ACK\n"))
+		}
+	case "GC":
+		{
+			if b.db.GC == nil {
+				conn.Write([]byte("ERR range GC is not running\n"))
+				return
+			}
+			run := len(parts) == 2 && strings.ToUpper(parts[1]) == "RUN"
+			if len(parts) > 2 || (len(parts) == 2 && !run) {
+				conn.Write([]byte("ERR: invalid format, GC [RUN]\n"))
+				return
+			}
+
+			var spans []engine.GCSpan
+			var err error
+			if run {
+				spans, err = b.db.GC.Collect()
+			} else {
+				spans, err = b.db.GC.Plan()
+			}
+			if err != nil {
+				conn.Write([]byte(fmt.Sprintf("ERR: %s\n", err.Error())))
+				return
+			}
+			conn.Write([]byte(b.gcReport(spans, run)))
+		}
+	case "COMPACT":
+		{
+			var err error
+			switch len(parts) {
+			case 1:
+				err = b.db.CompactAll()
+			case 3:
+				start, startErr := utils.ParseUint16(parts[1])
+				end, endErr := utils.ParseUint16(parts[2])
+				if startErr != nil || endErr != nil || start >= engine.STORAGE_SLOTS || end >= engine.STORAGE_SLOTS {
+					conn.Write([]byte("ERR: invalid slot range\n"))
+					return
+				}
+				err = b.db.CompactSlots(start, end)
+			default:
+				conn.Write([]byte("ERR: invalid format, COMPACT [START END]\n"))
+				return
+			}
+			if err != nil {
+				conn.Write([]byte(fmt.Sprintf("ERR: compaction failed: %s\n", err.Error())))
+				return
+			}
+			conn.Write([]byte("OK\n"))
+		}
+	case "METRICS":
+		{
+			conn.Write([]byte(b.db.ChecksumReport() + b.db.CompressionReport() + b.db.StorageMetrics()))
+		}
+	case "FLUSH":
+		{
+			if err := b.db.Flush(); err != nil {
+				conn.Write([]byte(fmt.Sprintf("ERR: flush failed: %s\n", err.Error())))
+				return
+			}
+			conn.Write([]byte("OK\n"))
+		}
+	case "ENCRYPTION":
+		{
+			rotate := len(parts) == 2 && strings.ToUpper(parts[1]) == "ROTATE"
+			if len(parts) > 2 || (len(parts) == 2 && !rotate) {
+				conn.Write([]byte("ERR: invalid format, ENCRYPTION [ROTATE]\n"))
+				return
+			}
+			if rotate {
+				if err := b.db.RotateEncryption(); err != nil {
+					conn.Write([]byte(fmt.Sprintf("ERR: rotation failed: %s\n", err.Error())))
+					return
+				}
+			}
+			conn.Write([]byte(b.db.EncryptionReport()))
+		}
+	default:
+		conn.Write([]byte("ERR unknown command, peers use framed protobuf requests\n"))
+	}
+}
+
+// gcReport renders the unowned spans for GC, deleted tells whether the eligible ones were removed.
+func (b *Bus) gcReport(spans []engine.GCSpan, deleted bool) string {
+	gc := b.db.GC
+	action := "would delete"
+	switch {
+	case gc.DryRun:
+		action = "would delete (dry-run mode)"
+	case deleted:
+		action = "deleted"
+	}
+
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("Grace Period: %s | Dry Run: %t | Slots Collected: %d\n", gc.GracePeriod, gc.DryRun, gc.Collected()))
+	if len(spans) == 0 {
+		report.WriteString("  No data outside the owned ranges\n")
+	}
+	for _, sp := range spans {
+		status := fmt.Sprintf("in grace period for %s", (gc.GracePeriod - time.Since(sp.UnownedSince)).Truncate(time.Second))
+		if sp.Eligible {
+			status = action
+		}
+		report.WriteString(fmt.Sprintf(
+			"  Start:%d | End:%d | Keys: %d | Bytes: ~%d | Unowned Since: %s | %s\n",
+			sp.Start, sp.End, sp.Keys, sp.Bytes, sp.UnownedSince.Format(time.RFC3339), status,
+		))
+	}
+	return report.String()
+}
@@ -1,36 +1,32 @@
 package bus
 
 import (
+	"errors"
 	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
-	"net"
-	"strings"
 	"time"
 )
 
 // HandleCommit is the bus handler for a remote COMMIT request.
-// It only parses args, calls into config.Server, and writes a response.
-func (b *Bus) HandleCommit(conn net.Conn, parts []string) {
-	if len(parts) != 2 {
-		_, _ = conn.Write([]byte("ERR: Not Enough Arguments\n"))
-		return
+// It only checks the request and calls into config.Server.
+func (b *Bus) HandleCommit(req *pb.CommitRequest) error {
+	if req.MessageId == "" {
+		return errors.New("not enough arguments")
 	}
 
-	messageID := parts[1]
-
-	if err := b.server.ApplyCommitByID(messageID); err != nil {
-		log.Printf("COMMIT failed for message ID %s: %v", messageID, err)
-		_, _ = conn.Write([]byte(fmt.Sprintf("ERR: COMMIT failed: %v\n", err)))
-		return
+	if err := b.server.ApplyCommitByID(req.MessageId); err != nil {
+		log.Printf("COMMIT failed for message ID %s: %v", req.MessageId, err)
+		return fmt.Errorf("COMMIT failed: %v", err)
 	}
-
-	_, _ = conn.Write([]byte("COMMIT SUCCESS\n"))
+	return nil
 }
 
 // / sends a COMMIT message to all other nodes in the cluster.
 func (b *Bus) commit(mid string) (bool, error) {
-	msg := fmt.Sprintf("COMMIT %s\n", mid)
+	req := &pb.CommitRequest{MessageId: mid}
 
 	// Snapshot peers from config package
 	peers := b.server.GetCommitPeers()
@@ -44,28 +40,8 @@ func (b *Bus) commit(mid string) (bool, error) {
 		}
 
 		log.Printf("Sending COMMIT %s to %s via bus port %s", mid, peer.ServerID, busport)
-		conn, err := net.DialTimeout("tcp", busport, 10*time.Second)
-		if err != nil {
-			return false, fmt.Errorf("failed to connect to peer(ID:%s) %s: %w", peer.ServerID, busport, err)
-		}
-
-		_ = conn.SetDeadline(time.Now().Add(15 * time.Second))
-
-		if _, err = conn.Write([]byte(msg)); err != nil {
-			conn.Close()
-			return false, fmt.Errorf("failed to write to peer(ID:%s) %s: %w", peer.ServerID, busport, err)
-		}
-
-		response := make([]byte, 1024)
-		n, err := conn.Read(response)
-		conn.Close()
-		if err != nil {
-			return false, fmt.Errorf("failed to read from peer(ID:%s) %s: %w", peer.ServerID, busport, err)
-		}
-
-		respStr := strings.TrimSpace(string(response[:n]))
-		if respStr != "COMMIT SUCCESS" {
-			return false, fmt.Errorf("unexpected response from peer(ID:%s) %s: %s", peer.ServerID, busport, respStr)
+		if err := buspool.Call(busport, pb.BusCommand_COMMIT, req, nil, 15*time.Second); err != nil {
+			return false, fmt.Errorf("COMMIT to peer(ID:%s) %s failed: %w", peer.ServerID, busport, err)
 		}
 		log.Printf("Received successful COMMIT response from %s for %s.", peer.ServerID, mid)
 	}
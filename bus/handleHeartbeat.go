@@ -1,43 +1,29 @@
 package bus
 
 import (
-	"log"
-	"net"
-	"strconv"
-	"strings"
+	"errors"
+	"iris/serializer/pb"
 )
 
 // HandleHeartbeat processes heartbeat messages from other cluster nodes.
-// expected command format is:
-// HEARTBEAT SID:<server_id> UNREACHABLE:<comma_separated_sids_or_empty> GROUP:<group> VERSION:<cluster_version>
-func (b *Bus) HandleHeartbeat(conn net.Conn, cmd []string) {
-	if len(cmd) < 5 {
-		conn.Write([]byte("Expected Format : HEARTBEAT SID:<server_id> UNREACHABLE:<comma_separated_sids_or_empty> GROUP:<group> VERSION:<cluster_version>\n"))
-		log.Printf("[WARNING] 💖💖 %s \n", cmd)
-		return
+// HEARTBEAT HeartbeatRequest{server_id, unreachable, group, cluster_version}
+func (b *Bus) HandleHeartbeat(req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	if req.ServerId == "" {
+		return nil, errors.New("expected format: HEARTBEAT <server_id> <unreachable> <group> <cluster_version>")
 	}
 
-	serverid := cmd[1]
-	unreachable := cmd[2]
-	group := cmd[3]
-	peer_version, _ := strconv.Atoi(cmd[4]) // don't forget to handle errr here
+	// record the heartbeat before the version check, a follower with stale
+	// metadata is still alive and must not be picked up by the failure detector
+	ok := b.server.UpdateHeartbeat(req.ServerId, req.Unreachable, req.Group)
 
-	if uint64(peer_version) != b.server.GetClusterVersion() {
-		conn.Write([]byte("VERSION_MISMATCH\n"))
-		return
-	}
-
-	ok := true
-	if unreachable != "NONE" {
-		unreachableNodes := strings.Split(unreachable, ",")
-		ok = b.server.UpdateHeartbeat(serverid, unreachableNodes, group)
+	if req.ClusterVersion != b.server.GetClusterVersion() {
+		return &pb.HeartbeatResponse{Status: pb.HeartbeatStatus_HEARTBEAT_VERSION_MISMATCH}, nil
 	}
 
 	if ok {
-		conn.Write([]byte("OK\n"))
-	} else {
-		conn.Write([]byte("ERROR\n"))
+		return &pb.HeartbeatResponse{Status: pb.HeartbeatStatus_HEARTBEAT_OK}, nil
 	}
+	return &pb.HeartbeatResponse{Status: pb.HeartbeatStatus_HEARTBEAT_ERROR}, nil
 
 	// Discarded Idea's
 	// // send the lastseen of servers to the peer as response, this will help the peer to know which servers are alive in the cluster
@@ -46,5 +32,4 @@ func (b *Bus) HandleHeartbeat(conn net.Conn, cmd []string) {
 	// lastSeenInfo := strings.Builder{}
 
 	// fmt.Fprintf(&lastSeenInfo, "OK LASTSEEN ")
-
 }
@@ -0,0 +1,16 @@
+package bus
+
+import (
+	"iris/serializer/pb"
+	"log"
+	"net"
+)
+
+// HELLO Hello{server_id, protocol_version, capabilities}
+// RESPONSE: the Hello of this node, the caller decides if it can talk to us
+func (b *Bus) HandleHello(peer net.Addr, req *pb.Hello) (*pb.Hello, error) {
+	if err := b.server.RecordHello(peer.String(), req); err != nil {
+		log.Printf("[WARN]: HELLO from %s: %v\n", peer, err)
+	}
+	return b.server.Hello(), nil
+}
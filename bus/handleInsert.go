@@ -1,67 +1,59 @@
 package bus
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"iris/engine"
+	"iris/serializer/pb"
 	"iris/utils"
-	"net"
-	"strings"
-
-	"github.com/cockroachdb/pebble"
 )
 
-// MESSAGE FORMAT: INS KEY VALUE
-// RESPONSE FORMAT: ACK KEY
-func (b *Bus) HandleINS(conn net.Conn, parts []string) {
-	if len(parts) < 3 {
-		conn.Write([]byte("Err: Incorrect Format: INS KEY VALUE"))
-		return
+// INS InsertRequest{key, value, durability, checksum}, a SET forwarded to the master of the key
+func (b *Bus) HandleINS(req *pb.InsertRequest) error {
+	if len(req.Key) == 0 {
+		return errors.New("incorrect format: INS KEY VALUE")
 	}
-	fmt.Printf("RECEIVED FORWARD REQ: KEY//%s\n", parts[1])
-
-	hash := utils.CalculateCRC16([]byte(parts[1]))
+	if err := engine.CheckUserKey(req.Key); err != nil {
+		return err
+	}
+	if err := b.db.VerifyInsert(req); err != nil {
+		return err
+	}
+	hash := utils.CalculateCRC16(req.Key)
 	master_slot := b.server.FindNodeIdx(hash % b.server.N)
 	sr, ok := b.server.GetSlotRangeByIndex(master_slot)
 	if !ok {
 		// handle error (range not found)
-		conn.Write([]byte("ERR Internal Error\n"))
-		return
+		return errors.New("internal error")
 	}
 	g := sr.MasterID
 
 	if g != b.server.ServerID {
-		conn.Write([]byte("ERR NOT MASTER NODE\n"))
-		return
+		return errors.New("NOT MASTER NODE")
 	}
 
-	// db.Set(parts[1], parts[2], conn)
-	b.db.Db.Set([]byte(parts[1]), []byte(parts[2]), pebble.Sync)
-	//should handle the replication as well.
-	replicaNodes := sr.Nodes
-	for _, replicaNodeID := range replicaNodes {
-		replicaNode, exists := b.server.GetConnectedNodeData(replicaNodeID)
-		if !exists {
-			continue // Skip if the replica node is not found
-		}
-		busaddr, _ := utils.BumpPort(replicaNode.Addr, 10000)
-		Sconn, err := net.Dial("tcp", busaddr)
-		if err != nil {
-			fmt.Printf("ERR: HandleINS: %s\n", err.Error())
-			continue
-		}
-		defer Sconn.Close()
-
-		insCmd := fmt.Sprintf("REP %s %s\n", parts[1], parts[2])
-		Sconn.Write([]byte(insCmd))
-
-		expectedResponse := "ACK REP"
-		reader := bufio.NewReader(Sconn)
-		resp, _ := reader.ReadString('\n')
+	if !b.server.PartitionAllows(true) {
+		return errors.New("MINORITY PARTITION")
+	}
 
-		resp = strings.TrimSpace(resp)
-		if resp != expectedResponse {
-			fmt.Printf("ERR: HandleINS: Expected %s, got %s\n", expectedResponse, resp)
+	var mode engine.DurabilityMode
+	if req.Durability != "" {
+		var ok bool
+		if mode, ok = engine.ParseDurability(req.Durability); !ok {
+			return fmt.Errorf("unknown durability %q", req.Durability)
 		}
 	}
-	conn.Write([]byte("ACK INS\n"))
+	value, err := b.db.PutStamped(req.Key, req.Value, mode)
+	if err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	//should handle the replication as well.
+	rep, err := b.db.ReplicationOf(b.server, req.Key, value)
+	if err != nil {
+		return fmt.Errorf("replication failed: %w", err)
+	}
+	if !b.db.ReplicateWrite(b.server, sr, rep) {
+		fmt.Printf("ERR: HandleINS: replication of %s failed\n", req.Key)
+	}
+	return nil
 }
@@ -0,0 +1,23 @@
+package bus
+
+import (
+	"errors"
+	"iris/serializer/pb"
+	"log"
+)
+
+// NODE_DEAD NodeDeadRequest{reporter_id, target_id}
+func (b *Bus) HandleNodeDead(req *pb.NodeDeadRequest) error {
+	if req.ReporterId == "" || req.TargetId == "" {
+		return errors.New("usage: NODE_DEAD <REPORTER_ID> <TARGET_ID>")
+	}
+	if b.server.GetMasterNodeID() != b.server.ServerID {
+		return errors.New("not the master")
+	}
+
+	if !b.server.RecordPeerReport(req.ReporterId, req.TargetId) {
+		return errors.New("unknown node")
+	}
+	log.Printf("[FAILURE DETECTOR]: %s reports %s as DEAD\n", req.ReporterId, req.TargetId)
+	return nil
+}
@@ -0,0 +1,24 @@
+package bus
+
+import (
+	"errors"
+	"iris/serializer/pb"
+)
+
+// PING PingRequest{sender_id}
+// RESPONSE: PingAck{node_id, incarnation}
+func (b *Bus) HandlePing(req *pb.PingRequest) (*pb.PingAck, error) {
+	if req.SenderId == "" {
+		return nil, errors.New("usage: PING <SENDER_ID>")
+	}
+	return b.gossip.HandlePing(req.SenderId), nil
+}
+
+// PING_REQ PingReqRequest{sender_id, target_id}
+// RESPONSE: PingAck{target_id, incarnation}, ack is false if the target didn't answer
+func (b *Bus) HandlePingReq(req *pb.PingReqRequest) (*pb.PingAck, error) {
+	if req.SenderId == "" || req.TargetId == "" {
+		return nil, errors.New("usage: PING_REQ <SENDER_ID> <TARGET_ID>")
+	}
+	return b.gossip.HandlePingReq(req.SenderId, req.TargetId), nil
+}
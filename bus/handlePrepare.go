@@ -1,82 +1,48 @@
 package bus
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"iris/buspool"
 	"iris/config"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
-	"net"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// PREPARE <MessageID> <TargetNodeID> <TargetNodeAddr> <Start> <End> <ModifiedNodeID> <ModifiedReplicas> <TargetReplicas>
-func HandlePrepare(conn net.Conn, parts []string, s *config.Server) {
-	if len(parts) != 11 {
-		conn.Write([]byte("ERR: Usage: PREPARE <MessageID> <TargetNodeID> <TargetNodeAddr> <Start> <End> <ModifiedNodeID> <ModifiedReplicas> <TargetReplicas> <ResourceScore> <Group>\n"))
-		return
+// PREPARE PrepareRequest{MessageID, TargetNodeID, TargetNodeAddr, Start, End, ModifiedNodeID, ModifiedReplicas, TargetReplicas, ResourceScore, Group}
+func HandlePrepare(req *pb.PrepareRequest, s *config.Server) error {
+	if req.MessageId == "" || req.TargetNodeId == "" || req.ModifiedNodeId == "" {
+		return errors.New("usage: PREPARE <MessageID> <TargetNodeID> <TargetNodeAddr> <Start> <End> <ModifiedNodeID> <ModifiedReplicas> <TargetReplicas> <ResourceScore> <Group>")
 	}
-
-	messageID := parts[1]
-	targetNodeID := parts[2]
-	targetNodeAddr := parts[3]
-	group := parts[10]
-	start, err := utils.ParseUint16(parts[4])
-	if err != nil {
-		conn.Write([]byte("ERR: invalid START value\n"))
-		return
-	}
-	end, err := utils.ParseUint16(parts[5])
-	if err != nil {
-		conn.Write([]byte("ERR: invalid END value\n"))
-		return
-	}
-
-	modifiedNodeID := parts[6]
-
-	var Mreplicas []string
-	modifiedNode_replicaList := parts[7]
-	if modifiedNode_replicaList != "NONE" {
-		Mreplicas = strings.Split(modifiedNode_replicaList, ",")
-	}
-
-	var Treplicas []string
-	targetNode_replicaList := parts[8]
-	if targetNode_replicaList != "NONE" {
-		Treplicas = strings.Split(targetNode_replicaList, ",")
-	}
-
-	resourceScore, err := utils.ParseFloat64(parts[9])
+	start, end, err := slotBounds(req.Start, req.End)
 	if err != nil {
-		conn.Write([]byte("ERR: invalid RESOURCE_SCORE value\n"))
-		return
+		return err
 	}
 
 	// SourceNodeID is this server (the receiver of PREPARE)
 	if err := s.AcceptPrepare(
-		messageID,
+		req.MessageId,
 		s.ServerID,
-		targetNodeID,
-		targetNodeAddr,
+		req.TargetNodeId,
+		req.TargetNodeAddr,
 		start,
 		end,
-		modifiedNodeID,
-		Mreplicas,
-		Treplicas,
-		resourceScore,
-		group,
+		req.ModifiedNodeId,
+		req.ModifiedReplicas,
+		req.TargetReplicas,
+		req.ResourceScore,
+		req.Group,
 	); err != nil {
-		log.Printf("PREPARE %s rejected: %v", messageID, err)
-		conn.Write([]byte(fmt.Sprintf("ERR: %v\n", err)))
-		return
+		log.Printf("PREPARE %s rejected: %v", req.MessageId, err)
+		return err
 	}
 
-	log.Printf("PREPARE message %s received and accepted.", messageID)
-	msg := fmt.Sprintf("PREPARE SUCCESS %s", messageID)
-	conn.Write([]byte(msg + "\n"))
+	log.Printf("PREPARE message %s received and accepted.", req.MessageId)
+	return nil
 }
 
 // sends a PREPARE message to all other nodes in the cluster.
@@ -91,35 +57,19 @@ func Prepare(
 ) (string, bool, error) {
 	messageID := uuid.New().String()
 
-	var modifiedReplicaList string
-	if len(modifiedNode_replica_list) == 0 {
-		modifiedReplicaList = "NONE"
-	} else {
-		modifiedReplicaList = strings.Join(modifiedNode_replica_list, ",")
+	req := &pb.PrepareRequest{
+		MessageId:        messageID,
+		TargetNodeId:     newNode.ServerID,
+		TargetNodeAddr:   newNode.Addr,
+		Start:            uint32(start),
+		End:              uint32(end),
+		ModifiedNodeId:   modifiedNode.ServerID,
+		ModifiedReplicas: modifiedNode_replica_list,
+		TargetReplicas:   targetNode_replica_list,
+		ResourceScore:    newNode.ResourceScore,
+		Group:            newNode.Group,
 	}
 
-	var targetReplicaList string
-	if len(targetNode_replica_list) == 0 {
-		targetReplicaList = "NONE"
-	} else {
-		targetReplicaList = strings.Join(targetNode_replica_list, ",")
-	}
-
-	message := fmt.Sprintf(
-		"PREPARE %s %s %s %d %d %s %s %s %f %s\n",
-		messageID,
-		newNode.ServerID,
-		newNode.Addr,
-		start,
-		end,
-		modifiedNode.ServerID,
-		modifiedReplicaList,
-		targetReplicaList,
-		newNode.ResourceScore,
-		newNode.Group,
-	)
-	expectedResp := fmt.Sprintf("PREPARE SUCCESS %s", messageID)
-
 	// Update the coordinating server's own prepared state via config method
 	if err := s.AddLocalPrepare(
 		messageID,
@@ -152,29 +102,8 @@ func Prepare(
 		}
 
 		log.Printf("Sending PREPARE %s to %s via bus port %s", messageID, node.ServerID, busport)
-		conn, err := net.Dial("tcp", busport)
-		if err != nil {
-			return "", false, fmt.Errorf("failed to connect to peer(ID:%s) %s: %w", node.ServerID, busport, err)
-		}
-		conn.SetDeadline(time.Now().Add(15 * time.Second))
-
-		if _, err = conn.Write([]byte(message)); err != nil {
-			conn.Close()
-			return "", false, fmt.Errorf("failed to write to peer(ID:%s) %s: %w", node.ServerID, busport, err)
-		}
-
-		reader := bufio.NewReader(conn)
-		resp, err := reader.ReadString('\n')
-		conn.Close()
-		if err != nil {
-			return "", false, fmt.Errorf("failed to read response from peer(ID:%s) %s: %w", node.ServerID, busport, err)
-		}
-
-		if strings.TrimSpace(resp) != expectedResp {
-			return "", false, fmt.Errorf(
-				"unexpected response from peer(ID:%s) %s: got %q, expected %q",
-				node.ServerID, busport, strings.TrimSpace(resp), expectedResp,
-			)
+		if err := buspool.Call(busport, pb.BusCommand_PREPARE, req, nil, 15*time.Second); err != nil {
+			return "", false, fmt.Errorf("PREPARE to peer(ID:%s) %s failed: %w", node.ServerID, busport, err)
 		}
 		log.Printf("Received successful PREPARE response from %s for %s.", node.ServerID, messageID)
 	}
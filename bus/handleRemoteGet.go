@@ -0,0 +1,32 @@
+package bus
+
+import (
+	"errors"
+	"iris/serializer/pb"
+	"time"
+)
+
+// RGET RemoteGetRequest{key, max_staleness_ms}
+// RESPONSE: RemoteGetResponse{found, stale, value}
+func (b *Bus) HandleRemoteGet(req *pb.RemoteGetRequest) (*pb.RemoteGetResponse, error) {
+	return b.db.HandleRemoteGet(b.server, req)
+}
+
+// REPL_OFFSET ReplicationOffset{master_id, seq, master_unix_ms, dropped, stream_id, acked_seq}
+// A marker with a stream ID comes from a synchronous stream, the others from the async one.
+func (b *Bus) HandleReplicationOffset(req *pb.ReplicationOffset) error {
+	if req.MasterId == "" {
+		return errors.New("usage: REPL_OFFSET <MASTER_ID> <SEQ> <MASTER_UNIX_MS>")
+	}
+
+	if req.StreamId != 0 {
+		if b.db.Stream != nil {
+			b.db.Stream.ObserveOffset(req)
+		}
+		return nil
+	}
+	if b.db.Async != nil {
+		b.db.Async.ObserveOffset(req.MasterId, req.Seq, time.UnixMilli(req.MasterUnixMs), req.Dropped)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"iris/engine"
+	"iris/serializer/pb"
+	"log"
+)
+
+// REP_BATCH ReplicateBatch{master_id, first_seq, entries, stream_id, acked_seq}
+// RESPONSE: ReplicateBatchAck{acked_seq, applied}, sent once the whole batch is durable
+// A batch holding a value that fails its checksum is refused whole, the master sends it again.
+func (b *Bus) HandleReplicateBatch(req *pb.ReplicateBatch) (*pb.ReplicateBatchAck, error) {
+	if len(req.Entries) == 0 {
+		return nil, errors.New("empty replication batch")
+	}
+	for _, entry := range req.Entries {
+		if err := engine.CheckUserKey(entry.Key); err != nil {
+			return nil, fmt.Errorf("replication batch entry %q: %w", entry.Key, err)
+		}
+		if err := b.db.VerifyReplicated(entry, "REP_BATCH from "+req.MasterId); err != nil {
+			return nil, err
+		}
+	}
+
+	applied, err := b.db.PutBatchLWW(req.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	if b.db.Stream != nil {
+		b.db.Stream.ObserveBatch(req)
+	}
+	lastSeq := req.FirstSeq + uint64(len(req.Entries)) - 1
+	if skipped := len(req.Entries) - applied; skipped > 0 {
+		log.Printf("[INFO]: replication batch %d-%d from %s: %d writes older than the stored values ignored\n", req.FirstSeq, lastSeq, req.MasterId, skipped)
+	}
+	return &pb.ReplicateBatchAck{AckedSeq: lastSeq, Applied: uint32(applied)}, nil
+}
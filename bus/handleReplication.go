@@ -1,17 +1,27 @@
 package bus
 
 import (
+	"errors"
 	"fmt"
-	"net"
+	"iris/engine"
+	"iris/serializer/pb"
 )
 
-// Message Format: REP KEY VALUE
-func (b *Bus) HandleReplication(conn net.Conn, parts []string) {
-	if len(parts) < 3 {
-		conn.Write([]byte("ERR: Incorrect Format, REP KEY VALUE\n"))
-		return
+// REP ReplicateRequest{key, value, hlc_ts, checksum, sealed, compression, deleted}
+// The value is applied last-writer-wins, a REP older than the stored value is acknowledged but ignored.
+// A deleted REP removes the stored value written up to hlc_ts.
+func (b *Bus) HandleReplication(req *pb.ReplicateRequest) error {
+	if len(req.Key) == 0 {
+		return errors.New("incorrect format, REP KEY VALUE HLC_TS")
 	}
-	fmt.Printf("RECEIVED REPLICATION REQ: %s,%s, %s\n", parts[0], parts[1], parts[2])
-	b.db.Set(parts[1], parts[2], conn)
-	conn.Write([]byte("ACK REP\n"))
+	if err := engine.CheckUserKey(req.Key); err != nil {
+		return err
+	}
+	if err := b.db.VerifyReplicated(req, "REP"); err != nil {
+		return err
+	}
+	if _, err := b.db.PutLWW(req); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	return nil
 }
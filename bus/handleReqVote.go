@@ -1,33 +1,18 @@
 package bus
 
 import (
+	"iris/serializer/pb"
 	"log"
-	"net"
-	"strconv"
 )
 
-func (b *Bus) HandleReqVote(conn net.Conn, parts []string) {
-	if len(parts) < 4 {
-		conn.Write([]byte("ERR invalid REQ_VOTE command\n"))
-		return
-	}
-
-	CandidateNodeID := parts[1]
-	FailedMasterNodeID := parts[2]
-	clusterVersion, err := strconv.ParseUint(parts[3], 10, 64)
-	if err != nil {
-		conn.Write([]byte("ERR invalid cluster version\n"))
-		return
-	}
-
+func (b *Bus) HandleReqVote(req *pb.VoteRequest) (*pb.VoteResponse, error) {
 	log.Printf("[INFO]: Received REQ_VOTE from node %s for failed master %s (version %d) on server %s\n",
-		CandidateNodeID, FailedMasterNodeID, clusterVersion, b.server.ServerID)
+		req.CandidateId, req.FailedMasterId, req.ClusterVersion, b.server.ServerID)
 
-	if b.server.MasterNodeID == FailedMasterNodeID && b.server.GetClusterVersion() == clusterVersion {
-		log.Printf("[INFO]: Granting vote to candidate %s on server %s\n", CandidateNodeID, b.server.ServerID)
-		conn.Write([]byte("VOTE_GRANTED\n"))
-	} else {
-		log.Printf("[INFO]: Denying vote to candidate %s on server %s (master mismatch or version mismatch)\n", CandidateNodeID, b.server.ServerID)
-		conn.Write([]byte("ERR_STALE_CLUSTER_VERSION\n"))
+	if b.server.MasterNodeID == req.FailedMasterId && b.server.GetClusterVersion() == req.ClusterVersion {
+		log.Printf("[INFO]: Granting vote to candidate %s on server %s\n", req.CandidateId, b.server.ServerID)
+		return &pb.VoteResponse{Granted: true}, nil
 	}
+	log.Printf("[INFO]: Denying vote to candidate %s on server %s (master mismatch or version mismatch)\n", req.CandidateId, b.server.ServerID)
+	return &pb.VoteResponse{Granted: false}, nil
 }
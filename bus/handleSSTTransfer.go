@@ -0,0 +1,16 @@
+package bus
+
+import (
+	"iris/serializer/pb"
+)
+
+// SST_CHUNK SstChunk{transfer_id, file, offset, data, checksum}
+func (b *Bus) HandleSSTChunk(req *pb.SstChunk) error {
+	return b.db.ReceiveSSTChunk(req)
+}
+
+// SST_INGEST SstIngest{transfer_id, start, end, files}
+// RESPONSE: SstIngestAck{bytes}, sent once the files are ingested
+func (b *Bus) HandleSSTIngest(req *pb.SstIngest) (*pb.SstIngestAck, error) {
+	return b.db.IngestTransfer(req)
+}
@@ -1,28 +1,14 @@
 package bus
 
 import (
-	"bufio"
-	"encoding/gob"
 	"iris/config"
+	"iris/serializer/pb"
 	"log"
-	"net"
 )
 
-func (b *Bus) HandleClusterSnapshot(reader *bufio.Reader, conn net.Conn) {
-	// The text "SNAPSHOT" command has already been read by the caller
-	// Now read the binary gob-encoded snapshot from the reader/connection
-
-	dec := gob.NewDecoder(reader)
-
-	var snap config.ClusterSnapshot
-	if err := dec.Decode(&snap); err != nil {
-		log.Printf("Error decoding snapshot: %v", err)
-		conn.Write([]byte("ERR: failed to decode snapshot\n"))
-		return
-	}
-
+func (b *Bus) HandleClusterSnapshot(req *pb.ClusterSnapshot) error {
 	log.Printf("Received cluster snapshot, applying...")
-	b.server.ApplyClusterSnapshot(snap)
-	conn.Write([]byte("SNAPSHOT_OK\n"))
+	b.server.ApplyClusterSnapshot(config.ClusterSnapshotFromProto(req))
 	log.Printf("Snapshot applied successfully")
+	return nil
 }
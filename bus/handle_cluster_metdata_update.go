@@ -1,42 +1,36 @@
 package bus
 
 import (
+	"errors"
 	"fmt"
-	"iris/utils"
+	"iris/serializer/pb"
 	"log"
-	"net"
 	"strings"
+	"iris/utils"
 )
 
-// CMU REP : ADD/REMOVE/UPDATE replica list of a range/server
-// CMU REP ADD SERVERID START END
-func (b *Bus) HandleClusterMetdataUpdate(conn net.Conn, parts []string) {
-	switch strings.ToUpper(parts[1]) {
-	case "REP":
+// CMU MetadataUpdate{op, server_id, start, end, enabled}
+// REPLICA_ADD: server_id becomes a replica of START-END
+// REPAIR_REQUEST: server_id asks the master to repair the replicas of its ranges
+// ASYNC_REPLICATION: async replication to the replicas outside the master's group
+func (b *Bus) HandleClusterMetdataUpdate(req *pb.MetadataUpdate) error {
+	switch req.Op {
+	case pb.MetadataUpdateOp_REPLICA_ADD:
 		{
-			if len(parts) != 6 {
-				conn.Write([]byte("ERR: invalid format, CMU REP ADD SERVERID START END\n"))
-				return
-			}
-
-			serverID := parts[3]
-			start, err := utils.ParseUint16(parts[4])
-			if err != nil {
-				conn.Write([]byte("ERR: invalid START value\n"))
-				return
+			if req.ServerId == "" {
+				return errors.New("invalid format, CMU REP ADD SERVERID START END")
 			}
-			end, err := utils.ParseUint16(parts[5])
+			serverID := req.ServerId
+			start, end, err := slotBounds(req.Start, req.End)
 			if err != nil {
-				conn.Write([]byte("ERR: invalid END value\n"))
-				return
+				return err
 			}
 
 			// check if the current server is master for the range
 			masterIdx := b.server.FindRangeIndex(start, end)
 			master, ok := b.server.GetSlotRangeByIndex(masterIdx)
 			if !ok {
-				conn.Write([]byte("ERR: internal error\n"))
-				return
+				return errors.New("internal error")
 			}
 
 			log.Printf("[🌹INFO] %s | %s", master.MasterID, serverID)
@@ -50,21 +44,16 @@ func (b *Bus) HandleClusterMetdataUpdate(conn net.Conn, parts []string) {
 			}
 
 			if err := b.server.AddReplicaToRange(serverID, start, end); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR: %s\n", err.Error())))
-				return
+				return err
 			}
-
-			conn.Write([]byte("CMU ACK\n"))
 		}
-	case "REPAIR":
+	case pb.MetadataUpdateOp_REPAIR_REQUEST:
 		{
-			//CMU REPAIR REQ SERVERID
-			if len(parts) != 4 {
-				conn.Write([]byte("ERR: invalid format, CMU REPAIR REQ SERVERID START END\n"))
-				return
+			if req.ServerId == "" {
+				return errors.New("invalid format, CMU REPAIR REQ SERVERID")
 			}
 
-			serverID := parts[3]
+			serverID := req.ServerId
 			mapping, _ := b.server.RepairRangeOnMaster(serverID)
 
 			for key, replicas := range mapping {
@@ -93,7 +82,7 @@ func (b *Bus) HandleClusterMetdataUpdate(conn net.Conn, parts []string) {
 					continue
 				}
 
-				log.Printf("[💖INFO] rangeMaster: %s | ServerID: %s")
+				log.Printf("[💖INFO] rangeMaster: %s | ServerID: %s", r.MasterID, b.server.ServerID)
 				// only the master for this range should initiate transfers
 				if r.MasterID != b.server.ServerID {
 					continue
@@ -108,10 +97,31 @@ func (b *Bus) HandleClusterMetdataUpdate(conn net.Conn, parts []string) {
 				}
 			}
 		}
+	case pb.MetadataUpdateOp_ASYNC_REPLICATION:
+		{
+			start, end, err := slotBounds(req.Start, req.End)
+			if err != nil {
+				return err
+			}
+			mode := "OFF"
+			if req.Enabled {
+				mode = "ON"
+			}
+
+			if err := b.server.SetRangeAsyncReplication(start, end, req.Enabled); err != nil {
+				return err
+			}
+			if err := b.db.SaveServerMetadata(b.server); err != nil {
+				log.Printf("[WARN] Failed to save server config after CMU ASYNC: %v", err)
+			}
+
+			acked := b.server.BroadcastClusterSnapshot()
+			log.Printf("[INFO]: async cross-group replication %s for range %d-%d, snapshot sent to %d peers\n", mode, start, end, acked)
+		}
 	default:
 		{
-			conn.Write([]byte("ERR: invalid message\n"))
-			return
+			return fmt.Errorf("invalid CMU operation %s", req.Op)
 		}
 	}
+	return nil
 }
@@ -0,0 +1,42 @@
+package bus
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// BUS_MAX_CONN_REQUESTS bounds the requests of one connection running at the same time,
+// the connection isn't read further until one of them is answered.
+const BUS_MAX_CONN_REQUESTS = 64
+
+// handleFramedRequest runs a BusRequest sent through the bus connection pool, requests
+// sharing a connection run concurrently, up to one per token of slots, and are answered in
+// completion order.
+// REQUEST: #<id> <length>\n<BusRequest>
+// RESPONSE: #<id> <length>\n<BusResponse>
+func (b *Bus) handleFramedRequest(id uint64, payload []byte, conn net.Conn, writeMu *sync.Mutex, slots chan struct{}) {
+	slots <- struct{}{}
+	b.server.Wg.Add(1)
+	go func() {
+		defer b.server.Wg.Done()
+		defer func() { <-slots }()
+
+		resp := b.HandleClusterCommand(conn.RemoteAddr(), payload)
+		data, err := proto.Marshal(resp)
+		if err != nil {
+			log.Printf("[WARN]: failed to encode response of request #%d: %v\n", id, err)
+			return
+		}
+
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		header := fmt.Sprintf("#%d %d\n", id, len(data))
+		if _, err := conn.Write(append([]byte(header), data...)); err != nil {
+			log.Printf("[WARN]: failed to answer multiplexed request #%d: %v\n", id, err)
+		}
+	}()
+}
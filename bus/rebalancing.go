@@ -1,57 +1,47 @@
 package bus
 
 import (
-	"bufio"
 	"fmt"
+	"iris/buspool"
 	"iris/config"
+	"iris/engine"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
-	"net"
-	"strings"
-
-	"github.com/cockroachdb/pebble"
+	"time"
 )
 
 func (b *Bus) InitiateDataTransferToReplica(serverID string, start, end uint16) {
 
-	// Implementation of data transfer initiation logic here.
-	// loop through every data in this node and hash it to see if it belongs to the range start-end
-	// If yes, send it to the serverID
+	// send every key of the slots start-end on this node to serverID
 
 	if b.db == nil || b.db.Db == nil {
 		log.Println("InitiateDataTransferToReplica: nil db provided")
 		return
 	}
 
-	iter, err := b.db.Db.NewIter(&pebble.IterOptions{})
-	if err != nil {
-		log.Printf("InitiateDataTransferToReplica: failed to create iterator: %s", err.Error())
-		return
-	}
-	defer iter.Close()
-
-	for ok := iter.First(); ok; ok = iter.Next() {
-		key := append([]byte{}, iter.Key()...)
-		val := append([]byte{}, iter.Value()...)
-
-		slot := utils.CalculateCRC16(key) % b.server.N
-		if slotInRange(slot, start, end) {
-			if err := sendKeyValue(serverID, key, val, b.server); err != nil {
-				log.Printf("failed to send key %q to %s: %v", key, serverID, err)
-			}
+	if b.server.ClusterSupports(config.CAP_SST_TRANSFER) {
+		keys, replayed, err := b.db.TransferRange(b.server, serverID, start, end)
+		if err == nil {
+			log.Printf("[INFO]: sent slots %d-%d to %s as SST files: %d keys, %d replayed\n", start, end, serverID, keys, replayed)
+			return
 		}
+		log.Printf("[WARN]: SST transfer of slots %d-%d to %s failed, sending key by key: %v\n", start, end, serverID, err)
 	}
 
-}
-
-func slotInRange(slot, start, end uint16) bool {
-	if start <= end {
-		return slot >= start && slot <= end
+	// the keys of the range are stored next to each other, only the range is read (see engine/keyspace.go)
+	err := b.db.ScanSlots(start, end, func(key, val []byte) error {
+		if err := sendKeyValue(serverID, key, val, b.db, b.server); err != nil {
+			log.Printf("failed to send key %q to %s: %v", key, serverID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("InitiateDataTransferToReplica: failed to scan slots %d-%d: %s", start, end, err.Error())
 	}
-	return slot >= start || slot <= end
 }
 
-func sendKeyValue(serverID string, key, value []byte, s *config.Server) error {
+func sendKeyValue(serverID string, key, value []byte, db *engine.Engine, s *config.Server) error {
 	node, ok := s.GetConnectedNodeData(serverID)
 	if !ok {
 		return fmt.Errorf("node data not found for serverID: %s", serverID)
@@ -62,31 +52,13 @@ func sendKeyValue(serverID string, key, value []byte, s *config.Server) error {
 		return fmt.Errorf("failed to bump port for serverID %s: %v", serverID, err)
 	}
 
-	Sconn, err := net.Dial("tcp", busAddr)
-	if err != nil {
-		return fmt.Errorf("failed to connect to serverID %s at %s: %v", serverID, busAddr, err)
-	}
-	defer Sconn.Close()
-	//MESSAGE FORMAT: INS KEY VALUE
-	//RESPONSE FORMAT: ACK KEY
-	msg := fmt.Sprintf("REP %s %s\n", key, value)
-	_, err = Sconn.Write([]byte(msg))
+	// keep the HLC timestamp of the write, the receiver applies it last-writer-wins
+	rep, err := db.ReplicationOf(s, key, value)
 	if err != nil {
-		Sconn.Close()
-		return err
+		return fmt.Errorf("failed to decode value of %q: %v", key, err)
 	}
-
-	expectedResponse := "ACK REP"
-
-	reader := bufio.NewReader(Sconn)
-	resp, _ := reader.ReadString('\n')
-	resp = strings.TrimSpace(resp)
-	Sconn.Close()
-
-	if resp != expectedResponse {
-		fmt.Printf("res: %s, %s\n", resp, expectedResponse)
-		return fmt.Errorf("unexpected response from serverID %s: %s", serverID, resp)
-	} else {
-		return nil
+	if err := buspool.Call(busAddr, pb.BusCommand_REP, rep, nil, 10*time.Second); err != nil {
+		return fmt.Errorf("failed to send key to serverID %s at %s: %v", serverID, busAddr, err)
 	}
+	return nil
 }
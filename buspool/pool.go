@@ -0,0 +1,442 @@
+package buspool
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"iris/serializer/pb"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Pool keeps long lived connections to the bus port of every peer and multiplexes
+the bus commands over them. Every request carries an ID, the bus runs framed requests
+concurrently and answers them in whatever order they complete:
+
+	request:  #<id> <length>\n<length bytes of pb.BusRequest>
+	response: #<id> <length>\n<length bytes of pb.BusResponse>
+
+The BusRequest names the command and carries its protobuf message, see
+serializer/bus.proto for the message of every command and its reply.
+
+Every new connection starts with a HELLO request when a handshake is configured, the
+nodes exchange their protocol version and capabilities before any other command is
+sent. A peer that doesn't know HELLO predates the handshake and is reported with a
+nil Hello.
+
+A failed dial puts the peer in exponential backoff, requests fail fast until it expires.
+Idle connections are health checked with BUS_PING and closed when the check fails or
+they have not been used for POOL_IDLE_TIMEOUT.
+*/
+
+const (
+	POOL_CONNS_PER_PEER  = 2
+	POOL_DIAL_TIMEOUT    = 2 * time.Second
+	POOL_HEALTH_INTERVAL = 10 * time.Second
+	POOL_HEALTH_TIMEOUT  = 2 * time.Second
+	POOL_IDLE_TIMEOUT    = 2 * time.Minute
+	POOL_BASE_BACKOFF    = 100 * time.Millisecond
+	POOL_MAX_BACKOFF     = 10 * time.Second
+	POOL_MAX_FRAME_LEN   = 64 * 1024 * 1024
+)
+
+var (
+	ErrBackoff      = errors.New("peer is backing off after failed connection attempts")
+	ErrConnClosed   = errors.New("bus connection closed")
+	ErrIncompatible = errors.New("peer speaks an incompatible bus protocol")
+)
+
+// RemoteError is a command that reached the peer and failed there.
+type RemoteError struct {
+	Command pb.BusCommand
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s failed on peer: %s", e.Command, e.Message)
+}
+
+// Default is the pool shared by the whole process.
+var Default = NewPool()
+
+// Call sends a command to the bus at addr through the default pool.
+func Call(addr string, command pb.BusCommand, req proto.Message, resp proto.Message, timeout time.Duration) error {
+	return Default.Call(addr, command, req, resp, timeout)
+}
+
+type Pool struct {
+	mu     sync.Mutex
+	peers  map[string]*peer
+	nextID atomic.Uint64
+
+	// handshake, see SetHandshake
+	hello   func() *pb.Hello
+	onHello func(addr string, peer *pb.Hello) error
+}
+
+type peer struct {
+	addr string
+
+	mu       sync.Mutex
+	conns    [POOL_CONNS_PER_PEER]*muxConn
+	next     int
+	failures int
+	retryAt  time.Time
+	dialing  *dial // in flight, the callers needing a connection meanwhile wait for it
+}
+
+// dial is a connection being opened, done is closed once mc or err is set.
+type dial struct {
+	done chan struct{}
+	mc   *muxConn
+	err  error
+}
+
+type muxConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  map[uint64]chan result
+	closed   bool
+	lastUsed time.Time
+}
+
+type result struct {
+	payload []byte
+	err     error
+}
+
+func NewPool() *Pool {
+	return &Pool{peers: make(map[string]*peer)}
+}
+
+// Call sends req as the given command to the bus at addr and decodes the reply into
+// resp. req and resp may be nil for commands without a message or a reply. A command
+// that failed on the peer returns a *RemoteError.
+func (p *Pool) Call(addr string, command pb.BusCommand, req proto.Message, resp proto.Message, timeout time.Duration) error {
+	mc, err := p.peerFor(addr).get(p)
+	if err != nil {
+		return err
+	}
+	mc.mu.Lock()
+	mc.lastUsed = time.Now()
+	mc.mu.Unlock()
+
+	if err := mc.call(p.nextID.Add(1), command, req, resp, timeout); err != nil {
+		return fmt.Errorf("bus request to %s: %w", addr, err)
+	}
+	return nil
+}
+
+// SetHandshake makes every new connection send the Hello returned by hello, the
+// answer of the peer is handed to onHello. An error from onHello closes the
+// connection and fails the request that opened it.
+func (p *Pool) SetHandshake(hello func() *pb.Hello, onHello func(addr string, peer *pb.Hello) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hello = hello
+	p.onHello = onHello
+}
+
+func (p *Pool) peerFor(addr string) *peer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pe, ok := p.peers[addr]
+	if !ok {
+		pe = &peer{addr: addr}
+		p.peers[addr] = pe
+	}
+	return pe
+}
+
+// get returns an open connection to the peer, round robin over POOL_CONNS_PER_PEER slots.
+// A missing connection is dialed without holding pe.mu, one dial at a time: the callers
+// arriving meanwhile wait for it and share its outcome.
+func (pe *peer) get(p *Pool) (*muxConn, error) {
+	pe.mu.Lock()
+	slot := pe.next
+	pe.next = (pe.next + 1) % POOL_CONNS_PER_PEER
+	if mc := pe.conns[slot]; mc != nil && !mc.isClosed() {
+		pe.mu.Unlock()
+		return mc, nil
+	}
+
+	if d := pe.dialing; d != nil {
+		pe.mu.Unlock()
+		<-d.done
+		return d.mc, d.err
+	}
+
+	if time.Now().Before(pe.retryAt) {
+		defer pe.mu.Unlock()
+		// don't dial while backing off, but keep using the connections that still work
+		for _, mc := range pe.conns {
+			if mc != nil && !mc.isClosed() {
+				return mc, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", pe.addr, ErrBackoff)
+	}
+
+	d := &dial{done: make(chan struct{})}
+	pe.dialing = d
+	pe.mu.Unlock()
+
+	d.mc, d.err = p.dial(pe.addr)
+
+	pe.mu.Lock()
+	pe.dialing = nil
+	if d.err != nil {
+		pe.backoff()
+	} else {
+		pe.failures = 0
+		pe.conns[slot] = d.mc
+	}
+	pe.mu.Unlock()
+	close(d.done)
+	return d.mc, d.err
+}
+
+// dial opens a connection to addr and runs the handshake on it.
+func (p *Pool) dial(addr string) (*muxConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, POOL_DIAL_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+
+	mc := &muxConn{conn: conn, pending: make(map[uint64]chan result), lastUsed: time.Now()}
+	go mc.readLoop()
+	if err := p.handshake(addr, mc); err != nil {
+		mc.fail(ErrConnClosed)
+		return nil, err
+	}
+	return mc, nil
+}
+
+// backoff delays the next dial to the peer. Caller must hold pe.mu.
+func (pe *peer) backoff() {
+	pe.failures++
+	backoff := POOL_BASE_BACKOFF << min(pe.failures-1, 16)
+	if backoff > POOL_MAX_BACKOFF {
+		backoff = POOL_MAX_BACKOFF
+	}
+	pe.retryAt = time.Now().Add(backoff)
+}
+
+// handshake sends HELLO on a new connection and reports the answer of the peer.
+func (p *Pool) handshake(addr string, mc *muxConn) error {
+	p.mu.Lock()
+	hello, onHello := p.hello, p.onHello
+	p.mu.Unlock()
+	if hello == nil {
+		return nil
+	}
+
+	reply := &pb.Hello{}
+	err := mc.call(p.nextID.Add(1), pb.BusCommand_HELLO, hello(), reply, POOL_DIAL_TIMEOUT)
+	var remoteErr *RemoteError
+	switch {
+	case errors.As(err, &remoteErr):
+		// the peer doesn't know HELLO, it runs a version from before the handshake
+		reply = nil
+	case err != nil:
+		return fmt.Errorf("HELLO to %s: %w", addr, err)
+	}
+
+	if onHello == nil {
+		return nil
+	}
+	if err := onHello(addr, reply); err != nil {
+		return fmt.Errorf("%s: %w: %v", addr, ErrIncompatible, err)
+	}
+	return nil
+}
+
+func (mc *muxConn) isClosed() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.closed
+}
+
+func (mc *muxConn) call(id uint64, command pb.BusCommand, req proto.Message, resp proto.Message, timeout time.Duration) error {
+	frame := &pb.BusRequest{Command: command}
+	if req != nil {
+		body, err := proto.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", command, err)
+		}
+		frame.Body = body
+	}
+	payload, err := proto.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", command, err)
+	}
+
+	reply, err := mc.request(id, payload, timeout)
+	if err != nil {
+		return err
+	}
+
+	var response pb.BusResponse
+	if err := proto.Unmarshal(reply, &response); err != nil {
+		return fmt.Errorf("decode %s response: %w", command, err)
+	}
+	if response.Error != "" {
+		return &RemoteError{Command: command, Message: response.Error}
+	}
+	if resp != nil {
+		if err := proto.Unmarshal(response.Body, resp); err != nil {
+			return fmt.Errorf("decode %s reply: %w", command, err)
+		}
+	}
+	return nil
+}
+
+func (mc *muxConn) request(id uint64, payload []byte, timeout time.Duration) ([]byte, error) {
+	ch := make(chan result, 1)
+
+	mc.mu.Lock()
+	if mc.closed {
+		mc.mu.Unlock()
+		return nil, ErrConnClosed
+	}
+	mc.pending[id] = ch
+	mc.mu.Unlock()
+
+	frame := append([]byte(fmt.Sprintf("#%d %d\n", id, len(payload))), payload...)
+	mc.writeMu.Lock()
+	_ = mc.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err := mc.conn.Write(frame)
+	mc.writeMu.Unlock()
+	if err != nil {
+		mc.fail(err)
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.payload, res.err
+	case <-timer.C:
+		mc.mu.Lock()
+		delete(mc.pending, id)
+		mc.mu.Unlock()
+		return nil, fmt.Errorf("request #%d timed out after %s", id, timeout)
+	}
+}
+
+// readLoop delivers response frames to the waiting requests until the connection fails.
+func (mc *muxConn) readLoop() {
+	reader := bufio.NewReader(mc.conn)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			mc.fail(err)
+			return
+		}
+		id, length, err := ParseFrameHeader(header)
+		if err != nil {
+			mc.fail(err)
+			return
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			mc.fail(err)
+			return
+		}
+
+		mc.mu.Lock()
+		ch, ok := mc.pending[id]
+		delete(mc.pending, id)
+		mc.mu.Unlock()
+		if ok {
+			ch <- result{payload: payload}
+		}
+	}
+}
+
+// ParseFrameHeader parses the "#<id> <length>" header line of a request or response frame.
+func ParseFrameHeader(header string) (uint64, int, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "#") {
+		return 0, 0, fmt.Errorf("invalid frame header %q", strings.TrimSpace(header))
+	}
+	id, err := strconv.ParseUint(parts[0][1:], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid frame id %q", parts[0])
+	}
+	length, err := strconv.Atoi(parts[1])
+	if err != nil || length < 0 || length > POOL_MAX_FRAME_LEN {
+		return 0, 0, fmt.Errorf("invalid frame length %q", parts[1])
+	}
+	return id, length, nil
+}
+
+// fail closes the connection and fails every request waiting on it.
+func (mc *muxConn) fail(err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.closed {
+		return
+	}
+	mc.closed = true
+	mc.conn.Close()
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		err = ErrConnClosed
+	}
+	for id, ch := range mc.pending {
+		ch <- result{err: err}
+		delete(mc.pending, id)
+	}
+}
+
+// HealthCheck pings the idle connections of the pool and drops the broken ones.
+func (p *Pool) HealthCheck() {
+	for {
+		time.Sleep(POOL_HEALTH_INTERVAL)
+
+		p.mu.Lock()
+		peers := make([]*peer, 0, len(p.peers))
+		for _, pe := range p.peers {
+			peers = append(peers, pe)
+		}
+		p.mu.Unlock()
+
+		for _, pe := range peers {
+			pe.mu.Lock()
+			conns := pe.conns
+			pe.mu.Unlock()
+
+			for _, mc := range conns {
+				if mc == nil || mc.isClosed() {
+					continue
+				}
+				mc.mu.Lock()
+				idle := time.Since(mc.lastUsed)
+				mc.mu.Unlock()
+
+				if idle > POOL_IDLE_TIMEOUT {
+					mc.fail(ErrConnClosed)
+					continue
+				}
+				if err := mc.call(p.nextID.Add(1), pb.BusCommand_BUS_PING, nil, nil, POOL_HEALTH_TIMEOUT); err != nil {
+					log.Printf("[WARN]: bus connection to %s failed its health check: %v\n", pe.addr, err)
+					mc.fail(ErrConnClosed)
+				}
+			}
+		}
+	}
+}
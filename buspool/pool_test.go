@@ -0,0 +1,68 @@
+package buspool
+
+import (
+	"iris/serializer/pb"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// silentPeer accepts connections and never answers, a HELLO to it runs until its timeout.
+func silentPeer(t *testing.T) (string, *atomic.Int32) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	accepted := &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return lis.Addr().String(), accepted
+}
+
+func TestGetSharesInFlightDial(t *testing.T) {
+	addr, accepted := silentPeer(t)
+	p := NewPool()
+	p.SetHandshake(func() *pb.Hello { return &pb.Hello{} }, nil)
+	pe := p.peerFor(addr)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pe.get(p)
+			errs <- err
+		}()
+	}
+
+	// the handshake is running, the peer lock must be free meanwhile
+	time.Sleep(POOL_DIAL_TIMEOUT / 4)
+	if !pe.mu.TryLock() {
+		t.Fatal("peer lock held during the dial")
+	}
+	pe.mu.Unlock()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil {
+			t.Fatal("get succeeded against a silent peer")
+		}
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("%d connections dialed, want 1", n)
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import "fmt"
+
+// SetRangeAsyncReplication turns asynchronous cross-group replication on or off for the
+// range start-end. Only the master of the cluster changes it, the new metadata is
+// broadcast with a snapshot afterwards.
+func (s *Server) SetRangeAsyncReplication(start, end uint16, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MasterNodeID != s.ServerID {
+		return fmt.Errorf("not the master node, send the request to %s", s.MasterNodeID)
+	}
+
+	idx := s.findRangeIndexLocked(start, end)
+	if idx < 0 {
+		return fmt.Errorf("range %d-%d not found", start, end)
+	}
+	if s.Metadata[idx].AsyncCrossGroup == enabled {
+		return nil
+	}
+
+	s.Metadata[idx].AsyncCrossGroup = enabled
+	s.Cluster_Version++
+	return nil
+}
+
+// SplitReplicasByGroup returns the replicas of the range that are written synchronously
+// and the ones that receive the async replication stream. Unless AsyncCrossGroup is set
+// on the range every replica is synchronous, otherwise only the replicas in the group of
+// the range master are.
+func (s *Server) SplitReplicasByGroup(sr *SlotRange) (sync []string, async []string) {
+	if !sr.AsyncCrossGroup {
+		return sr.Nodes, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// a node without the async stream would miss the writes, keep them synchronous
+	if !s.clusterSupportsLocked(CAP_ASYNC_REPLICATION) {
+		return sr.Nodes, nil
+	}
+
+	masterGroup := ""
+	if master, ok := s.Nodes[sr.MasterID]; ok && master != nil {
+		masterGroup = master.Group
+	}
+	for _, id := range sr.Nodes {
+		node, ok := s.Nodes[id]
+		if ok && node != nil && node.Group != masterGroup {
+			async = append(async, id)
+			continue
+		}
+		sync = append(sync, id)
+	}
+	return sync, async
+}
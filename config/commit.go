@@ -9,6 +9,7 @@ import (
 // ApplyCommitByID applies a COMMIT for the given messageID locally.
 // It encapsulates all mutation of Prepared, Metadata, Nodes, Cluster_Version.
 func (s *Server) ApplyCommitByID(messageID string) error {
+	defer s.notifyMembership(s.nodeIDs())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -28,6 +29,7 @@ func (s *Server) ApplyCommitByID(messageID string) error {
 			Group:         preparedMsg.Group,
 		}
 		s.Nnode++
+		s.syncGroupsLocked()
 		log.Printf("New node %s added to the cluster.", preparedMsg.TargetNodeID)
 	}
 
@@ -57,6 +59,8 @@ func (s *Server) ApplyCommitByID(messageID string) error {
 		End:      preparedMsg.End,
 		MasterID: preparedMsg.TargetNodeID,
 		Nodes:    preparedMsg.TargetNodeReplicaList,
+		// the split off part keeps the replication mode of the range it came from
+		AsyncCrossGroup: s.Metadata[modifiedRangeIdx].AsyncCrossGroup,
 	}
 	s.Metadata = append(s.Metadata, newJoinNodeRange)
 
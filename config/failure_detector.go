@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
+	"iris/utils"
+	"log"
+	"time"
+)
+
+const (
+	DEFAULT_SUSPECT_TIMEOUT       = 45 * time.Second // 3 missed heartbeats
+	DEFAULT_DEAD_TIMEOUT          = 90 * time.Second
+	DEFAULT_EVICTION_GRACE_PERIOD = 60 * time.Second
+)
+
+// ConfigureFailureDetection applies the failure detection timeouts from the
+// config file, falling back to the defaults for anything not set.
+func (s *Server) ConfigureFailureDetection(config *utils.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.SuspectTimeout = DEFAULT_SUSPECT_TIMEOUT
+	s.DeadTimeout = DEFAULT_DEAD_TIMEOUT
+	s.EvictionGracePeriod = DEFAULT_EVICTION_GRACE_PERIOD
+	s.PartitionPolicy = DEFAULT_PARTITION_POLICY
+
+	if config != nil {
+		if config.SuspectTimeout > 0 {
+			s.SuspectTimeout = time.Duration(config.SuspectTimeout) * time.Second
+		}
+		if config.DeadTimeout > 0 {
+			s.DeadTimeout = time.Duration(config.DeadTimeout) * time.Second
+		}
+		if config.EvictionGracePeriod > 0 {
+			s.EvictionGracePeriod = time.Duration(config.EvictionGracePeriod) * time.Second
+		}
+		if config.PartitionPolicy != "" {
+			if validPartitionPolicy(config.PartitionPolicy) {
+				s.PartitionPolicy = config.PartitionPolicy
+			} else {
+				log.Printf("[WARN]: unknown partition_policy %q, using %s\n", config.PartitionPolicy, DEFAULT_PARTITION_POLICY)
+			}
+		}
+	}
+
+	if s.DeadTimeout < s.SuspectTimeout {
+		log.Printf("[WARN]: dead_timeout (%s) is lower than suspect_timeout (%s), using suspect_timeout\n", s.DeadTimeout, s.SuspectTimeout)
+		s.DeadTimeout = s.SuspectTimeout
+	}
+}
+
+// recordPeerReportsLocked stores the UNREACHABLE list a follower sent with its heartbeat.
+// Caller must hold the write lock.
+func (s *Server) recordPeerReportsLocked(reporter string, targets []string, now time.Time) {
+	if s.PeerReports == nil {
+		s.PeerReports = make(map[string]map[string]time.Time)
+	}
+
+	// a heartbeat carries the complete list, so forget what this reporter said before
+	for _, reporters := range s.PeerReports {
+		delete(reporters, reporter)
+	}
+
+	for _, target := range targets {
+		if target == "" || target == reporter {
+			continue
+		}
+		if _, ok := s.PeerReports[target]; !ok {
+			s.PeerReports[target] = make(map[string]time.Time)
+		}
+		s.PeerReports[target][reporter] = now
+	}
+}
+
+// RecordPeerReport stores a single unreachability report sent with NODE_DEAD, it counts
+// towards the quorum until the reporter's next heartbeat replaces its list.
+func (s *Server) RecordPeerReport(reporter string, target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Nodes[target]; !ok || reporter == target {
+		return false
+	}
+	if s.PeerReports == nil {
+		s.PeerReports = make(map[string]map[string]time.Time)
+	}
+	if _, ok := s.PeerReports[target]; !ok {
+		s.PeerReports[target] = make(map[string]time.Time)
+	}
+	s.PeerReports[target][reporter] = time.Now()
+	return true
+}
+
+// ReportDeadNode tells the master right away that the local failure detector declared
+// target DEAD, instead of waiting for the next heartbeat to carry it.
+func (s *Server) ReportDeadNode(target string) error {
+	masterID := s.GetMasterNodeID()
+	if masterID == s.ServerID || masterID == target {
+		// the master judges itself, and a dead master is handled by the leader election
+		return nil
+	}
+
+	master, ok := s.GetConnectedNodeData(masterID)
+	if !ok {
+		return fmt.Errorf("ReportDeadNode: master %s not found in nodes map", masterID)
+	}
+	busAddr, err := utils.BumpPort(master.Addr, 10000)
+	if err != nil {
+		return fmt.Errorf("ReportDeadNode: failed to derive bus address from %s: %w", master.Addr, err)
+	}
+
+	req := &pb.NodeDeadRequest{ReporterId: s.ServerID, TargetId: target}
+	if err := buspool.Call(busAddr, pb.BusCommand_NODE_DEAD, req, nil, 5*time.Second); err != nil {
+		return fmt.Errorf("ReportDeadNode: failed to report to master %s: %w", masterID, err)
+	}
+	return nil
+}
+
+// EvaluateNodeHealth runs on the master. It combines the heartbeat timestamps of the
+// followers with the unreachability reported by their peers into a verdict per node:
+//
+//   - ALIVE:   heartbeat received within SuspectTimeout and no peer complains
+//   - SUSPECT: heartbeat older than SuspectTimeout, or at least one peer can't reach it
+//   - DEAD:    heartbeat older than DeadTimeout, or older than SuspectTimeout while
+//     a quorum of the remaining nodes (master included) can't reach it
+//   - PARTITIONED: the whole group of the node went silent, see evaluateGroupsLocked
+//
+// Returns the IDs of the nodes that have been DEAD for longer than EvictionGracePeriod.
+// Partitioned nodes are never evicted, and nothing is evicted while the master itself
+// is on the minority side of a split.
+func (s *Server) EvaluateNodeHealth() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.LastSeen == nil {
+		s.LastSeen = make(map[string]time.Time)
+	}
+	if s.DeadSince == nil {
+		s.DeadSince = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	verdicts := make(map[string]NodeStatus, len(s.Nodes))
+	silences := make(map[string]time.Duration, len(s.Nodes))
+	reports := make(map[string]int, len(s.Nodes))
+
+	for id, node := range s.Nodes {
+		if id == s.ServerID || node == nil {
+			continue
+		}
+
+		lastSeen, ok := s.LastSeen[id]
+		if !ok {
+			// never heard from this node (fresh join or master restart), start the clock now
+			s.LastSeen[id] = now
+			continue
+		}
+		silence := now.Sub(lastSeen)
+
+		reporters := 0
+		for reporter, at := range s.PeerReports[id] {
+			if now.Sub(at) > s.SuspectTimeout {
+				delete(s.PeerReports[id], reporter)
+				continue
+			}
+			reporters++
+		}
+
+		// voters are all the nodes except the one being judged
+		quorum := (len(s.Nodes)-1)/2 + 1
+
+		verdict := ALIVE
+		switch {
+		case silence >= s.DeadTimeout:
+			verdict = DEAD
+		case silence >= s.SuspectTimeout && reporters+1 >= quorum:
+			verdict = DEAD
+		case silence >= s.SuspectTimeout || reporters > 0:
+			verdict = SUSPECT
+		}
+
+		verdicts[id] = verdict
+		silences[id] = silence
+		reports[id] = reporters
+	}
+
+	s.evaluateGroupsLocked(verdicts, silences)
+
+	evict := []string{}
+	for id, verdict := range verdicts {
+		node := s.Nodes[id]
+		if node.Status != verdict {
+			log.Printf("[FAILURE DETECTOR]: node %s %s -> %s (silent for %s, reported unreachable by %d peers)\n",
+				id, node.Status, verdict, silences[id].Truncate(time.Second), reports[id])
+			node.Status = verdict
+		}
+
+		if verdict != DEAD {
+			delete(s.DeadSince, id)
+			continue
+		}
+
+		deadSince, ok := s.DeadSince[id]
+		if !ok {
+			s.DeadSince[id] = now
+			continue
+		}
+		if now.Sub(deadSince) >= s.EvictionGracePeriod {
+			evict = append(evict, id)
+		}
+	}
+
+	if len(evict) > 0 && s.minority.Load() {
+		log.Printf("[FAILURE DETECTOR]: master is in a minority partition, not evicting %v\n", evict)
+		return []string{}
+	}
+	return evict
+}
+
+// MarkUnreachable adds nodeID to the UNREACHABLE list sent to the master with every heartbeat.
+func (s *Server) MarkUnreachable(nodeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.UnreahableNodes == nil {
+		s.UnreahableNodes = make(map[string]time.Time)
+	}
+	if _, ok := s.UnreahableNodes[nodeID]; !ok {
+		s.UnreahableNodes[nodeID] = time.Now()
+	}
+}
+
+// ClearUnreachable removes nodeID from the UNREACHABLE list.
+func (s *Server) ClearUnreachable(nodeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.UnreahableNodes, nodeID)
+}
+
+// GetMasterIDs returns the distinct IDs of all the nodes currently mastering a range.
+func (s *Server) GetMasterIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	ids := []string{}
+	for _, r := range s.Metadata {
+		if r == nil || seen[r.MasterID] {
+			continue
+		}
+		seen[r.MasterID] = true
+		ids = append(ids, r.MasterID)
+	}
+	return ids
+}
@@ -7,6 +7,7 @@ import (
 
 // ApplyClusterMetadata atomically replaces the cluster metadata and node map.
 func (s *Server) ApplyClusterMetadata(newMetadata []*SlotRange, newNodes map[string]*Node) {
+	defer s.notifyMembership(s.nodeIDs())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -23,6 +24,7 @@ func (s *Server) ApplyClusterMetadata(newMetadata []*SlotRange, newNodes map[str
 	}
 
 	s.Nnode = uint16(len(s.Nodes))
+	s.syncGroupsLocked()
 	s.Cluster_Version++
 
 	log.Printf(
@@ -1,11 +1,12 @@
 package config
 
 import (
-	"bufio"
 	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
-	"net"
+	"strings"
 	"time"
 )
 
@@ -20,7 +21,7 @@ func (server *Server) Heartbeat() {
 		if !ok {
 			log.Printf("[WARNING]: Master node data not found for ID %s\n", masterNodeID)
 			server.IncrMasterFailedAttempts()
-			if server.GetrMasterFailedAttempts() >= server.MASTER_FAIL_THRESHOLD {
+			if server.GetrMasterFailedAttempts() >= server.MASTER_FAIL_THRESHOLD && server.canStartFailover() {
 				log.Printf("[ERROR]: Master node unreachable for %d attempts. Initiating failover...\n", server.MASTER_FAIL_THRESHOLD)
 				server.InitiateMasterFailover()
 			}
@@ -29,12 +30,22 @@ func (server *Server) Heartbeat() {
 		addr := masterNode.Addr
 		busAddr, _ := utils.BumpPort(addr, 10000)
 
-		conn, err := net.DialTimeout("tcp", busAddr, 2*time.Second)
+		unreachable_ids := server.UnreacableNodeList()
+		server_group := server.GetServerGroup()
+		version := server.GetClusterVersion()
+		fmt.Printf("🍕🍕ServerGroup:%s\n", server_group)
+		req := &pb.HeartbeatRequest{ServerId: server.ServerID, Group: server_group, ClusterVersion: version}
+		if unreachable_ids != "" {
+			req.Unreachable = strings.Split(strings.Trim(unreachable_ids, ","), ",")
+		}
+
+		var response pb.HeartbeatResponse
+		err := buspool.Call(busAddr, pb.BusCommand_HEARTBEAT, req, &response, 2*time.Second)
 		if err != nil {
 			log.Printf("[WARNING]: Master node is unreachable: %v\n", err)
 			// disable writes and reads
 			server.IncrMasterFailedAttempts()
-			if server.GetrMasterFailedAttempts() >=  server.MASTER_FAIL_THRESHOLD {
+			if server.GetrMasterFailedAttempts() >=  server.MASTER_FAIL_THRESHOLD && server.canStartFailover() {
 				log.Printf("[ERROR]: Master node unreachable for %d attempts. Initiating failover...\n",  server.MASTER_FAIL_THRESHOLD)
 				server.InitiateMasterFailover()
 			}
@@ -43,36 +54,11 @@ func (server *Server) Heartbeat() {
 
 		server.ResetMasterFailedAttempts()
 
-		//HEARTBEAT SID:<server_id> UNREACHABLE:<comma_separated_sids_or_empty> GROUP:<group> VERSION:<cluster_version>
-		unreachable_ids := server.UnreacableNodeList()
-		server_group := server.GetServerGroup()
-		version := server.GetClusterVersion()
-		if unreachable_ids == "" {
-			unreachable_ids = "NONE"
-		}
-		fmt.Printf("🍕🍕ServerGroup:%s\n", server_group)
-		msg := fmt.Sprintf("HEARTBEAT %s %s %s %d\n", server.ServerID, unreachable_ids, server_group, version)
-
-		_, err = conn.Write([]byte(msg))
-		if err != nil {
-			log.Printf("[WARNING]: Failed to send HEARTBEAT to master: %v\n", err)
-			conn.Close()
-			continue
-		}
-
-		response, err := bufio.NewReader(conn).ReadString('\n')
-		if err != nil {
-			log.Printf("[WARNING]: Failed to read HEARTBEAT response: %v\n", err)
-			conn.Close()
-			continue
-		}
-
-		conn.Close()
-		switch response {
-		case "OK\n":
+		switch response.Status {
+		case pb.HeartbeatStatus_HEARTBEAT_OK:
 			continue
 
-		case "VERSION_MISMATCH\n":
+		case pb.HeartbeatStatus_HEARTBEAT_VERSION_MISMATCH:
 			log.Println("[WARNING] VERSION MISMATCH FOUND")
 			// stop all the operations until metadata is updated
 			server.GlobalPause.Store(true)
@@ -80,12 +66,12 @@ func (server *Server) Heartbeat() {
 			server.GlobalPause.Store(false)
 			continue
 
-		case "ERROR\n":
+		case pb.HeartbeatStatus_HEARTBEAT_ERROR:
 			log.Println("[WARNING] Heartbeat ERROR from Master server")
 			continue
 
 		default:
-			log.Printf("[WARNING] Unknown Response %s\n", response)
+			log.Printf("[WARNING] Unknown Response %s\n", response.Status)
 		}
 
 	}
@@ -0,0 +1,52 @@
+package config
+
+// MembershipHook is called after nodes were added to or removed from the cluster
+// metadata, e.g. by a COMMIT, a LEAVE, an eviction or an applied snapshot.
+type MembershipHook func(joined []Node, left []string)
+
+func (s *Server) SetMembershipHook(hook MembershipHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.membershipHook = hook
+}
+
+func (s *Server) nodeIDs() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make(map[string]bool, len(s.Nodes))
+	for id := range s.Nodes {
+		ids[id] = true
+	}
+	return ids
+}
+
+// notifyMembership compares the current nodes with the ones in before and reports the
+// difference to the membership hook. Must be called without holding the lock, the usual
+// pattern is to defer it before taking the lock so it runs after the unlock:
+//
+//	defer s.notifyMembership(s.nodeIDs())
+//	s.mu.Lock()
+//	defer s.mu.Unlock()
+func (s *Server) notifyMembership(before map[string]bool) {
+	s.mu.RLock()
+	hook := s.membershipHook
+	joined := []Node{}
+	for id, n := range s.Nodes {
+		if !before[id] && n != nil {
+			joined = append(joined, *n)
+		}
+	}
+	left := []string{}
+	for id := range before {
+		if _, ok := s.Nodes[id]; !ok {
+			left = append(left, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	if hook == nil || (len(joined) == 0 && len(left) == 0) {
+		return
+	}
+	hook(joined, left)
+}
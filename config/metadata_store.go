@@ -0,0 +1,270 @@
+package config
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"iris/serializer/pb"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Persisted node metadata.
+
+The identity of the node and its last view of the cluster are stored in the system
+keyspace of the engine under METADATA_KEY, in a versioned envelope:
+
+	"IRISMETA" | version (4 bytes) | crc32c of the body (4 bytes) | body
+
+Versions:
+
+	1: gob encoding of the whole config.Server, written before the envelope existed (no header)
+	2: body is a pb.NodeMetadata (serializer/metadata.proto)
+
+A record older than METADATA_VERSION is upgraded one version at a time by the functions
+in metadataMigrations, and written back in the current format once the node started.
+Protobuf ignores fields it doesn't know, so adding a field to NodeMetadata doesn't need
+a new version, only changing the meaning of existing data does.
+*/
+
+const (
+	METADATA_KEY                = "node/metadata"
+	LEGACY_METADATA_KEY         = "config:server:metadata" // user key used before the system keyspace
+	METADATA_MAGIC              = "IRISMETA"
+	METADATA_VERSION     uint32 = 2
+	METADATA_HEADER_SIZE        = len(METADATA_MAGIC) + 4 + 4
+)
+
+var (
+	ErrNoMetadata      = errors.New("no saved metadata")
+	ErrCorruptMetadata = errors.New("persisted node metadata is corrupt")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// metadataMigrations[v] upgrades the body of a version v record to version v+1.
+var metadataMigrations = map[uint32]func(body []byte) ([]byte, error){
+	1: migrateMetadataV1,
+}
+
+// PersistedMetadata returns the durable part of the server state.
+func (s *Server) PersistedMetadata() *pb.NodeMetadata {
+	snap := s.BuildClusterSnapshot()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &pb.NodeMetadata{
+		ServerId:          s.ServerID,
+		Host:              s.Host,
+		Addr:              s.Addr,
+		Port:              s.Port,
+		BusPort:           s.BusPort,
+		ReplicationFactor: int32(s.ReplicationFactor),
+		ResourceScore:     s.ResourceScore,
+		Cluster:           snap.ToProto(),
+	}
+}
+
+// EncodeNodeMetadata wraps the metadata in the current envelope.
+func EncodeNodeMetadata(md *pb.NodeMetadata) ([]byte, error) {
+	body, err := proto.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	return sealMetadata(METADATA_VERSION, body), nil
+}
+
+func sealMetadata(version uint32, body []byte) []byte {
+	buf := make([]byte, METADATA_HEADER_SIZE+len(body))
+	copy(buf, METADATA_MAGIC)
+	binary.BigEndian.PutUint32(buf[len(METADATA_MAGIC):], version)
+	binary.BigEndian.PutUint32(buf[len(METADATA_MAGIC)+4:], crc32.Checksum(body, castagnoli))
+	copy(buf[METADATA_HEADER_SIZE:], body)
+	return buf
+}
+
+// DecodeNodeMetadata checks and decodes a stored record, migrating it to METADATA_VERSION.
+// Returns the version the record was stored with.
+func DecodeNodeMetadata(raw []byte) (*pb.NodeMetadata, uint32, error) {
+	version, body, err := openMetadata(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > METADATA_VERSION {
+		return nil, version, fmt.Errorf("metadata version %d was written by a newer release, this one reads up to %d", version, METADATA_VERSION)
+	}
+
+	for v := version; v < METADATA_VERSION; v++ {
+		migrate, ok := metadataMigrations[v]
+		if !ok {
+			return nil, version, fmt.Errorf("no migration from metadata version %d", v)
+		}
+		if body, err = migrate(body); err != nil {
+			return nil, version, fmt.Errorf("%w: migrating version %d: %v", ErrCorruptMetadata, v, err)
+		}
+	}
+
+	md := &pb.NodeMetadata{}
+	if err := proto.Unmarshal(body, md); err != nil {
+		return nil, version, fmt.Errorf("%w: %v", ErrCorruptMetadata, err)
+	}
+	if err := ValidateNodeMetadata(md); err != nil {
+		return nil, version, err
+	}
+	return md, version, nil
+}
+
+// openMetadata returns the version and body of a record, a record without the
+// envelope is a version 1 gob.
+func openMetadata(raw []byte) (uint32, []byte, error) {
+	if !bytes.HasPrefix(raw, []byte(METADATA_MAGIC)) {
+		return 1, raw, nil
+	}
+	if len(raw) < METADATA_HEADER_SIZE {
+		return 0, nil, fmt.Errorf("%w: truncated header (%d bytes)", ErrCorruptMetadata, len(raw))
+	}
+	version := binary.BigEndian.Uint32(raw[len(METADATA_MAGIC):])
+	sum := binary.BigEndian.Uint32(raw[len(METADATA_MAGIC)+4:])
+	body := raw[METADATA_HEADER_SIZE:]
+	if crc32.Checksum(body, castagnoli) != sum {
+		return 0, nil, fmt.Errorf("%w: checksum mismatch on %d bytes of version %d", ErrCorruptMetadata, len(body), version)
+	}
+	return version, body, nil
+}
+
+// ValidateNodeMetadata checks that the metadata describes a usable node: an identity,
+// known nodes, and slot ranges that cover every slot exactly once.
+func ValidateNodeMetadata(md *pb.NodeMetadata) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrCorruptMetadata, fmt.Sprintf(format, args...))
+	}
+
+	if md.ServerId == "" {
+		return invalid("missing server ID")
+	}
+	if md.Port == "" || md.BusPort == "" {
+		return invalid("missing ports")
+	}
+	cluster := md.Cluster
+	if cluster == nil {
+		return invalid("missing cluster state")
+	}
+	if cluster.TotalSlots == 0 || cluster.TotalSlots > 65536 {
+		return invalid("invalid slot count %d", cluster.TotalSlots)
+	}
+
+	nodes := make(map[string]bool, len(cluster.Nodes))
+	for _, n := range cluster.Nodes {
+		if n.ServerId == "" {
+			return invalid("node without an ID")
+		}
+		if nodes[n.ServerId] {
+			return invalid("node %s listed twice", n.ServerId)
+		}
+		nodes[n.ServerId] = true
+	}
+	if !nodes[md.ServerId] {
+		return invalid("node %s is missing from its own node list", md.ServerId)
+	}
+
+	next := uint32(0)
+	for i, r := range cluster.Metadata {
+		if r.Start != next || r.End < r.Start {
+			return invalid("slot range [%d] %d-%d doesn't continue at slot %d", i, r.Start, r.End, next)
+		}
+		if !nodes[r.MasterId] {
+			return invalid("slot range %d-%d is mastered by unknown node %q", r.Start, r.End, r.MasterId)
+		}
+		next = r.End + 1
+	}
+	if len(cluster.Metadata) > 0 && next != cluster.TotalSlots {
+		return invalid("slot ranges end at slot %d, expected %d", next, cluster.TotalSlots)
+	}
+	return nil
+}
+
+// ServerFromMetadata builds a server from persisted metadata, the runtime state starts empty.
+func ServerFromMetadata(md *pb.NodeMetadata) *Server {
+	server := &Server{
+		ServerID:          md.ServerId,
+		Host:              md.Host,
+		Addr:              md.Addr,
+		Port:              md.Port,
+		BusPort:           md.BusPort,
+		ReplicationFactor: int(md.ReplicationFactor),
+		ResourceScore:     md.ResourceScore,
+		MasterNodeID:      md.Cluster.MasterNodeId,
+		Nodes:             map[string]*Node{},
+		Prepared:          make(map[string]*PrepareMessage),
+		mu:                sync.RWMutex{},
+		UnreahableNodes:   make(map[string]time.Time),
+		SuspectLeaderMsg:  make(map[string]time.Time),
+		LastSeen:          make(map[string]time.Time),
+		PeerReports:       make(map[string]map[string]time.Time),
+		DeadSince:         make(map[string]time.Time),
+		Votes:             make(map[string]bool),
+		Group:             make(map[string]*GroupInfo),
+	}
+	server.ApplyClusterSnapshot(ClusterSnapshotFromProto(md.Cluster))
+	return server
+}
+
+// legacyServerV1 holds the fields of the version 1 gob that are still persisted,
+// gob skips the others.
+type legacyServerV1 struct {
+	ServerID          string
+	Host              string
+	Addr              string
+	Port              string
+	N                 uint16
+	Nnode             uint16
+	Nodes             map[string]*Node
+	Metadata          []*SlotRange
+	ReplicationFactor int
+	Cluster_Version   uint64
+	BusPort           string
+	MasterNodeID      string
+	ResourceScore     float64
+}
+
+// migrateMetadataV1 converts the gob of a whole config.Server into a NodeMetadata.
+func migrateMetadataV1(body []byte) ([]byte, error) {
+	var legacy legacyServerV1
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	snap := ClusterSnapshot{
+		ClusterVersion: legacy.Cluster_Version,
+		TotalNodes:     uint16(len(legacy.Nodes)),
+		TotalSlots:     legacy.N,
+		MasterNodeID:   legacy.MasterNodeID,
+	}
+	for _, n := range legacy.Nodes {
+		if n != nil {
+			snap.Nodes = append(snap.Nodes, *n)
+		}
+	}
+	for _, r := range legacy.Metadata {
+		if r != nil {
+			snap.Metadata = append(snap.Metadata, *r)
+		}
+	}
+
+	return proto.Marshal(&pb.NodeMetadata{
+		ServerId:          legacy.ServerID,
+		Host:              legacy.Host,
+		Addr:              legacy.Addr,
+		Port:              legacy.Port,
+		BusPort:           legacy.BusPort,
+		ReplicationFactor: int32(legacy.ReplicationFactor),
+		ResourceScore:     legacy.ResourceScore,
+		Cluster:           snap.ToProto(),
+	})
+}
@@ -77,6 +77,9 @@ func NewServer(config *utils.Config, group_name *string) *Server {
 		ResourceScore:     0,
 		UnreahableNodes:   make(map[string]time.Time),
 		SuspectLeaderMsg:  make(map[string]time.Time),
+		LastSeen:          make(map[string]time.Time),
+		PeerReports:       make(map[string]map[string]time.Time),
+		DeadSince:         make(map[string]time.Time),
 	}
 
 	// node.Nodes = append(node.Nodes, &Node{ServerID: name, Addr: addr})
@@ -112,6 +115,8 @@ func NewServer(config *utils.Config, group_name *string) *Server {
 		Nodes:    []string{},
 	})
 
+	server.ConfigureFailureDetection(config)
+
 	server.ResourceScore = server.DetermineResourceScore(".")
 	server.Nodes[name].ResourceScore = server.ResourceScore
 
@@ -5,26 +5,78 @@ import (
 	"fmt"
 )
 
+// ErrSoleHolder is returned when removing a node would drop the only copy of a range.
+var ErrSoleHolder = errors.New("node holds the only copy of a range")
+
 func (s *Server) NodeExit(serverID string) error {
 	ok := s.HasNode(serverID)
 	if !ok {
 		return errors.New("SERVER DOESN'T EXIST")
 	}
 
-	//get all the ranges the serverID is handling
-	masterRangeIndices := s.FindRangeIndexByServerID(serverID)
+	defer s.notifyMembership(s.nodeIDs())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// make sure every range handled by serverID can be handed over before touching the metadata
+	if slot := s.soleHeldRangeLocked(serverID); slot != nil {
+		return fmt.Errorf(
+			"cannot remove %s: range %d-%d has no replicas to promote",
+			serverID, slot.Start, slot.End,
+		)
+	}
+
+	s.removeNodeLocked(serverID)
+	return nil
+}
 
+// EvictNode forcefully removes a dead node from the cluster, its ranges fail
+// over to a replica. A node holding the only copy of a range is kept, with its
+// ranges, until it comes back or an operator removes it (ErrSoleHolder).
+func (s *Server) EvictNode(serverID string) error {
+	ok := s.HasNode(serverID)
+	if !ok {
+		return errors.New("SERVER DOESN'T EXIST")
+	}
+
+	defer s.notifyMembership(s.nodeIDs())
 	s.mu.Lock()
-	// promote the first replica to master
-	for _, idx := range masterRangeIndices {
-		slot := s.Metadata[idx]
+	defer s.mu.Unlock()
 
-		if len(slot.Nodes) == 0 {
-			// no replicas to promote – you decide policy here
-			return fmt.Errorf(
-				"cannot remove %s: range %d-%d has no replicas to promote",
-				serverID, slot.Start, slot.End,
-			)
+	if slot := s.soleHeldRangeLocked(serverID); slot != nil {
+		return fmt.Errorf("%w: range %d-%d of %s has no replicas",
+			ErrSoleHolder, slot.Start, slot.End, serverID)
+	}
+
+	s.removeNodeLocked(serverID)
+
+	delete(s.LastSeen, serverID)
+	delete(s.PeerReports, serverID)
+	delete(s.DeadSince, serverID)
+	delete(s.UnreahableNodes, serverID)
+	return nil
+}
+
+// soleHeldRangeLocked returns a range mastered by serverID without any replica, nil if
+// there is none. Caller must hold the lock.
+func (s *Server) soleHeldRangeLocked(serverID string) *SlotRange {
+	for _, slot := range s.Metadata {
+		if slot.MasterID == serverID && len(slot.Nodes) == 0 {
+			return slot
+		}
+	}
+	return nil
+}
+
+// removeNodeLocked promotes the first replica of every range mastered by
+// serverID and drops serverID from the node map and all replica lists.
+// Every range of serverID must have a replica (see soleHeldRangeLocked).
+// Caller must hold the write lock.
+func (s *Server) removeNodeLocked(serverID string) {
+	// promote the first replica to master
+	for _, slot := range s.Metadata {
+		if slot.MasterID != serverID {
+			continue
 		}
 
 		firstReplica := slot.Nodes[0]
@@ -49,7 +101,6 @@ func (s *Server) NodeExit(serverID string) error {
 
 	delete(s.Nodes, serverID)
 	s.Nnode = uint16(len(s.Nodes))
+	s.syncGroupsLocked()
 	s.Cluster_Version++
-	s.mu.Unlock()
-	return nil
 }
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testServer() *Server {
+	return &Server{
+		ServerID: "n1",
+		Nodes: map[string]*Node{
+			"n1": {ServerID: "n1", Group: "g"},
+			"n2": {ServerID: "n2", Group: "g"},
+			"n3": {ServerID: "n3", Group: "g"},
+		},
+		Metadata: []*SlotRange{
+			{Start: 0, End: 99, MasterID: "n1", Nodes: []string{"n2"}},
+			{Start: 100, End: 199, MasterID: "n2", Nodes: []string{"n3"}},
+			{Start: 200, End: 299, MasterID: "n3", Nodes: []string{}},
+		},
+		LastSeen:        map[string]time.Time{},
+		PeerReports:     map[string]map[string]time.Time{},
+		DeadSince:       map[string]time.Time{},
+		UnreahableNodes: map[string]time.Time{},
+		Group:           map[string]*GroupInfo{},
+	}
+}
+
+func TestEvictNode(t *testing.T) {
+	t.Run("FailsOverToReplica", func(t *testing.T) {
+		s := testServer()
+		if err := s.EvictNode("n2"); err != nil {
+			t.Fatalf("EvictNode: %v", err)
+		}
+		if s.HasNode("n2") {
+			t.Fatal("n2 still in the cluster")
+		}
+		if sr := s.Metadata[1]; sr.MasterID != "n3" || len(sr.Nodes) != 0 {
+			t.Fatalf("range 100-199 = master %s replicas %v, want n3 and none", sr.MasterID, sr.Nodes)
+		}
+		if slices.Contains(s.Metadata[0].Nodes, "n2") {
+			t.Fatal("n2 still a replica of range 0-99")
+		}
+	})
+
+	t.Run("KeepsSoleHolder", func(t *testing.T) {
+		s := testServer()
+		version := s.Cluster_Version
+		err := s.EvictNode("n3")
+		if !errors.Is(err, ErrSoleHolder) {
+			t.Fatalf("EvictNode = %v, want ErrSoleHolder", err)
+		}
+		if !s.HasNode("n3") {
+			t.Fatal("n3 removed from the cluster")
+		}
+		if sr := s.Metadata[2]; sr.MasterID != "n3" {
+			t.Fatalf("range 200-299 moved to %s", sr.MasterID)
+		}
+		if !slices.Contains(s.Metadata[1].Nodes, "n3") {
+			t.Fatal("n3 dropped as a replica of range 100-199")
+		}
+		if s.Cluster_Version != version {
+			t.Fatalf("cluster version moved to %d", s.Cluster_Version)
+		}
+	})
+}
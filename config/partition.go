@@ -0,0 +1,251 @@
+package config
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+Partition handling.
+
+The master marks a group PARTITIONED_GROUP when every node of the group went silent at the
+same time, a whole region dropping off is far more likely a network split than all of its
+machines dying together. Nodes of a partitioned group are marked PARTITIONED instead of DEAD
+and are not evicted, so the ranges they own are still there when the network heals.
+
+Every node (the master included) also checks if it is on the minority side of a split: when
+it can reach at most half of the cluster it applies the configured PartitionPolicy to the
+client commands and stops starting leader elections, so the minority can't elect a second
+master. Once the node sees a majority again it pulls the cluster snapshot from the master,
+the side with the higher cluster version wins. A master that was itself on the minority side
+asks the other nodes for their snapshot instead: if the majority elected another master
+meanwhile, and its cluster version is not lower, this node steps down and applies it.
+*/
+
+const (
+	PARTITION_POLICY_REJECT      = "reject"      // reject reads and writes while in the minority
+	PARTITION_POLICY_STALE_READS = "stale_reads" // reject writes, serve (possibly stale) local reads
+	PARTITION_POLICY_CONTINUE    = "continue"    // keep serving reads and writes
+
+	DEFAULT_PARTITION_POLICY = PARTITION_POLICY_STALE_READS
+)
+
+func (gs GroupStatus) String() string {
+	switch gs {
+	case HEALTHY:
+		return "HEALTHY"
+	case SUSPECT_GROUP:
+		return "SUSPECT"
+	case PARTITIONED_GROUP:
+		return "PARTITIONED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func validPartitionPolicy(policy string) bool {
+	switch policy {
+	case PARTITION_POLICY_REJECT, PARTITION_POLICY_STALE_READS, PARTITION_POLICY_CONTINUE:
+		return true
+	}
+	return false
+}
+
+// evaluateGroupsLocked derives the status of every group from the verdicts of its nodes:
+//
+//   - PARTITIONED_GROUP: the group has more than one node and all of them have been
+//     silent for longer than SuspectTimeout
+//   - SUSPECT_GROUP:     no node of the group is ALIVE
+//   - HEALTHY:           at least one node of the group is ALIVE
+//
+// The verdicts of the nodes in a partitioned group are changed to PARTITIONED.
+// Caller must hold the write lock.
+func (s *Server) evaluateGroupsLocked(verdicts map[string]NodeStatus, silences map[string]time.Duration) {
+	for name, group := range s.Group {
+		if group == nil || len(group.Nodes) == 0 {
+			continue
+		}
+
+		alive, silent, judged := 0, 0, 0
+		for _, id := range group.Nodes {
+			if id == s.ServerID {
+				// we can always reach ourselves
+				alive++
+				continue
+			}
+			verdict, ok := verdicts[id]
+			if !ok {
+				alive++
+				continue
+			}
+			judged++
+			if verdict == ALIVE {
+				alive++
+			}
+			if silences[id] >= s.SuspectTimeout {
+				silent++
+			}
+		}
+
+		status := HEALTHY
+		switch {
+		case judged == len(group.Nodes) && judged > 1 && silent == judged:
+			status = PARTITIONED_GROUP
+		case alive == 0:
+			status = SUSPECT_GROUP
+		}
+
+		if status == PARTITIONED_GROUP {
+			for _, id := range group.Nodes {
+				verdicts[id] = PARTITIONED
+			}
+		}
+		if group.Status != status {
+			log.Printf("[FAILURE DETECTOR]: group %s %s -> %s\n", name, group.Status, status)
+			group.Status = status
+		}
+	}
+}
+
+// GetGroupStatuses returns the status of every group, sorted by group name.
+func (s *Server) GetGroupStatuses() []GroupInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]GroupInfo, 0, len(s.Group))
+	for _, g := range s.Group {
+		if g == nil {
+			continue
+		}
+		groups = append(groups, GroupInfo{Name: g.Name, Nodes: append([]string(nil), g.Nodes...), Status: g.Status})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// UpdatePartitionState recomputes whether this node is on the minority side of a network
+// split, i.e. it can reach at most half of the nodes (itself included). A node is
+// unreachable when gossip reported it or, for the master, when the heartbeats fail.
+// Returns the new state and whether it changed.
+func (s *Server) UpdatePartitionState() (minority bool, changed bool) {
+	s.mu.RLock()
+	total := len(s.Nodes)
+	unreachable := 0
+	for id := range s.Nodes {
+		if id == s.ServerID {
+			continue
+		}
+		_, reported := s.UnreahableNodes[id]
+		if reported || (id == s.MasterNodeID && s.MasterFailedAttempts > 0) {
+			unreachable++
+		}
+	}
+	s.mu.RUnlock()
+
+	reachable := total - unreachable
+	minority = total > 1 && reachable*2 <= total
+
+	previous := s.minority.Swap(minority)
+	if previous != minority {
+		if minority {
+			log.Printf("[WARN]: this node can reach only %d of %d nodes, entering minority partition mode (policy: %s)\n",
+				reachable, total, s.GetPartitionPolicy())
+		} else {
+			log.Printf("[INFO]: this node reaches %d of %d nodes again, leaving minority partition mode\n", reachable, total)
+		}
+	}
+	return minority, previous != minority
+}
+
+// InMinorityPartition reports whether this node last found itself on the minority side of a split.
+func (s *Server) InMinorityPartition() bool {
+	return s.minority.Load()
+}
+
+func (s *Server) GetPartitionPolicy() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.PartitionPolicy
+}
+
+// PartitionAllows tells whether a client command may run under the partition policy.
+// Everything is allowed while the node is on the majority side.
+func (s *Server) PartitionAllows(write bool) bool {
+	if !s.InMinorityPartition() {
+		return true
+	}
+
+	switch strings.ToLower(s.GetPartitionPolicy()) {
+	case PARTITION_POLICY_CONTINUE:
+		return true
+	case PARTITION_POLICY_STALE_READS:
+		return !write
+	default:
+		return false
+	}
+}
+
+// canStartFailover stops a node in a minority partition from electing a new master,
+// the majority side still has the old one (or elects its own).
+func (s *Server) canStartFailover() bool {
+	if minority, _ := s.UpdatePartitionState(); minority {
+		log.Println("[WARN]: master unreachable but this node is in a minority partition, not starting a failover")
+		return false
+	}
+	return true
+}
+
+// ReconcileMastership runs on a master once the minority partition it was in heals, see the
+// comment at the top of the file.
+func (s *Server) ReconcileMastership() error {
+	s.mu.RLock()
+	peers := make([]string, 0, len(s.Nodes))
+	for id := range s.Nodes {
+		if id != s.ServerID {
+			peers = append(peers, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	snapshots := []ClusterSnapshot{}
+	var lastErr error
+	for _, id := range peers {
+		snapshot, err := s.fetchSnapshot(id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 && lastErr != nil {
+		return lastErr
+	}
+	s.stepDown(snapshots)
+	return nil
+}
+
+// stepDown applies the newest of the snapshots received from the other nodes when another
+// node is its master and it is not older than the local metadata, ties go to the majority.
+func (s *Server) stepDown(snapshots []ClusterSnapshot) bool {
+	var newest *ClusterSnapshot
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		if snapshot.MasterNodeID == "" || snapshot.MasterNodeID == s.ServerID {
+			continue
+		}
+		if newest == nil || snapshot.ClusterVersion > newest.ClusterVersion {
+			newest = snapshot
+		}
+	}
+
+	currentVersion := s.GetClusterVersion()
+	if newest == nil || newest.ClusterVersion < currentVersion {
+		return false
+	}
+	log.Printf("[WARN]: the majority elected %s while this master was partitioned (version %d, local %d), stepping down\n",
+		newest.MasterNodeID, newest.ClusterVersion, currentVersion)
+	s.ApplyClusterSnapshot(*newest)
+	return true
+}
@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestStepDown(t *testing.T) {
+	majority := func(master string, version uint64) ClusterSnapshot {
+		return ClusterSnapshot{
+			ClusterVersion: version,
+			TotalNodes:     3,
+			Nodes:          []Node{{ServerID: "n1"}, {ServerID: "n2"}, {ServerID: "n3"}},
+			Metadata:       []SlotRange{{Start: 0, End: 299, MasterID: "n2"}},
+			MasterNodeID:   master,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		snapshots []ClusterSnapshot
+		stepDown  bool
+	}{
+		{"NoPeerAnswered", nil, false},
+		{"MajorityElectedNewMaster", []ClusterSnapshot{majority("n1", 5), majority("n2", 7)}, true},
+		{"SameVersionGoesToMajority", []ClusterSnapshot{majority("n2", 5)}, true},
+		{"MajorityOlder", []ClusterSnapshot{majority("n2", 4)}, false},
+		{"StillMaster", []ClusterSnapshot{majority("n1", 9)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// n1 was the master and sat alone on the minority side
+			s := testServer()
+			s.MasterNodeID = "n1"
+			s.Cluster_Version = 5
+
+			if got := s.stepDown(tt.snapshots); got != tt.stepDown {
+				t.Fatalf("stepDown = %v, want %v", got, tt.stepDown)
+			}
+			wantMaster := "n1"
+			if tt.stepDown {
+				wantMaster = "n2"
+			}
+			if master := s.GetMasterNodeID(); master != wantMaster {
+				t.Fatalf("master = %s, want %s", master, wantMaster)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"iris/serializer/pb"
+	"log"
+	"slices"
+	"sort"
+	"time"
+)
+
+/*
+Bus protocol versions, exchanged with HELLO when a bus connection opens:
+
+	1: typed protobuf bus messages, nodes from before the HELLO handshake
+	2: HELLO handshake with capability flags
+	3: REP_BATCH, batched and pipelined replication
+	4: SST_CHUNK / SST_INGEST, bulk range transfers with SST files
+	5: value checksums in INS, REP, REP_BATCH and RGET, timestamp of the value in RGET
+	6: sealed (encrypted) values in REP, REP_BATCH and RGET
+	7: compressed values in REP, REP_BATCH, RGET and range transfers
+	8: deletes in REP and REP_BATCH, replayed after a range transfer
+	9: stream and acked seq in REP_BATCH, dropped writes and synchronous stream markers in REPL_OFFSET
+
+A node talks to every peer with a version between MIN_BUS_PROTOCOL_VERSION and its own,
+the new fields a version adds to the messages are ignored by the older nodes. Optional
+features are advertised as capabilities and only used once every node of the cluster
+announced them, so the nodes can be upgraded one at a time.
+
+The text bus protocol from before version 1 is gone: a node speaking it can't join or talk
+to a protobuf node. Upgrading such a cluster means stopping every node first, see
+architecture.md.
+*/
+
+const (
+	BUS_PROTOCOL_VERSION     uint32 = 9
+	MIN_BUS_PROTOCOL_VERSION uint32 = 1
+)
+
+// capabilities of this node
+const (
+	CAP_FOLLOWER_READS     = "follower-reads"     // RGET with a staleness bound
+	CAP_ASYNC_REPLICATION  = "async-replication"  // REPL_OFFSET markers of the async replication stream
+	CAP_BATCH_REPLICATION  = "batch-replication"  // REP_BATCH
+	CAP_SST_TRANSFER       = "sst-transfer"       // SST_CHUNK, SST_INGEST
+	CAP_SEALED_VALUES      = "sealed-values"      // reads sealed values, only announced with encryption at rest on
+	CAP_COMPRESSED_VALUES  = "compressed-values"  // reads values compressed with every codec
+	CAP_REPLICATED_DELETES = "replicated-deletes" // applies the deleted flag of REP and REP_BATCH
+)
+
+var localCapabilities = []string{CAP_FOLLOWER_READS, CAP_ASYNC_REPLICATION, CAP_BATCH_REPLICATION, CAP_SST_TRANSFER, CAP_COMPRESSED_VALUES, CAP_REPLICATED_DELETES}
+
+// AddLocalCapability announces an optional capability enabled by the config, before the
+// bus starts.
+func AddLocalCapability(capability string) {
+	if !slices.Contains(localCapabilities, capability) {
+		localCapabilities = append(localCapabilities, capability)
+	}
+}
+
+// PeerProtocol is what a peer announced in its HELLO.
+type PeerProtocol struct {
+	Version      uint32
+	Capabilities []string
+	SeenAt       time.Time
+}
+
+// Hello returns the HELLO this node sends and answers with.
+func (s *Server) Hello() *pb.Hello {
+	return &pb.Hello{
+		ServerId:        s.ServerID,
+		ProtocolVersion: BUS_PROTOCOL_VERSION,
+		Capabilities:    localCapabilities,
+	}
+}
+
+// RecordHello stores the protocol of a peer, peer is nil for a node that doesn't
+// know HELLO. An error means the peer can't be talked to.
+func (s *Server) RecordHello(addr string, peer *pb.Hello) error {
+	if peer == nil {
+		log.Printf("[WARN]: bus peer %s predates the HELLO handshake, assuming protocol v%d\n", addr, MIN_BUS_PROTOCOL_VERSION)
+		if id, ok := s.GetServerIDFromAddr(addr); ok {
+			s.setPeerProtocol(id, MIN_BUS_PROTOCOL_VERSION, nil)
+		}
+		return nil
+	}
+	if peer.ProtocolVersion < MIN_BUS_PROTOCOL_VERSION {
+		return fmt.Errorf("node %s speaks bus protocol v%d, the oldest supported is v%d", peer.ServerId, peer.ProtocolVersion, MIN_BUS_PROTOCOL_VERSION)
+	}
+	if peer.ServerId != "" {
+		s.setPeerProtocol(peer.ServerId, peer.ProtocolVersion, peer.Capabilities)
+	}
+	return nil
+}
+
+func (s *Server) setPeerProtocol(serverID string, version uint32, capabilities []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.PeerProtocols == nil {
+		s.PeerProtocols = make(map[string]PeerProtocol)
+	}
+	if prev, ok := s.PeerProtocols[serverID]; ok && prev.Version != version {
+		log.Printf("[INFO]: node %s bus protocol v%d -> v%d\n", serverID, prev.Version, version)
+	}
+	s.PeerProtocols[serverID] = PeerProtocol{Version: version, Capabilities: capabilities, SeenAt: time.Now()}
+}
+
+// GetPeerProtocol returns the protocol version serverID announced, 0 if it didn't yet.
+func (s *Server) GetPeerProtocol(serverID string) uint32 {
+	if serverID == s.ServerID {
+		return BUS_PROTOCOL_VERSION
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.PeerProtocols[serverID].Version
+}
+
+// ClusterProtocolVersion returns the lowest bus protocol version in the cluster. Nodes
+// that haven't exchanged HELLO with this node yet count as MIN_BUS_PROTOCOL_VERSION.
+func (s *Server) ClusterProtocolVersion() uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	version := BUS_PROTOCOL_VERSION
+	for id := range s.Nodes {
+		if id == s.ServerID {
+			continue
+		}
+		peer, ok := s.PeerProtocols[id]
+		if !ok {
+			return MIN_BUS_PROTOCOL_VERSION
+		}
+		version = min(version, peer.Version)
+	}
+	return version
+}
+
+// ClusterSupports reports whether every node of the cluster announced capability.
+func (s *Server) ClusterSupports(capability string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clusterSupportsLocked(capability)
+}
+
+// clusterSupportsLocked is ClusterSupports for callers holding the lock.
+func (s *Server) clusterSupportsLocked(capability string) bool {
+	if !slices.Contains(localCapabilities, capability) {
+		return false
+	}
+	for id := range s.Nodes {
+		if id == s.ServerID {
+			continue
+		}
+		peer, ok := s.PeerProtocols[id]
+		if !ok || !slices.Contains(peer.Capabilities, capability) {
+			return false
+		}
+	}
+	return true
+}
+
+// ClusterCapabilities returns the capabilities every node of the cluster supports.
+func (s *Server) ClusterCapabilities() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	caps := []string{}
+	for _, c := range localCapabilities {
+		if s.clusterSupportsLocked(c) {
+			caps = append(caps, c)
+		}
+	}
+	sort.Strings(caps)
+	return caps
+}
@@ -1,12 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
 	"math/rand"
-	"net"
-	"strings"
 	"time"
 )
 
@@ -103,41 +104,19 @@ func (s *Server) RepairReplication(serverID string) map[string][]string {
 				continue
 			}
 
-			// Open a single connection to the peer and reuse it for all replica additions
-			conn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
-			if err != nil {
-				log.Printf("[ERROR] Server %s: failed to connect to peer %s (%s): %v", s.ServerID, peer.ServerID, busAddr, err)
-				continue
-			}
-
-			func() {
-				defer conn.Close()
-
-				for _, replicaID := range newReplicas {
-					// Send CMU REP ADD message: CMU REP ADD <SERVERID> <START> <END>
-					msg := fmt.Sprintf("CMU REP ADD %s %d %d\n", replicaID, start, end)
-					if _, err := conn.Write([]byte(msg)); err != nil {
-						log.Printf("[ERROR] Server %s: failed to send CMU REP ADD to %s: %v", s.ServerID, peer.ServerID, err)
+			for _, replicaID := range newReplicas {
+				req := &pb.MetadataUpdate{Op: pb.MetadataUpdateOp_REPLICA_ADD, ServerId: replicaID, Start: uint32(start), End: uint32(end)}
+				if err := buspool.Call(busAddr, pb.BusCommand_CMU, req, nil, 10*time.Second); err != nil {
+					log.Printf("[ERROR] Server %s: failed to send CMU REP ADD to %s: %v", s.ServerID, peer.ServerID, err)
+					var remoteErr *buspool.RemoteError
+					if errors.As(err, &remoteErr) {
 						continue
 					}
-
-					// Read response for this replica addition
-					response := make([]byte, 1024)
-					n, err := conn.Read(response)
-					if err != nil {
-						log.Printf("[ERROR] Server %s: failed to read CMU ACK from %s: %v", s.ServerID, peer.ServerID, err)
-						return
-					}
-
-					respStr := strings.TrimSpace(string(response[:n]))
-					if respStr != "CMU ACK" {
-						log.Printf("[ERROR] Server %s: unexpected response from %s for CMU REP ADD: %s", s.ServerID, peer.ServerID, respStr)
-						continue
-					}
-
-					log.Printf("[SUCCESS] Server %s: notified peer %s about new replica %s for range %d-%d", s.ServerID, peer.ServerID, replicaID, start, end)
+					break
 				}
-			}()
+
+				log.Printf("[SUCCESS] Server %s: notified peer %s about new replica %s for range %d-%d", s.ServerID, peer.ServerID, replicaID, start, end)
+			}
 		}
 
 		// Update metadata
@@ -223,29 +202,12 @@ func (s *Server) ForwardRepairRequestToMaster() (map[string][]string, bool) {
 		return nil, false
 	}
 
-	conn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
-	if err != nil {
-		log.Printf("ForwardRepairRequestToMaster: failed to connect to master %s at %s: %v", masterID, busAddr, err)
-		return nil, false
-	}
-	defer conn.Close()
-
-	// Send repair request: CMU REPAIR REQ <ServerID>
-	msg := fmt.Sprintf("CMU REPAIR REQ %s\n", s.ServerID)
-	if _, err := conn.Write([]byte(msg)); err != nil {
+	req := &pb.MetadataUpdate{Op: pb.MetadataUpdateOp_REPAIR_REQUEST, ServerId: s.ServerID}
+	if err := buspool.Call(busAddr, pb.BusCommand_CMU, req, nil, 10*time.Second); err != nil {
 		log.Printf("ForwardRepairRequestToMaster: failed to send repair request to master %s: %v", masterID, err)
 		return nil, false
 	}
-
-	// Read response (optional) and log it
-	resp := make([]byte, 1024)
-	n, err := conn.Read(resp)
-	if err != nil {
-		log.Printf("ForwardRepairRequestToMaster: error reading response from master %s: %v", masterID, err)
-		return nil, false
-	}
-	reply := strings.TrimSpace(string(resp[:n]))
-	log.Printf("ForwardRepairRequestToMaster: master %s replied: %s", masterID, reply)
+	log.Printf("ForwardRepairRequestToMaster: master %s accepted the repair request", masterID)
 
 	return nil, false
 }
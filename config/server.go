@@ -1,12 +1,12 @@
 package config
 
 import (
-	"bufio"
-	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
 	"net"
-	"strings"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,6 +21,21 @@ const (
 	PARTITIONED
 )
 
+func (ns NodeStatus) String() string {
+	switch ns {
+	case ALIVE:
+		return "ALIVE"
+	case SUSPECT:
+		return "SUSPECT"
+	case DEAD:
+		return "DEAD"
+	case PARTITIONED:
+		return "PARTITIONED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 type Node struct {
 	ServerID      string
 	Addr          string
@@ -50,6 +65,10 @@ type SlotRange struct {
 	End      uint16
 	MasterID string
 	Nodes    []string //list of replica node IDs
+
+	// replicas outside the group of the master receive writes through the async
+	// replication stream instead of synchronously, see SplitReplicasByGroup
+	AsyncCrossGroup bool
 }
 
 // PREPARE MESSAGEID TargetNodeID ADDR START END ModifiedNodeID
@@ -101,12 +120,26 @@ type Server struct {
 	Group           map[string]*GroupInfo //maps groups to node IDs
 	UnreahableNodes map[string]time.Time
 
+	// used by the master to aggregate the UNREACHABLE lists sent in heartbeats
+	// target nodeID -> reporter nodeID -> time of the report
+	PeerReports         map[string]map[string]time.Time
+	DeadSince           map[string]time.Time // when the master first declared a node DEAD
+	SuspectTimeout      time.Duration
+	DeadTimeout         time.Duration
+	EvictionGracePeriod time.Duration
+	PartitionPolicy     string      // reject | stale_reads | continue, applied while in a minority partition
+	minority            atomic.Bool // set by UpdatePartitionState
+
+	PeerProtocols map[string]PeerProtocol // bus protocol announced by every peer in HELLO
+
 	MasterFailedAttempts  int
 	SuspectLeaderMsg      map[string]time.Time
 	Votes                 map[string]bool
 	Rt                    ResourceTracker
 	ResourceScore         float64
 	MASTER_FAIL_THRESHOLD int
+
+	membershipHook MembershipHook
 }
 
 func (s *Server) GetClusterVersion() uint64 {
@@ -146,6 +179,12 @@ func (s *Server) GetrMasterFailedAttempts() int {
 	return s.MasterFailedAttempts
 }
 
+func (s *Server) GetMasterNodeID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.MasterNodeID
+}
+
 func (s *Server) UpdateMasterNodeID(nodeId string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -209,24 +248,15 @@ func (s *Server) SendReqVoteToAll() {
 			defer wg.Done()
 
 			bumpAddr, _ := utils.BumpPort(n.Addr, 10000)
-			conn, err := net.DialTimeout("tcp", bumpAddr, 2*time.Second)
-			if err != nil {
-				log.Printf("[ERROR]: Failed to connect to node %s: %v\n", n.ServerID, err)
-				return
-			}
-			defer conn.Close()
-
-			msg := fmt.Sprintf("REQ_VOTE %s %s %d\n", s.ServerID, failedMaster, clusterVersion)
-			if _, err := conn.Write([]byte(msg)); err != nil {
+			req := &pb.VoteRequest{CandidateId: s.ServerID, FailedMasterId: failedMaster, ClusterVersion: clusterVersion}
+			var response pb.VoteResponse
+			if err := buspool.Call(bumpAddr, pb.BusCommand_REQ_VOTE, req, &response, 2*time.Second); err != nil {
+				log.Printf("[ERROR]: Failed to request vote from node %s: %v\n", n.ServerID, err)
 				return
 			}
 
-			reader := bufio.NewReader(conn)
-			response, _ := reader.ReadString('\n')
-			response = strings.TrimSpace(response)
-
 			// ✅ Send result through channel instead of acquiring lock
-			if response == "VOTE_GRANTED" {
+			if response.Granted {
 				voteChan <- n.ServerID
 			}
 		}(&node)
@@ -311,43 +341,13 @@ func (s *Server) BecomeLeader() {
 
 		log.Printf("[INFO]: Connecting to peer %s at %s for snapshot broadcast\n", p.ServerID, p.Addr)
 		busAddr, _ := utils.BumpPort(p.Addr, 10000)
-		peerConn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
-		if err != nil {
-			log.Printf("[ERROR]: Failed to connect to peer %s for snapshot: %v\n", p.ServerID, err)
-			continue
-		}
-
-		log.Printf("[INFO]: Connected to peer %s, sending SNAPSHOT command\n", p.ServerID)
-		peerConn.Write([]byte("SNAPSHOT\n"))
-
-		log.Printf("[INFO]: Sending cluster snapshot data to peer %s\n", p.ServerID)
-		if err := s.SendClusterSnapshot(peerConn); err != nil {
-			log.Printf("[ERROR]: Failed to send snapshot to peer %s: %v\n", p.ServerID, err)
-			peerConn.Close()
-			continue
-		}
-
-		log.Printf("[INFO]: Snapshot data sent to peer %s, waiting for SNAPSHOT_OK\n", p.ServerID)
-		reader := bufio.NewReader(peerConn)
-		resp, err := reader.ReadString('\n')
-		if err != nil {
-			log.Printf("[ERROR]: Failed to read SNAPSHOT_OK from peer %s: %v\n", p.ServerID, err)
-			peerConn.Close()
-			continue
-		}
-
-		resp = strings.TrimSpace(resp)
-		log.Printf("[DEBUG]: Received response from peer %s: '%s'\n", p.ServerID, resp)
-
-		if resp != "SNAPSHOT_OK" {
-			log.Printf("[ERROR]: Peer %s rejected snapshot with: %s\n", p.ServerID, resp)
-			peerConn.Close()
+		if err := s.PushClusterSnapshot(busAddr); err != nil {
+			log.Printf("[ERROR]: Peer %s rejected snapshot: %v\n", p.ServerID, err)
 			continue
 		}
 
 		log.Printf("[✅INFO]: Peer %s acknowledged new cluster snapshot (version %d)\n", p.ServerID, newVersion)
 		successCount++
-		peerConn.Close()
 	}
 
 	log.Printf("[INFO]: Snapshot broadcast complete - %d peers updated on server %s\n", successCount, s.ServerID)
@@ -394,16 +394,9 @@ func (s *Server) InitiateMasterFailover() {
 	}
 
 	bumpAddr, _ := utils.BumpPort(node.Addr, 10000)
-	conn, err := net.DialTimeout("tcp", bumpAddr, 2*time.Second)
-	if err != nil {
-		log.Printf("[ERROR]: Failed to connect to node %s on server %s: %v\n", bestID, s.ServerID, err)
-		return
-	}
-	defer conn.Close()
 
-	// SUSPECT_LEADER <current_node_id> <master_node_id> <cluster_version>
-	msg := fmt.Sprintf("SUSPECT_LEADER %s %s %d \n", s.ServerID, s.MasterNodeID, s.GetClusterVersion())
-	if _, err := conn.Write([]byte(msg)); err != nil {
+	req := &pb.SuspectLeaderRequest{SenderId: s.ServerID, MasterId: s.GetMasterNodeID(), ClusterVersion: s.GetClusterVersion()}
+	if err := buspool.Call(bumpAddr, pb.BusCommand_SUSPECT_LEADER, req, nil, 2*time.Second); err != nil {
 		log.Printf("[ERROR]: Failed to send SUSPECT_LEADER to node %s on server %s: %v\n", bestID, s.ServerID, err)
 		return
 	}
@@ -446,7 +439,7 @@ func (s *Server) GetGroupMembers(group string) []string {
 	if !ok {
 		return res
 	}
-	return groupInfo.Nodes
+	return append(res, groupInfo.Nodes...)
 }
 
 func (s *Server) GetNodeAddr(nodeID string) (string, bool) {
@@ -475,6 +468,30 @@ func (s *Server) GetLocalNodeID() string {
 	return s.ServerID
 }
 
+// syncGroupsLocked rebuilds the group membership from the node map, keeping the
+// status of groups that still exist. Caller must hold the write lock.
+func (s *Server) syncGroupsLocked() {
+	groups := make(map[string]*GroupInfo)
+	for id, node := range s.Nodes {
+		if node == nil {
+			continue
+		}
+		g, ok := groups[node.Group]
+		if !ok {
+			g = &GroupInfo{Name: node.Group, Status: HEALTHY}
+			if old, exists := s.Group[node.Group]; exists && old != nil {
+				g.Status = old.Status
+			}
+			groups[node.Group] = g
+		}
+		g.Nodes = append(g.Nodes, id)
+	}
+	for _, g := range groups {
+		sort.Strings(g.Nodes)
+	}
+	s.Group = groups
+}
+
 func (s *Server) GetLocalGroup() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
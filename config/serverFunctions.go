@@ -1,47 +1,38 @@
 package config
 
 import (
-	"encoding/gob"
 	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
-	"net"
 	"sort"
 	"strings"
 	"time"
-)
-
-// Sends the cmd(SET, DEL) to the replica's
-func (s *Server) SendReplicaCMD(cmd string, replicaID string) bool {
-	s.mu.RLock()
-    r, exists := s.Nodes[replicaID]
-    if !exists {
-        s.mu.RUnlock()
-        return false
-    }
-    busAddr, _ := utils.BumpPort(r.Addr, 10000)
-    s.mu.RUnlock()
-	conn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
-	if err != nil {
-		fmt.Printf("ERR: SendReplicaCMD: %s\n", err.Error())
-		return false
-	}
 
-	conn.Write([]byte(cmd))
+	"google.golang.org/protobuf/proto"
+)
 
-	response := make([]byte, 1024)
-	n, err := conn.Read(response)
-	if err != nil {
-		fmt.Printf("SendReplicaCMD:failed to read from peer(ID:%s) %s: %w\n", r.ServerID, busAddr, err.Error())
+// Sends a replication command (REP, REPL_OFFSET) to the replica
+func (s *Server) SendReplicaCMD(command pb.BusCommand, msg proto.Message, replicaID string) bool {
+	if err := s.CallReplica(replicaID, command, msg, nil, 10*time.Second); err != nil {
+		fmt.Printf("SendReplicaCMD:failed to replicate %s to peer(ID:%s): %s\n", command, replicaID, err.Error())
 		return false
 	}
+	return true
+}
 
-	str := strings.TrimSpace(string(response[:n]))
-	if str != "ACK REP" {
-		fmt.Printf("SendReplicaCMD:failed to get ACK for cmd:%s\n", cmd)
-		return false
+// CallReplica sends a command to the bus of replicaID and decodes the reply into resp.
+func (s *Server) CallReplica(replicaID string, command pb.BusCommand, msg proto.Message, resp proto.Message, timeout time.Duration) error {
+	s.mu.RLock()
+	r, exists := s.Nodes[replicaID]
+	if !exists {
+		s.mu.RUnlock()
+		return fmt.Errorf("replica %s not found", replicaID)
 	}
-	return true
+	busAddr, _ := utils.BumpPort(r.Addr, 10000)
+	s.mu.RUnlock()
+	return buspool.Call(busAddr, command, msg, resp, timeout)
 }
 
 // FindRangeIndex returns the index of the SlotRange in s.Metadata
@@ -86,8 +77,9 @@ func (s *Server) ApplyCommitChanges(preparedMsg *PrepareMessage) error {
 	// 1. Add the new node to the global nodes map
 	s.mu.Lock()
 	if _, ok := s.Nodes[preparedMsg.TargetNodeID]; !ok {
-		s.Nodes[preparedMsg.TargetNodeID] = &Node{ServerID: preparedMsg.TargetNodeID, Addr: preparedMsg.Addr, ResourceScore: preparedMsg.ResourceScore}
+		s.Nodes[preparedMsg.TargetNodeID] = &Node{ServerID: preparedMsg.TargetNodeID, Addr: preparedMsg.Addr, ResourceScore: preparedMsg.ResourceScore, Group: preparedMsg.Group}
 		s.Nnode++
+		s.syncGroupsLocked()
 	}
 	s.mu.Unlock()
 
@@ -119,6 +111,8 @@ func (s *Server) ApplyCommitChanges(preparedMsg *PrepareMessage) error {
 		End:      preparedMsg.End,
 		MasterID: preparedMsg.TargetNodeID,
 		Nodes:    preparedMsg.TargetNodeReplicaList,
+		// the split off part keeps the replication mode of the range it came from
+		AsyncCrossGroup: s.Metadata[modifiedRangeIdx].AsyncCrossGroup,
 	}
 
 	s.Metadata = append(s.Metadata, newJoinNodeRange)
@@ -342,7 +336,6 @@ func (s *Server) RequestMetadataSnapShot() error {
 	// Read shared state safely
 	s.mu.RLock()
 	masterID := s.MasterNodeID
-	currentVersion := s.Cluster_Version
 	if masterID == "" && len(s.Metadata) > 0 && s.Metadata[0] != nil {
 		masterID = s.Metadata[0].MasterID
 	}
@@ -358,54 +351,59 @@ func (s *Server) RequestMetadataSnapShot() error {
 		return nil
 	}
 
-	node, ok := s.GetConnectedNodeData(masterID)
-	if !ok {
-		return fmt.Errorf("RequestMetadataSnapShot: master node %s not found in nodes map", masterID)
-	}
+	return s.RequestMetadataSnapShotFrom(masterID)
+}
 
-	busAddr, err := utils.BumpPort(node.Addr, 10000)
-	if err != nil {
-		return fmt.Errorf("RequestMetadataSnapShot: failed to derive bus address from %s: %w", node.Addr, err)
-	}
+// RequestMetadataSnapShotFrom pulls the cluster snapshot from any node (not only
+// the master) and applies it if it is not older than the local metadata.
+func (s *Server) RequestMetadataSnapShotFrom(nodeID string) error {
+	currentVersion := s.GetClusterVersion()
 
-	conn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
+	snapshot, err := s.fetchSnapshot(nodeID)
 	if err != nil {
-		return fmt.Errorf("RequestMetadataSnapShot: failed to connect to master %s at bus address %s: %w", masterID, busAddr, err)
-	}
-	defer conn.Close()
-
-	_ = conn.SetDeadline(time.Now().Add(15 * time.Second))
-
-	if _, err = conn.Write([]byte("REQ_METADATA\n")); err != nil {
-		return fmt.Errorf("RequestMetadataSnapShot: failed to send REQ_METADATA to master %s: %w", masterID, err)
-	}
-
-	var snapshot ClusterSnapshot
-	dec := gob.NewDecoder(conn)
-	if err := dec.Decode(&snapshot); err != nil {
-		return fmt.Errorf("RequestMetadataSnapShot: failed to decode snapshot from master %s: %w", masterID, err)
-	}
-
-	if len(snapshot.Metadata) == 0 {
-		return fmt.Errorf("RequestMetadataSnapShot: received empty metadata snapshot from master %s", masterID)
+		return err
 	}
 
 	// Prevent rollback to older metadata.
 	if snapshot.ClusterVersion < currentVersion {
 		return fmt.Errorf(
-			"RequestMetadataSnapShot: stale snapshot from master %s (remote=%d local=%d)",
-			masterID, snapshot.ClusterVersion, currentVersion,
+			"RequestMetadataSnapShot: stale snapshot from node %s (remote=%d local=%d)",
+			nodeID, snapshot.ClusterVersion, currentVersion,
 		)
 	}
 
 	s.ApplyClusterSnapshot(snapshot)
 	log.Printf(
-		"RequestMetadataSnapShot: applied snapshot from master %s (version=%d nodes=%d ranges=%d)",
-		masterID, snapshot.ClusterVersion, snapshot.TotalNodes, len(snapshot.Metadata),
+		"RequestMetadataSnapShot: applied snapshot from node %s (version=%d nodes=%d ranges=%d)",
+		nodeID, snapshot.ClusterVersion, snapshot.TotalNodes, len(snapshot.Metadata),
 	)
 	return nil
 }
 
+// fetchSnapshot asks nodeID for its cluster snapshot with REQ_METADATA.
+func (s *Server) fetchSnapshot(nodeID string) (ClusterSnapshot, error) {
+	node, ok := s.GetConnectedNodeData(nodeID)
+	if !ok {
+		return ClusterSnapshot{}, fmt.Errorf("RequestMetadataSnapShot: node %s not found in nodes map", nodeID)
+	}
+
+	busAddr, err := utils.BumpPort(node.Addr, 10000)
+	if err != nil {
+		return ClusterSnapshot{}, fmt.Errorf("RequestMetadataSnapShot: failed to derive bus address from %s: %w", node.Addr, err)
+	}
+
+	var msg pb.ClusterSnapshot
+	if err := buspool.Call(busAddr, pb.BusCommand_REQ_METADATA, nil, &msg, 15*time.Second); err != nil {
+		return ClusterSnapshot{}, fmt.Errorf("RequestMetadataSnapShot: failed to get the snapshot from node %s: %w", nodeID, err)
+	}
+	snapshot := ClusterSnapshotFromProto(&msg)
+
+	if len(snapshot.Metadata) == 0 {
+		return ClusterSnapshot{}, fmt.Errorf("RequestMetadataSnapShot: received empty metadata snapshot from node %s", nodeID)
+	}
+	return snapshot, nil
+}
+
 // func (s *Server) BeginShutdown() {
 // 	s.ShutdownOnce.Do(func() {
 // 		log.Println("[INFO] Shutdown initiated")
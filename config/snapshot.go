@@ -1,10 +1,14 @@
 package config
 
 import (
-	"encoding/gob"
 	"fmt"
+	"hash/fnv"
+	"iris/buspool"
+	"iris/serializer/pb"
+	"iris/utils"
 	"log"
-	"net"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -40,7 +44,26 @@ func (s *Server) BuildClusterSnapshot() ClusterSnapshot {
 	}
 }
 
+// MetadataHash returns a hash of the slot ranges and node membership. Two nodes with the
+// same cluster version but a different hash have diverged.
+func (s *Server) MetadataHash() uint64 {
+	nodes := s.GetNodesSnapshot()
+	metadata := s.GetServerMetadata()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ServerID < nodes[j].ServerID })
+
+	h := fnv.New64a()
+	for _, n := range nodes {
+		fmt.Fprintf(h, "N %s %s %s;", n.ServerID, n.Addr, n.Group)
+	}
+	for _, r := range metadata {
+		fmt.Fprintf(h, "R %d %d %s %s %t;", r.Start, r.End, r.MasterID, strings.Join(r.Nodes, ","), r.AsyncCrossGroup)
+	}
+	return h.Sum64()
+}
+
 func (s *Server) ApplyClusterSnapshot(snapshot ClusterSnapshot) {
+	defer s.notifyMembership(s.nodeIDs())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	oldMaster := s.MasterNodeID
@@ -64,6 +87,7 @@ func (s *Server) ApplyClusterSnapshot(snapshot ClusterSnapshot) {
 	s.N = snapshot.TotalSlots
 	s.Cluster_Version = snapshot.ClusterVersion
 	s.MasterNodeID = snapshot.MasterNodeID
+	s.syncGroupsLocked()
 
 	if oldMaster != snapshot.MasterNodeID {
 		log.Printf("[INFO]: Master changed from %s to %s (version %d). Clearing suspect messages.\n", oldMaster, snapshot.MasterNodeID, snapshot.ClusterVersion)
@@ -71,12 +95,113 @@ func (s *Server) ApplyClusterSnapshot(snapshot ClusterSnapshot) {
 	}
 }
 
-func (s *Server) SendClusterSnapshot(conn net.Conn) error {
-	snap := s.BuildClusterSnapshot()
+// ToProto converts the snapshot to its bus message.
+func (snap ClusterSnapshot) ToProto() *pb.ClusterSnapshot {
+	msg := &pb.ClusterSnapshot{
+		ClusterVersion: snap.ClusterVersion,
+		TotalNodes:     uint32(snap.TotalNodes),
+		TotalSlots:     uint32(snap.TotalSlots),
+		MasterNodeId:   snap.MasterNodeID,
+	}
+	for _, n := range snap.Nodes {
+		msg.Nodes = append(msg.Nodes, n.ToProto())
+	}
+	for _, r := range snap.Metadata {
+		msg.Metadata = append(msg.Metadata, r.ToProto())
+	}
+	return msg
+}
 
-	enc := gob.NewEncoder(conn)
-	if err := enc.Encode(&snap); err != nil {
-		return fmt.Errorf("failed to encode cluster snapshot: %w", err)
+// ClusterSnapshotFromProto converts a snapshot received over the bus.
+func ClusterSnapshotFromProto(msg *pb.ClusterSnapshot) ClusterSnapshot {
+	snap := ClusterSnapshot{
+		ClusterVersion: msg.GetClusterVersion(),
+		TotalNodes:     uint16(msg.GetTotalNodes()),
+		TotalSlots:     uint16(msg.GetTotalSlots()),
+		MasterNodeID:   msg.GetMasterNodeId(),
+	}
+	for _, n := range msg.GetNodes() {
+		snap.Nodes = append(snap.Nodes, NodeFromProto(n))
+	}
+	for _, r := range msg.GetMetadata() {
+		snap.Metadata = append(snap.Metadata, SlotRangeFromProto(r))
+	}
+	return snap
+}
+
+func (n Node) ToProto() *pb.Node {
+	return &pb.Node{
+		ServerId:      n.ServerID,
+		Addr:          n.Addr,
+		Status:        int32(n.Status),
+		Group:         n.Group,
+		ResourceScore: n.ResourceScore,
+	}
+}
+
+func NodeFromProto(msg *pb.Node) Node {
+	return Node{
+		ServerID:      msg.GetServerId(),
+		Addr:          msg.GetAddr(),
+		Status:        NodeStatus(msg.GetStatus()),
+		Group:         msg.GetGroup(),
+		ResourceScore: msg.GetResourceScore(),
+	}
+}
+
+func (r SlotRange) ToProto() *pb.SlotRange {
+	return &pb.SlotRange{
+		Start:           uint32(r.Start),
+		End:             uint32(r.End),
+		MasterId:        r.MasterID,
+		Nodes:           append([]string{}, r.Nodes...),
+		AsyncCrossGroup: r.AsyncCrossGroup,
+	}
+}
+
+func SlotRangeFromProto(msg *pb.SlotRange) SlotRange {
+	return SlotRange{
+		Start:           uint16(msg.GetStart()),
+		End:             uint16(msg.GetEnd()),
+		MasterID:        msg.GetMasterId(),
+		Nodes:           append([]string{}, msg.GetNodes()...),
+		AsyncCrossGroup: msg.GetAsyncCrossGroup(),
+	}
+}
+
+// PushClusterSnapshot sends the current cluster snapshot to the bus at busAddr.
+func (s *Server) PushClusterSnapshot(busAddr string) error {
+	snap := s.BuildClusterSnapshot()
+	if err := buspool.Call(busAddr, pb.BusCommand_SNAPSHOT, snap.ToProto(), nil, 15*time.Second); err != nil {
+		return fmt.Errorf("failed to send cluster snapshot: %w", err)
 	}
 	return nil
 }
+
+// BroadcastClusterSnapshot pushes the current cluster snapshot to every peer
+// except the ones in skip. Returns the number of peers that acknowledged it.
+func (s *Server) BroadcastClusterSnapshot(skip ...string) int {
+	skipped := make(map[string]bool, len(skip))
+	for _, id := range skip {
+		skipped[id] = true
+	}
+
+	successCount := 0
+	for _, p := range s.GetCommitPeers() {
+		if skipped[p.ServerID] {
+			continue
+		}
+
+		busAddr, err := utils.BumpPort(p.Addr, 10000)
+		if err != nil {
+			log.Printf("[ERROR]: Failed to derive bus address for peer %s: %v\n", p.ServerID, err)
+			continue
+		}
+		if err := s.PushClusterSnapshot(busAddr); err != nil {
+			log.Printf("[ERROR]: Peer %s did not acknowledge the snapshot: %v\n", p.ServerID, err)
+			continue
+		}
+		successCount++
+	}
+	return successCount
+}
@@ -7,11 +7,16 @@ func (s *Server) UpdateHeartbeat(peerId string, unreableNodes []string, group st
 	defer s.mu.Unlock()
 
 	//before updating, check if peerId exists in s.Nodes
-	if !s.HasNode(peerId) {
+	if _, ok := s.Nodes[peerId]; !ok {
 		return false // maybe in the future add some logic to handle this err
 	}
 
-	s.LastSeen[peerId] = time.Now()
+	now := time.Now()
+	if s.LastSeen == nil {
+		s.LastSeen = make(map[string]time.Time)
+	}
+	s.LastSeen[peerId] = now
 
+	s.recordPeerReportsLocked(peerId, unreableNodes, now)
 	return true
 }
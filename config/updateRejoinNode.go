@@ -12,6 +12,7 @@ func (s *Server) UpdateRejoiningNode(serverID, addr, group string, resourceScore
 		node.ResourceScore = resourceScore
 		node.Status = ALIVE
 		node.Group = group
+		s.syncGroupsLocked()
 		// Clear suspect messages for this node
 		delete(s.SuspectLeaderMsg, serverID)
 		log.Printf("[INFO]: Updated rejoining node %s - addr: %s, status: ALIVE\n", serverID, addr)
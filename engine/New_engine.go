@@ -4,24 +4,81 @@ import (
 	"errors"
 	"fmt"
 	"iris/gossip"
+	"iris/replication"
+	"iris/storage"
+	"iris/utils"
 	"log"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/pebble"
 )
 
 type Engine struct {
-	Db     *pebble.DB
+	Db     storage.Store
+	Dir    string // data directory, a temporary one for the memory backend
 	Gossip *gossip.Gossip
+	Async  *replication.AsyncReplicator // async stream to replicas in other groups
+	Stream *replication.BatchReplicator // batched stream to the synchronous replicas
+	GC     *RangeGC                     // deletes the ranges this node no longer holds
+	Repair *ValueRepair                 // rewrites the values that failed their checksum
+	Keys   *Keyring                     // seals the stored values, nil without encryption
+	Clock  HLC                          // stamps every write mastered by this node
+
+	// default staleness bound of follower reads, see read.go
+	MaxReadStaleness time.Duration
+
+	lww         lwwLocks
+	sessions    readSessions
+	durability  durability
+	compression compression
+	checksums   checksumStats
+	rotation    rotationState
 }
 
-func NewEngine(path string) (*Engine, error) {
+// OpenEngine opens the storage backend picked by storage_engine in the config, with the
+// keys of encryption_key_file.
+func OpenEngine(cfg *utils.Config) (*Engine, error) {
+	var keys *Keyring
+	if cfg.EncryptionKeyFile != "" {
+		var err error
+		if keys, err = LoadKeyring(cfg.EncryptionKeyFile); err != nil {
+			return nil, fmt.Errorf("loading the encryption keys: %w", err)
+		}
+	}
+
+	var e *Engine
+	var err error
+	switch cfg.StorageEngine {
+	case "", storage.KIND_PEBBLE:
+		e, err = NewEngine(cfg.RocksDBPath, PebbleOptions(cfg))
+	case storage.KIND_MEMORY:
+		e, err = NewMemoryEngine()
+	default:
+		return nil, fmt.Errorf("unknown storage_engine %q, use %s or %s", cfg.StorageEngine, storage.KIND_PEBBLE, storage.KIND_MEMORY)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.Keys = keys
+	return e, nil
+}
+
+// NewEngine opens the pebble DB at path with opts (see PebbleOptions), or the first
+// fallback path that isn't locked.
+func NewEngine(path string, opts *pebble.Options) (*Engine, error) {
+	if opts.Cache != nil {
+		// every open DB holds its own reference
+		defer opts.Cache.Unref()
+	}
+
 	maxRetries := 5
 	basePath := "irisdb"
 	if path != "" {
-		db, err := OpenRocksDB(path)
+		db, err := OpenRocksDB(path, opts)
 		if err == nil {
-			return &Engine{Db: db}, nil
+			return openedEngine(db, path), nil
 		}
 	}
 
@@ -34,17 +91,36 @@ func NewEngine(path string) (*Engine, error) {
 			dbPath = fmt.Sprintf("%s_%d", basePath, i)
 		}
 
-		db, err = OpenRocksDB(dbPath)
+		db, err = OpenRocksDB(dbPath, opts)
 		if err == nil {
-			return &Engine{Db: db}, nil
+			return openedEngine(db, dbPath), nil
 		}
 	}
 
 	return nil, fmt.Errorf("❌ All fallback Pebble DB paths are locked or failed")
 }
 
-func OpenRocksDB(path string) (*pebble.DB, error) {
-	db, err := pebble.Open(path, &pebble.Options{})
+// NewMemoryEngine keeps the data in memory. The node loses its keys and its metadata on
+// a restart and joins again as a new node. Range transfers still stage their SST files
+// on disk, in a temporary directory removed by Close.
+func NewMemoryEngine() (*Engine, error) {
+	dir, err := os.MkdirTemp("", "iris-memory-")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Using in-memory storage, transfer files in %s\n", dir)
+	return &Engine{Db: storage.NewMemory(), Dir: dir}, nil
+}
+
+func openedEngine(db *pebble.DB, dir string) *Engine {
+	e := &Engine{Db: storage.NewPebble(db), Dir: dir}
+	// range transfers don't survive a restart, the sender starts over
+	e.removeTransferFiles()
+	return e
+}
+
+func OpenRocksDB(path string, opts *pebble.Options) (*pebble.DB, error) {
+	db, err := pebble.Open(path, opts)
 	if err == nil {
 		log.Printf("Using Pebble DB at path: %s\n", path)
 		return db, nil
@@ -70,6 +146,9 @@ func OpenRocksDB(path string) (*pebble.DB, error) {
 func (e *Engine) Close() {
 	if e.Db != nil {
 		e.Db.Close()
+		if e.Db.Kind() == storage.KIND_MEMORY {
+			os.RemoveAll(e.Dir)
+		}
 	}
 }
 
@@ -79,18 +158,31 @@ func (e *Engine) Get(key string) (string, error) {
 	if e.Db == nil {
 		return "", errors.New("database not initialized")
 	}
-	val, closer, err := e.Db.Get([]byte(key))
+	val, closer, err := e.Db.Get(EncodeUserKey([]byte(key)))
 	if err != nil {
-		if errors.Is(err, pebble.ErrNotFound) {
+		if errors.Is(err, storage.ErrNotFound) {
 			return "", errors.New("key not found")
 		}
 		return "", err
 	}
 	defer closer.Close()
-	return string(val), nil
+	_, payload, err := e.openValue([]byte(key), val)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
 }
 
 func (e *Engine) HSet(hash, field, value string) error {
 	key := fmt.Sprintf("%s:%s", hash, field)
-	return e.Db.Set([]byte(key), []byte(value), pebble.Sync)
+	stored, err := e.encodeValue([]byte(key), 0, []byte(value))
+	if err != nil {
+		return err
+	}
+	batch := e.Db.NewBatch()
+	if err := batch.Set(EncodeUserKey([]byte(key)), stored); err != nil {
+		batch.Close()
+		return err
+	}
+	return e.commit(batch, "")
 }
@@ -0,0 +1,287 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"iris/config"
+	"iris/serializer/pb"
+	"iris/storage"
+	"iris/utils"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Value checksums.
+
+Every value carries the crc32c of its HLC timestamp and payload (the sealed body when the
+value is encrypted), in the envelope on disk (value.go) and in the messages that move it
+between nodes. The checksum is verified:
+
+  - when a stored value is read: GET, RGET, the last-writer-wins compare, range transfers
+  - when a value arrives over the bus: INS, REP, REP_BATCH, RGET
+  - when the SST files of a range transfer are ingested, every value of the files is checked
+
+A message or a transfer file that fails its checksum is refused, the sender retries or
+starts the transfer over. A stored value that fails it is repaired from a healthy copy: the
+repairer asks the other nodes holding the range with RGET and writes back the newest copy
+that verifies. The damaged copy is deleted only when every other holder of the range
+answered and none of them has the key, a holder that couldn't be asked may have missed the
+delete. Otherwise the key is left in place and counted as unrepaired. A GET repairs the key
+before answering, the other readers queue it.
+
+A repair is counted once its write commits, the damaged copies deleted are counted apart. A
+key rewritten or deleted by a client while it was repaired counts as neither. The counters
+are printed by the METRICS admin command.
+*/
+
+const REPAIR_QUEUE_SIZE = 1024
+
+var errNoHealthyCopy = errors.New("no healthy copy on the other nodes")
+
+// ValueChecksum is the crc32c of the timestamp (8 bytes, big endian) and the payload of a
+// value.
+func ValueChecksum(ts uint64, payload []byte) uint32 {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], ts)
+	return crc32.Update(crc32.Checksum(buf[:], castagnoli), castagnoli, payload)
+}
+
+// NewReplicateRequest returns the REP of a value, with its checksum.
+func NewReplicateRequest(key, payload []byte, ts uint64) *pb.ReplicateRequest {
+	sum := ValueChecksum(ts, payload)
+	return &pb.ReplicateRequest{Key: key, Value: payload, HlcTs: ts, Checksum: &sum}
+}
+
+type checksumStats struct {
+	stored     atomic.Uint64 // stored values that failed their checksum
+	received   atomic.Uint64 // values damaged on the bus or in a transfer file
+	repaired   atomic.Uint64
+	deleted    atomic.Uint64 // damaged copies of keys no other holder has
+	unrepaired atomic.Uint64
+}
+
+// ChecksumReport renders the checksum counters for METRICS.
+func (e *Engine) ChecksumReport() string {
+	c := &e.checksums
+	return fmt.Sprintf(
+		"Checksum Mismatches: %d stored, %d received | Repaired: %d | Deleted: %d | Unrepaired: %d\n",
+		c.stored.Load(), c.received.Load(), c.repaired.Load(), c.deleted.Load(), c.unrepaired.Load())
+}
+
+// corruptStored counts a stored value of key that failed its checksum.
+func (e *Engine) corruptStored(key []byte, during string) {
+	e.checksums.stored.Add(1)
+	log.Printf("[WARN]: stored value of %q failed its checksum (%s)\n", key, during)
+}
+
+// skipCorrupt counts a damaged stored value a scan leaves out and queues its repair.
+func (e *Engine) skipCorrupt(stored []byte, during string) {
+	_, key, _ := DecodeUserKey(stored)
+	e.corruptStored(key, during)
+	e.Repair.Queue(key)
+}
+
+// corruptReceived counts a value that arrived damaged.
+func (e *Engine) corruptReceived(key []byte, from string) error {
+	e.checksums.received.Add(1)
+	log.Printf("[WARN]: value of %q received in %s failed its checksum\n", key, from)
+	return fmt.Errorf("%w: value of %q in %s", ErrValueChecksum, key, from)
+}
+
+// VerifyReplicated checks the checksum of a REP, those of nodes before v5 carry none.
+func (e *Engine) VerifyReplicated(rep *pb.ReplicateRequest, from string) error {
+	if rep.Checksum != nil && *rep.Checksum != ValueChecksum(rep.HlcTs, rep.Value) {
+		return e.corruptReceived(rep.Key, from)
+	}
+	return nil
+}
+
+// VerifyInsert checks the checksum of an INS, computed with timestamp 0.
+func (e *Engine) VerifyInsert(req *pb.InsertRequest) error {
+	if req.Checksum != nil && *req.Checksum != ValueChecksum(0, req.Value) {
+		return e.corruptReceived(req.Key, "INS")
+	}
+	return nil
+}
+
+// ValueRepair rewrites the stored values that failed their checksum from the other copies.
+type ValueRepair struct {
+	e      *Engine
+	server *config.Server
+	queue  chan []byte
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func NewValueRepair(e *Engine, server *config.Server) *ValueRepair {
+	return &ValueRepair{
+		e:       e,
+		server:  server,
+		queue:   make(chan []byte, REPAIR_QUEUE_SIZE),
+		pending: make(map[string]bool),
+	}
+}
+
+// Run repairs the queued keys.
+func (r *ValueRepair) Run() {
+	for key := range r.queue {
+		if _, err := r.Repair(key); err != nil {
+			log.Printf("[WARN]: repair of %q failed: %v\n", key, err)
+		}
+		r.mu.Lock()
+		delete(r.pending, string(key))
+		r.mu.Unlock()
+	}
+}
+
+// Queue schedules the repair of key, a key already queued is skipped. The key is dropped
+// when the queue is full, the next read of the key queues it again.
+func (r *ValueRepair) Queue(key []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[string(key)] {
+		return
+	}
+	select {
+	case r.queue <- append([]byte{}, key...):
+		r.pending[string(key)] = true
+	default:
+		log.Printf("[WARN]: repair queue is full, %q will be repaired on its next read\n", key)
+	}
+}
+
+// Repair replaces the stored value of key with the newest healthy copy of the other nodes
+// holding its range and returns the payload now stored, errKeyNotFound if it was deleted.
+func (r *ValueRepair) Repair(key []byte) ([]byte, error) {
+	payload, outcome, err := r.repair(key)
+	switch outcome {
+	case REPAIR_WRITTEN:
+		r.e.checksums.repaired.Add(1)
+		log.Printf("[INFO]: repaired the value of %q\n", key)
+	case REPAIR_DELETED:
+		r.e.checksums.deleted.Add(1)
+		log.Printf("[INFO]: deleted the damaged value of %q, no other holder has the key\n", key)
+	case REPAIR_FAILED:
+		r.e.checksums.unrepaired.Add(1)
+	}
+	return payload, err
+}
+
+func (r *ValueRepair) repair(key []byte) ([]byte, repairOutcome, error) {
+	hash := utils.CalculateCRC16(key)
+	sr, ok := r.server.GetSlotRangeByIndex(r.server.FindNodeIdx(hash % r.server.N))
+	if !ok {
+		return nil, REPAIR_FAILED, errors.New("range not found")
+	}
+
+	var best *pb.RemoteGetResponse
+	holders, answered, missing := 0, 0, 0
+	asked := make(map[string]bool)
+	for _, id := range append([]string{sr.MasterID}, sr.Nodes...) {
+		if id == r.server.ServerID || asked[id] {
+			continue
+		}
+		asked[id] = true
+		holders++
+		resp, err := r.e.rget(r.server, id, key, -1)
+		if err != nil {
+			log.Printf("[WARN]: repair of %q: reading the copy of %s failed: %v\n", key, id, err)
+			continue
+		}
+		answered++
+		switch {
+		case !resp.Found:
+			missing++
+		case resp.Checksum == nil:
+			// a node before v5 can't prove its copy is intact
+		case *resp.Checksum != ValueChecksum(resp.HlcTs, resp.Value):
+			r.e.corruptReceived(key, "RGET from "+id)
+		case best == nil || newerWrite(resp.HlcTs, resp.Value, best.HlcTs, best.Value):
+			best = resp
+		}
+	}
+
+	switch {
+	case best != nil:
+		value, payload, err := r.e.replicatedValue(&pb.ReplicateRequest{
+			Key:         key,
+			Value:       best.Value,
+			HlcTs:       best.HlcTs,
+			Sealed:      best.Sealed,
+			Compression: best.Compression,
+		})
+		if err != nil {
+			return nil, REPAIR_FAILED, err
+		}
+		r.e.Clock.Update(best.HlcTs)
+		return r.e.replaceCorrupt(key, value, payload)
+	case holders > 0 && answered == holders && missing == holders:
+		return r.e.replaceCorrupt(key, nil, nil)
+	default:
+		return nil, REPAIR_FAILED, errNoHealthyCopy
+	}
+}
+
+// repairOutcome is what a repair did to the stored value.
+type repairOutcome int
+
+const (
+	REPAIR_FAILED     repairOutcome = iota
+	REPAIR_WRITTEN                  // the healthy copy replaced the damaged one
+	REPAIR_DELETED                  // no other holder has the key, the damaged copy is gone
+	REPAIR_SUPERSEDED               // a client rewrote or deleted the key meanwhile
+)
+
+// replaceCorrupt writes the repaired stored value of key and returns its payload, or
+// deletes the key when value is nil, unless the stored value was rewritten or deleted since
+// it was found damaged.
+func (e *Engine) replaceCorrupt(key []byte, value, payload []byte) ([]byte, repairOutcome, error) {
+	mu := e.lww.forKey(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	stored := EncodeUserKey(key)
+	current, closer, err := e.Db.Get(stored)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, REPAIR_SUPERSEDED, errKeyNotFound
+	case err != nil:
+		return nil, REPAIR_FAILED, err
+	}
+	_, currentPayload, decodeErr := e.openValue(key, current)
+	currentPayload = append([]byte{}, currentPayload...)
+	closer.Close()
+	if !errors.Is(decodeErr, ErrCorruptValue) {
+		if decodeErr != nil {
+			return nil, REPAIR_FAILED, decodeErr
+		}
+		return currentPayload, REPAIR_SUPERSEDED, nil
+	}
+
+	found := value != nil
+	batch := e.Db.NewBatch()
+	if found {
+		err = batch.Set(stored, value)
+	} else {
+		err = batch.Delete(stored)
+	}
+	if err != nil {
+		batch.Close()
+		return nil, REPAIR_FAILED, err
+	}
+	if err := e.commit(batch, ""); err != nil {
+		return nil, REPAIR_FAILED, err
+	}
+	if !found {
+		return nil, REPAIR_DELETED, errKeyNotFound
+	}
+	return payload, REPAIR_WRITTEN, nil
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"fmt"
+	"iris/config"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+Value compression.
+
+With compression in the config (snappy or zstd, none by default) the payloads of at least
+compression_min_size bytes (DEFAULT_COMPRESSION_MIN_SIZE) are stored compressed, when that
+makes them smaller. The codec is recorded in the envelope (value.go): compressed and
+uncompressed values coexist and every node reads every codec whatever its own setting, the
+setting can change at any time.
+
+Payloads are compressed before they are sealed (encryption.go), ciphertext doesn't compress.
+Replication, RGET and range transfers carry the values compressed as stored once every node
+announces CAP_COMPRESSED_VALUES, they are decompressed before being sent otherwise. A replica
+keeps the codec of the master.
+*/
+
+const DEFAULT_COMPRESSION_MIN_SIZE = 256
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+var codecNames = map[Encoding]string{CODEC_NONE: "none", CODEC_SNAPPY: "snappy", CODEC_ZSTD: "zstd"}
+
+type compression struct {
+	codec   Encoding
+	minSize int
+
+	compressed atomic.Uint64 // payloads stored compressed
+	saved      atomic.Uint64 // bytes saved by them
+}
+
+// ParseCodec returns the codec named by s, case insensitive, "" is none.
+func ParseCodec(s string) (Encoding, bool) {
+	if s == "" {
+		return CODEC_NONE, true
+	}
+	for codec, name := range codecNames {
+		if strings.EqualFold(s, name) {
+			return codec, true
+		}
+	}
+	return CODEC_NONE, false
+}
+
+// ConfigureCompression sets the codec of the payloads of at least minSize bytes. An
+// unknown codec turns compression off.
+func (e *Engine) ConfigureCompression(codec string, minSize int) {
+	parsed, ok := ParseCodec(codec)
+	if !ok {
+		log.Printf("[WARN]: unknown compression %q, using none\n", codec)
+	}
+	if minSize <= 0 {
+		minSize = DEFAULT_COMPRESSION_MIN_SIZE
+	}
+	e.compression.codec, e.compression.minSize = parsed, minSize
+	if parsed != CODEC_NONE {
+		log.Printf("[INFO]: value compression: %s, payloads from %d bytes\n", codecNames[parsed], minSize)
+	}
+}
+
+// compress returns the body and codec a payload is stored with.
+func (e *Engine) compress(payload []byte) ([]byte, Encoding) {
+	c := &e.compression
+	if c.codec == CODEC_NONE || len(payload) < c.minSize {
+		return payload, CODEC_NONE
+	}
+	var body []byte
+	switch c.codec {
+	case CODEC_SNAPPY:
+		body = snappy.Encode(nil, payload)
+	case CODEC_ZSTD:
+		body = zstdEncoder.EncodeAll(payload, nil)
+	}
+	if len(body) >= len(payload) {
+		return payload, CODEC_NONE
+	}
+	c.compressed.Add(1)
+	c.saved.Add(uint64(len(payload) - len(body)))
+	return body, c.codec
+}
+
+// decompress returns the payload of a body compressed with codec.
+func decompress(codec Encoding, body []byte) ([]byte, error) {
+	var payload []byte
+	var err error
+	switch codec {
+	case CODEC_NONE:
+		return body, nil
+	case CODEC_SNAPPY:
+		payload, err = snappy.Decode(nil, body)
+	case CODEC_ZSTD:
+		payload, err = zstdDecoder.DecodeAll(body, nil)
+	default:
+		return nil, fmt.Errorf("%w: unknown codec %d", ErrCorruptValue, codec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptValue, codecNames[codec], err)
+	}
+	return payload, nil
+}
+
+// decodePayload returns the payload of a stored body: opened when sealed, then decompressed.
+func (e *Engine) decodePayload(key []byte, ts uint64, body []byte, enc Encoding) ([]byte, error) {
+	if enc.Sealed() {
+		var err error
+		if body, err = e.openBody(key, ts, body); err != nil {
+			return nil, err
+		}
+	}
+	return decompress(enc.Codec(), body)
+}
+
+// wireEncoding returns the encoding of a value received in a REP or an RGET response.
+func wireEncoding(compression uint32, sealed bool) (Encoding, error) {
+	if compression > uint32(CODEC_MASK) {
+		return 0, fmt.Errorf("%w: unknown codec %d", ErrCorruptValue, compression)
+	}
+	enc := Encoding(compression)
+	if sealed {
+		enc |= ENCODING_SEALED
+	}
+	return enc, nil
+}
+
+// clusterReads tells whether every node reads the values encoded with enc.
+func clusterReads(server *config.Server, enc Encoding) bool {
+	return (!enc.Sealed() || server.ClusterSupports(config.CAP_SEALED_VALUES)) &&
+		(enc.Codec() == CODEC_NONE || server.ClusterSupports(config.CAP_COMPRESSED_VALUES))
+}
+
+// CompressionReport renders the compression counters for METRICS.
+func (e *Engine) CompressionReport() string {
+	c := &e.compression
+	if c.codec == CODEC_NONE {
+		return fmt.Sprintf("Compression: none | Compressed Writes: %d | Bytes Saved: %d\n", c.compressed.Load(), c.saved.Load())
+	}
+	return fmt.Sprintf("Compression: %s from %d bytes | Compressed Writes: %d | Bytes Saved: %d\n",
+		codecNames[c.codec], c.minSize, c.compressed.Load(), c.saved.Load())
+}
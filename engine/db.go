@@ -1,30 +1,20 @@
 package engine
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"iris/buspool"
 	"iris/config"
+	"iris/serializer/pb"
 	"iris/utils"
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/cockroachdb/pebble"
 )
 
-func (e *Engine) Set(key string, val string, conn net.Conn) {
-	err := e.Db.Set([]byte(key), []byte(val), pebble.Sync)
-	if err != nil {
-		errMsg := fmt.Sprintf("ERR write failed: %s\n", err.Error())
-		conn.Write([]byte(errMsg))
-
-	} else {
-		conn.Write([]byte("ACK REP\n"))
-	}
-}
-
 func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server) {
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 {
@@ -37,13 +27,45 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 		return
 	}
 
+	// the system keyspace is not addressable by clients
+	switch strings.ToUpper(parts[0]) {
+	case "SET", "GET", "DEL":
+		if len(parts) > 1 && IsSystemKey([]byte(parts[1])) {
+			conn.Write([]byte("ERR invalid key: reserved for the system keyspace\n"))
+			return
+		}
+	}
+
+	// on the minority side of a network split the partition policy decides what still runs
+	switch strings.ToUpper(parts[0]) {
+	case "SET", "DEL":
+		if !server.PartitionAllows(true) {
+			conn.Write([]byte("ERR write rejected: node is in a minority partition\n"))
+			return
+		}
+	case "GET", "KEYS":
+		if !server.PartitionAllows(false) {
+			conn.Write([]byte("ERR read rejected: node is in a minority partition\n"))
+			return
+		}
+	}
+
 	switch strings.ToUpper(parts[0]) {
 	case "SET":
 		{
-			if len(parts) != 3 {
-				conn.Write([]byte("ERR usage: SET KEY value\n"))
+			// SET KEY value [SYNC|GROUP|PERIODIC]
+			if len(parts) != 3 && len(parts) != 4 {
+				conn.Write([]byte("ERR usage: SET KEY value [SYNC|GROUP|PERIODIC]\n"))
 				return
 			}
+			var mode DurabilityMode
+			if len(parts) == 4 {
+				var ok bool
+				if mode, ok = ParseDurability(parts[3]); !ok {
+					conn.Write([]byte("ERR usage: SET KEY value [SYNC|GROUP|PERIODIC]\n"))
+					return
+				}
+			}
 			hash := utils.CalculateCRC16([]byte(parts[1]))
 			master_slot := server.FindNodeIdx(hash % server.N)
 			sr, ok := server.GetSlotRangeByIndex(master_slot)
@@ -56,64 +78,45 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 
 			//check if the server is the master node for this slot(hash)
 			if server.Metadata[master_slot].MasterID == server.ServerID {
-				err := e.Db.Set([]byte(parts[1]), []byte(parts[2]), pebble.Sync)
+				value, err := e.PutStamped([]byte(parts[1]), []byte(parts[2]), mode)
 				if err != nil {
 					errMsg := fmt.Sprintf("ERR write failed: %s\n", err.Error())
 					conn.Write([]byte(errMsg))
-				} else {
-					conn.Write([]byte("OK\n"))
+					return
 				}
+				conn.Write([]byte("OK\n"))
 
 				// @leoantony72 send the data to the replica nodes through the bus port
-				replica_server := server.Metadata[master_slot].Nodes
-				fmt.Println("Replication Nodes:", replica_server)
-				success := false
-				replication_cmd := fmt.Sprintf("REP %s %s\n", parts[1], parts[2])
-				for _, id := range replica_server {
-					success = server.SendReplicaCMD(replication_cmd, id)
-					if !success {
-						fmt.Println("rep failed")
-						break
-					}
+				// replicas keep the value with the highest timestamp
+				rep, err := e.ReplicationOf(server, []byte(parts[1]), value)
+				if err != nil {
+					log.Printf("[ERROR]: replication of %q failed: %v\n", parts[1], err)
+					return
 				}
+				e.ReplicateWrite(server, sr, rep)
 			} else {
 				// @leoantony72 forward the req to the master node
 				// (masternode = server.Metadata[master_slot].Nodes[0])
 				fmt.Println("KEY FORWARD")
 				busAddr, _ := utils.BumpPort(server.Nodes[g].Addr, 10000)
 				fmt.Printf("SET FORWARD: ADDR: %s\n", busAddr)
-				Sconn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
-				if err != nil {
-					//increase the suspect count to 1 for 
-					errMsg := fmt.Sprintf("ERR write failed: %s\n", "Coudn't connect to Master Server")
-					conn.Write([]byte(errMsg))
-					return
-				}
-
-				//MESSAGE FORMAT: INS KEY VALUE
-				//RESPONSE FORMAT: ACK KEY
-				msg := fmt.Sprintf("INS %s %s\n", parts[1], parts[2])
-				_, err = Sconn.Write([]byte(msg))
-				if err != nil {
-					errMsg := fmt.Sprintf("ERR write failed: %s\n", "Coudn't forward to Master Server")
+				sum := ValueChecksum(0, []byte(parts[2]))
+				ins := &pb.InsertRequest{Key: []byte(parts[1]), Value: []byte(parts[2]), Durability: string(mode), Checksum: &sum}
+				err := buspool.Call(busAddr, pb.BusCommand_INS, ins, nil, 10*time.Second)
+				var remoteErr *buspool.RemoteError
+				switch {
+				case errors.As(err, &remoteErr):
+					fmt.Printf("res: %s\n", remoteErr.Message)
+					errMsg := fmt.Sprintf("ERR write failed: %s\n", remoteErr.Message)
 					conn.Write([]byte(errMsg))
-					Sconn.Close()
 					return
-				}
-
-				expectedResponse := "ACK INS"
-
-				reader := bufio.NewReader(Sconn)
-				resp, _ := reader.ReadString('\n')
-				resp = strings.TrimSpace(resp)
-				Sconn.Close()
-
-				if resp != expectedResponse {
-					fmt.Printf("res: %s, %s\n", resp, expectedResponse)
-					errMsg := fmt.Sprintf("ERR write failed: %s\n", "Err Response From Master Server")
+				case err != nil:
+					// let gossip probe the master, it gets marked SUSPECT if nobody can reach it
+					e.Gossip.Suspect(g)
+					errMsg := fmt.Sprintf("ERR write failed: %s\n", "Coudn't connect to Master Server")
 					conn.Write([]byte(errMsg))
 					return
-				} else {
+				default:
 					conn.Write([]byte("OK\n"))
 				}
 
@@ -122,13 +125,21 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 		}
 	case "GET":
 		{
-			if len(parts) != 2 {
-				conn.Write([]byte("ERR usage: GET KEY \n"))
+			// GET KEY [READONLY]
+			if len(parts) != 2 && !(len(parts) == 3 && strings.ToUpper(parts[2]) == "READONLY") {
+				conn.Write([]byte("ERR usage: GET KEY [READONLY]\n"))
 				return
 			}
-			data, closer, err := e.Db.Get([]byte(parts[1]))
+			mode, followerRead := e.readModeOf(conn)
+			maxStaleness := mode.maxStaleness
+			if len(parts) == 3 && !followerRead {
+				followerRead = true
+				maxStaleness = e.maxReadStaleness()
+			}
+
+			value, err := e.readKey(server, parts[1], followerRead, maxStaleness)
 			if err != nil {
-				if err == pebble.ErrNotFound {
+				if errors.Is(err, errKeyNotFound) {
 					conn.Write([]byte("NOTFOUND\n"))
 				} else {
 					errMsg := fmt.Sprintf("ERR read failed: %s\n", err.Error())
@@ -136,17 +147,55 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 				}
 				return
 			}
-			defer closer.Close()
-			conn.Write(append(data, '\n'))
+			conn.Write(append(value, '\n'))
+		}
+	case "READONLY":
+		{
+			// READONLY [MAX_STALENESS_MS]: serve the GETs of this connection from replicas
+			if len(parts) > 2 {
+				conn.Write([]byte("ERR usage: READONLY [MAX_STALENESS_MS]\n"))
+				return
+			}
+			maxStaleness := e.maxReadStaleness()
+			if len(parts) == 2 {
+				ms, err := strconv.ParseInt(parts[1], 10, 64)
+				if err != nil || ms < 0 {
+					conn.Write([]byte("ERR invalid MAX_STALENESS_MS\n"))
+					return
+				}
+				maxStaleness = time.Duration(ms) * time.Millisecond
+			}
+			e.SetReadOnly(conn, maxStaleness)
+			conn.Write([]byte("OK\n"))
+		}
+	case "READWRITE":
+		{
+			e.SetReadWrite(conn)
+			conn.Write([]byte("OK\n"))
 		}
 	case "DEL":
 		{
-			if len(parts) != 2 {
-				conn.Write([]byte("ERR usage: DEL KEY \n"))
+			// DEL KEY [SYNC|GROUP|PERIODIC]
+			if len(parts) != 2 && len(parts) != 3 {
+				conn.Write([]byte("ERR usage: DEL KEY [SYNC|GROUP|PERIODIC]\n"))
 				return
 			}
+			var mode DurabilityMode
+			if len(parts) == 3 {
+				var ok bool
+				if mode, ok = ParseDurability(parts[2]); !ok {
+					conn.Write([]byte("ERR usage: DEL KEY [SYNC|GROUP|PERIODIC]\n"))
+					return
+				}
+			}
 
-			err := e.Db.Delete([]byte(parts[1]), pebble.Sync)
+			batch := e.Db.NewBatch()
+			err := batch.Delete(EncodeUserKey([]byte(parts[1])))
+			if err == nil {
+				err = e.commit(batch, mode)
+			} else {
+				batch.Close()
+			}
 			if err != nil {
 				errMsg := fmt.Sprintf("ERR delete failed: %s\n", err.Error())
 				conn.Write([]byte(errMsg))
@@ -159,7 +208,7 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 		{
 			// return all keys in the database
 			// var keys []string
-			iter, err := e.Db.NewIter(&pebble.IterOptions{})
+			iter, err := e.Db.NewIter(UserKeyspace())
 			if err != nil {
 				errMsg := fmt.Sprintf("ERR iterator failed: %s\n", err.Error())
 				conn.Write([]byte(errMsg))
@@ -167,10 +216,11 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 			}
 			for iter.First(); iter.Valid(); iter.Next() {
 				// keys = append(keys, string(iter.Key()))
-				if string(iter.Key()) == "config:server:metadata" {
+				_, key, ok := DecodeUserKey(iter.Key())
+				if !ok {
 					continue
 				}
-				msg := iter.Key()
+				msg := append([]byte{}, key...)
 				msg = append(msg, '\n')
 				conn.Write(msg)
 			}
@@ -197,33 +247,18 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 
 			busAddr, _ := utils.BumpPort(masterNode.Addr, 10000)
 			fmt.Printf("MASTER ADDR: %s\n", busAddr)
-			Sconn, err := net.DialTimeout("tcp", busAddr, 10*time.Second)
-			if err != nil {
-				errMsg := fmt.Sprintf("ERR SHUTDOWN failed: %s\n", "Coudn't connect to Master Server")
+			leave := &pb.LeaveRequest{ServerId: server.ServerID}
+			err := buspool.Call(busAddr, pb.BusCommand_LEAVE, leave, nil, 30*time.Second)
+			var remoteErr *buspool.RemoteError
+			if errors.As(err, &remoteErr) {
+				fmt.Printf("res: %s\n", remoteErr.Message)
+				errMsg := fmt.Sprintf("ERR SHUTDOWN failed: %s\n", "Err Response From Master Server")
 				conn.Write([]byte(errMsg))
 				return
 			}
-
-			// format: LEAVE SID
-			msg := fmt.Sprintf("LEAVE %s\n", server.ServerID)
-			_, err = Sconn.Write([]byte(msg))
 			if err != nil {
-				errMsg := fmt.Sprintf("ERR write failed: %s\n", "Coudn't forward to Master Server")
-				conn.Write([]byte(errMsg))
-				Sconn.Close()
-				return
-			}
-
-			// expected Response
-			expectedResponse := "SHUTDOWN SUCCESS"
-			reader := bufio.NewReader(Sconn)
-			resp, _ := reader.ReadString('\n')
-			resp = strings.TrimSpace(resp)
-			Sconn.Close()
-
-			if resp != expectedResponse {
-				fmt.Printf("res: %s, %s\n", resp, expectedResponse)
-				errMsg := fmt.Sprintf("ERR SHUTDOWN failed: %s\n", "Err Response From Master Server")
+				e.Gossip.Suspect(masterNodeID)
+				errMsg := fmt.Sprintf("ERR SHUTDOWN failed: %s\n", "Coudn't connect to Master Server")
 				conn.Write([]byte(errMsg))
 				return
 			}
@@ -248,8 +283,8 @@ func (e *Engine) HandleCommand(cmd string, conn net.Conn, server *config.Server)
 
 					e.Db.Flush()
 					//delete all the config data from pebble database
-					e.Db.Delete([]byte("config:server:metadata"), pebble.Sync)
-					e.Db.Close()
+					e.DeleteSystem(config.METADATA_KEY)
+					e.Close()
 					log.Println("[INFO] IrisDb exited cleanly")
 					os.Exit(0)
 				}()
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"iris/storage"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Durability of the client writes.
+
+	sync      every write is fsynced before it is acknowledged
+	group     concurrent writes are collected into one batch, fsynced once for all of them
+	periodic  writes are acknowledged once in the WAL, the WAL is fsynced every SyncInterval;
+	          a crash loses at most the writes of the last interval
+
+The mode of the node comes from the config (durability, durability_sync_interval_ms) and a
+client picks another one for a single write with SET KEY value [SYNC|GROUP|PERIODIC] and
+DEL KEY [SYNC|GROUP|PERIODIC]. A SET forwarded to the master carries the choice of the client.
+
+Replicated batches are a single commit already, group behaves as sync for them. Internal
+records (metadata, storage format) are always synced.
+*/
+
+type DurabilityMode string
+
+const (
+	DURABILITY_SYNC     DurabilityMode = "sync"
+	DURABILITY_GROUP    DurabilityMode = "group"
+	DURABILITY_PERIODIC DurabilityMode = "periodic"
+
+	DEFAULT_DURABILITY        = DURABILITY_SYNC
+	DEFAULT_SYNC_INTERVAL     = 100 * time.Millisecond
+	GROUP_COMMIT_MAX_WRITES   = 1024
+	GROUP_COMMIT_QUEUE_LENGTH = 4096
+)
+
+// ParseDurability returns the mode named by s, case insensitive.
+func ParseDurability(s string) (DurabilityMode, bool) {
+	mode := DurabilityMode(strings.ToLower(s))
+	switch mode {
+	case DURABILITY_SYNC, DURABILITY_GROUP, DURABILITY_PERIODIC:
+		return mode, true
+	}
+	return "", false
+}
+
+type groupWrite struct {
+	batch storage.Batch
+	done  chan error
+}
+
+type durability struct {
+	mode         DurabilityMode
+	syncInterval time.Duration
+	group        chan groupWrite
+	unsynced     atomic.Bool // a periodic write reached the WAL since the last fsync
+}
+
+// ConfigureDurability sets the default mode and starts the group committer and the
+// periodic WAL sync. An unknown mode falls back to DEFAULT_DURABILITY.
+func (e *Engine) ConfigureDurability(mode string, syncInterval time.Duration) {
+	parsed, ok := ParseDurability(mode)
+	if !ok {
+		if mode != "" {
+			log.Printf("[WARN]: unknown durability %q, using %s\n", mode, DEFAULT_DURABILITY)
+		}
+		parsed = DEFAULT_DURABILITY
+	}
+	if syncInterval <= 0 {
+		syncInterval = DEFAULT_SYNC_INTERVAL
+	}
+
+	e.durability = durability{
+		mode:         parsed,
+		syncInterval: syncInterval,
+		group:        make(chan groupWrite, GROUP_COMMIT_QUEUE_LENGTH),
+	}
+	go e.groupCommitter()
+	go e.periodicSync()
+	log.Printf("[INFO]: write durability: %s (WAL sync interval of periodic writes: %s)\n", parsed, syncInterval)
+}
+
+// Durability returns the default mode of the node.
+func (e *Engine) Durability() DurabilityMode {
+	if e.durability.mode == "" {
+		return DEFAULT_DURABILITY
+	}
+	return e.durability.mode
+}
+
+// commit writes a batch of client writes with the given mode, "" is the default of the node.
+// The batch is closed.
+func (e *Engine) commit(batch storage.Batch, mode DurabilityMode) error {
+	if mode == "" {
+		mode = e.Durability()
+	}
+	if mode == DURABILITY_GROUP && e.durability.group == nil {
+		// ConfigureDurability wasn't called, no committer
+		mode = DURABILITY_SYNC
+	}
+
+	switch mode {
+	case DURABILITY_GROUP:
+		done := make(chan error, 1)
+		e.durability.group <- groupWrite{batch: batch, done: done}
+		err := <-done
+		batch.Close()
+		return err
+	case DURABILITY_PERIODIC:
+		defer batch.Close()
+		if err := batch.Commit(false); err != nil {
+			return err
+		}
+		e.durability.unsynced.Store(true)
+		return nil
+	default:
+		defer batch.Close()
+		return batch.Commit(true)
+	}
+}
+
+// syncReplicatedBatch tells whether a replicated batch is synced in the default mode.
+func (e *Engine) syncReplicatedBatch() bool {
+	if e.Durability() == DURABILITY_PERIODIC {
+		e.durability.unsynced.Store(true)
+		return false
+	}
+	return true
+}
+
+// groupCommitter commits the queued writes together, every write waiting while a commit
+// is in progress joins the next one.
+func (e *Engine) groupCommitter() {
+	for first := range e.durability.group {
+		writes := []groupWrite{first}
+	collect:
+		for len(writes) < GROUP_COMMIT_MAX_WRITES {
+			select {
+			case w := <-e.durability.group:
+				writes = append(writes, w)
+			default:
+				break collect
+			}
+		}
+
+		group := e.Db.NewBatch()
+		var err error
+		for _, w := range writes {
+			if err = group.Apply(w.batch); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = group.Commit(true)
+		}
+		group.Close()
+		for _, w := range writes {
+			w.done <- err
+		}
+	}
+}
+
+// periodicSync fsyncs the WAL every sync interval while periodic writes are pending.
+func (e *Engine) periodicSync() {
+	for {
+		time.Sleep(e.durability.syncInterval)
+		if !e.durability.unsynced.Swap(false) {
+			continue
+		}
+		if err := e.Db.SyncWAL(); err != nil {
+			log.Printf("[WARN]: periodic WAL sync failed: %v\n", err)
+			e.durability.unsynced.Store(true)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"iris/config"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+Garbage collection of the ranges this node no longer holds.
+
+A node keeps the keys of a range after a split at join, a failover or the removal of one
+of its replicas. Every GC_INTERVAL the collector compares the slots of the local keys with
+the cluster metadata: a slot the node is neither master nor replica of is unowned. Once a
+slot has stayed unowned for the grace period it is deleted with a range tombstone and the
+span is compacted, so the disk space is given back and the old copy can't come back if
+the node is assigned the range again.
+
+The grace period covers metadata that is still moving (a transfer back to this node, a
+snapshot not applied yet). The collector does nothing while the node has no slot metadata
+or sits on the minority side of a partition, its view of the ownership may be outdated.
+
+In dry-run mode the collector only logs what it would delete. The GC admin command on the
+bus port prints the same report on demand.
+*/
+
+const (
+	GC_INTERVAL             = 1 * time.Minute
+	DEFAULT_GC_GRACE_PERIOD = 10 * time.Minute
+)
+
+var errGCUnsafe = errors.New("ownership unknown")
+
+// GCSpan is a run of consecutive unowned slots holding local keys.
+type GCSpan struct {
+	Start, End   uint16
+	Keys         int
+	Bytes        uint64    // estimated disk usage
+	UnownedSince time.Time // of the most recently released slot of the span
+	Eligible     bool      // past the grace period
+}
+
+type RangeGC struct {
+	e           *Engine
+	server      *config.Server
+	GracePeriod time.Duration
+	DryRun      bool
+
+	mu           sync.Mutex
+	unownedSince [STORAGE_SLOTS]time.Time // zero while the slot is owned
+	collected    int                      // slots deleted since startup
+}
+
+func NewRangeGC(e *Engine, server *config.Server, gracePeriod time.Duration, dryRun bool) *RangeGC {
+	if gracePeriod <= 0 {
+		gracePeriod = DEFAULT_GC_GRACE_PERIOD
+	}
+	return &RangeGC{e: e, server: server, GracePeriod: gracePeriod, DryRun: dryRun}
+}
+
+// Run collects the unowned ranges every GC_INTERVAL.
+func (g *RangeGC) Run() {
+	for {
+		time.Sleep(GC_INTERVAL)
+
+		spans, err := g.Collect()
+		if err != nil {
+			if !errors.Is(err, errGCUnsafe) {
+				log.Printf("[WARN]: range GC failed: %v\n", err)
+			}
+			continue
+		}
+		for _, sp := range spans {
+			if sp.Eligible && g.DryRun {
+				log.Printf("[INFO]: range GC (dry run): would delete slots %d-%d, %d keys, ~%d bytes\n", sp.Start, sp.End, sp.Keys, sp.Bytes)
+			}
+		}
+	}
+}
+
+// ownedSlots marks the slots this node is master or replica of.
+func (g *RangeGC) ownedSlots() (*[STORAGE_SLOTS]bool, error) {
+	if g.server.InMinorityPartition() {
+		return nil, fmt.Errorf("%w: node is in a minority partition", errGCUnsafe)
+	}
+	ranges := g.server.GetServerMetadata()
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no slot metadata", errGCUnsafe)
+	}
+
+	var owned [STORAGE_SLOTS]bool
+	for _, sr := range ranges {
+		if sr.MasterID != g.server.ServerID && !slices.Contains(sr.Nodes, g.server.ServerID) {
+			continue
+		}
+		for slot := range owned {
+			if SlotInRange(uint16(slot), sr.Start, sr.End) {
+				owned[slot] = true
+			}
+		}
+	}
+	return &owned, nil
+}
+
+// Plan updates the unowned-since times and returns the unowned spans holding keys,
+// nothing is deleted.
+func (g *RangeGC) Plan() ([]GCSpan, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.planLocked(time.Now())
+}
+
+func (g *RangeGC) planLocked(now time.Time) ([]GCSpan, error) {
+	owned, err := g.ownedSlots()
+	if err != nil {
+		return nil, err
+	}
+
+	for slot := range g.unownedSince {
+		switch {
+		case owned[slot]:
+			g.unownedSince[slot] = time.Time{}
+		case g.unownedSince[slot].IsZero():
+			g.unownedSince[slot] = now
+		}
+	}
+
+	// runs of unowned slots, split where eligibility changes
+	var spans []GCSpan
+	for slot := 0; slot < STORAGE_SLOTS; {
+		if owned[slot] {
+			slot++
+			continue
+		}
+		eligible := now.Sub(g.unownedSince[slot]) >= g.GracePeriod
+		sp := GCSpan{Start: uint16(slot), UnownedSince: g.unownedSince[slot], Eligible: eligible}
+		for slot < STORAGE_SLOTS && !owned[slot] && (now.Sub(g.unownedSince[slot]) >= g.GracePeriod) == eligible {
+			if g.unownedSince[slot].After(sp.UnownedSince) {
+				sp.UnownedSince = g.unownedSince[slot]
+			}
+			sp.End = uint16(slot)
+			slot++
+		}
+
+		if err := g.measure(&sp); err != nil {
+			return nil, err
+		}
+		if sp.Keys > 0 {
+			spans = append(spans, sp)
+		}
+	}
+	return spans, nil
+}
+
+func (g *RangeGC) measure(sp *GCSpan) error {
+	span := SlotSpan(sp.Start, sp.End)
+	iter, err := g.e.Db.NewIter(span)
+	if err != nil {
+		return err
+	}
+	for ok := iter.First(); ok; ok = iter.Next() {
+		sp.Keys++
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if sp.Keys > 0 {
+		sp.Bytes, err = g.e.Db.EstimateDiskUsage(span)
+	}
+	return err
+}
+
+// Collect deletes the spans past the grace period, unless in dry-run mode. Returns the plan
+// it acted on.
+func (g *RangeGC) Collect() ([]GCSpan, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	spans, err := g.planLocked(time.Now())
+	if err != nil || g.DryRun {
+		return spans, err
+	}
+	for _, sp := range spans {
+		if !sp.Eligible {
+			continue
+		}
+		span := SlotSpan(sp.Start, sp.End)
+		if err := g.e.Db.DeleteRange(span, true); err != nil {
+			return spans, fmt.Errorf("deleting slots %d-%d: %w", sp.Start, sp.End, err)
+		}
+		g.collected += int(sp.End-sp.Start) + 1
+		log.Printf("[INFO]: range GC deleted slots %d-%d (unowned since %s): %d keys, ~%d bytes\n",
+			sp.Start, sp.End, sp.UnownedSince.Format(time.RFC3339), sp.Keys, sp.Bytes)
+
+		// the tombstone alone doesn't give the space back
+		if err := g.e.Db.Compact(span); err != nil {
+			log.Printf("[WARN]: range GC: compacting slots %d-%d failed: %v\n", sp.Start, sp.End, err)
+		}
+	}
+	return spans, nil
+}
+
+// Collected returns the number of slots deleted since startup.
+func (g *RangeGC) Collected() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.collected
+}
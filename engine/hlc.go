@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+HLC is a hybrid logical clock. A timestamp packs the wall clock in milliseconds into the
+upper 48 bits and a logical counter into the lower 16 bits, so timestamps compare as plain
+integers. The clock never goes backwards and always moves past every timestamp it has seen
+from other nodes, so a write stamped after receiving a replicated value orders after it
+even if the wall clocks of the two nodes disagree.
+*/
+const HLC_LOGICAL_BITS = 16
+
+type HLC struct {
+	mu   sync.Mutex
+	last uint64
+}
+
+// Now returns a timestamp greater than any timestamp returned or observed before.
+func (c *HLC) Now() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	physical := uint64(time.Now().UnixMilli()) << HLC_LOGICAL_BITS
+	if physical > c.last {
+		c.last = physical
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// Update moves the clock past a timestamp received from another node.
+func (c *HLC) Update(remote uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if remote > c.last {
+		c.last = remote
+	}
+}
+
+// HLCWallTime returns the wall clock part of an HLC timestamp.
+func HLCWallTime(ts uint64) time.Time {
+	return time.UnixMilli(int64(ts >> HLC_LOGICAL_BITS))
+}
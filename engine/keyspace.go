@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"iris/storage"
+	"iris/utils"
+)
+
+/*
+The keyspace is split in two:
+
+	0x00 | "sys/" | name                      system keyspace, the internal state of the node
+	0x01 | slot (2 bytes, big endian) | key   user keyspace, the keys of the clients
+
+Client commands and the bus commands carrying user keys (INS, REP, REP_BATCH, RGET)
+reject keys starting with 0x00, so nobody can read or overwrite the internal state
+through them. Scans of user data (KEYS, transfers to other nodes) iterate UserKeyspace,
+code that needs the internal state as well has to ask for SystemKeyspace explicitly.
+
+User keys are stored under the hash slot they belong to, a slot range is a contiguous
+span of the keyspace (SlotSpan) and can be scanned or deleted without touching the
+other ranges. The engine only converts at its edges: callers pass and get back the key
+of the client, EncodeUserKey / DecodeUserKey are the only places that know the layout.
+
+Data written before the slot prefix (raw client keys at the top level) has to be
+converted with MigrateKeyEncoding, see STORAGE_FORMAT_KEY.
+*/
+const (
+	SYSTEM_KEY_MARKER    byte = 0x00
+	SYSTEM_KEY_PREFIX         = "\x00sys/"
+	USER_KEY_MARKER      byte = 0x01
+	USER_KEY_HEADER_SIZE      = 1 + 2
+
+	// same as config.Server.N, the slot of a key never depends on the cluster layout
+	STORAGE_SLOTS = 16384
+)
+
+var ErrReservedKey = errors.New("key is in the reserved system keyspace")
+
+// SystemKey returns the stored key of an internal record.
+func SystemKey(name string) []byte {
+	return append([]byte(SYSTEM_KEY_PREFIX), name...)
+}
+
+func IsSystemKey(key []byte) bool {
+	return len(key) > 0 && key[0] == SYSTEM_KEY_MARKER
+}
+
+// CheckUserKey rejects the keys a client or a peer may not address.
+func CheckUserKey(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("empty key")
+	}
+	if IsSystemKey(key) {
+		return ErrReservedKey
+	}
+	return nil
+}
+
+// SlotOf returns the hash slot of a client key.
+func SlotOf(key []byte) uint16 {
+	return utils.CalculateCRC16(key) % STORAGE_SLOTS
+}
+
+// EncodeUserKey returns the stored key of a client key.
+func EncodeUserKey(key []byte) []byte {
+	buf := make([]byte, USER_KEY_HEADER_SIZE+len(key))
+	buf[0] = USER_KEY_MARKER
+	binary.BigEndian.PutUint16(buf[1:USER_KEY_HEADER_SIZE], SlotOf(key))
+	copy(buf[USER_KEY_HEADER_SIZE:], key)
+	return buf
+}
+
+// DecodeUserKey returns the slot and client key of a stored key. The key aliases stored.
+func DecodeUserKey(stored []byte) (uint16, []byte, bool) {
+	if len(stored) < USER_KEY_HEADER_SIZE || stored[0] != USER_KEY_MARKER {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint16(stored[1:USER_KEY_HEADER_SIZE]), stored[USER_KEY_HEADER_SIZE:], true
+}
+
+// slotBoundary returns the first stored key of a slot, slot STORAGE_SLOTS is the end
+// of the user keyspace.
+func slotBoundary(slot uint32) []byte {
+	if slot >= STORAGE_SLOTS {
+		return []byte{USER_KEY_MARKER + 1}
+	}
+	buf := make([]byte, USER_KEY_HEADER_SIZE)
+	buf[0] = USER_KEY_MARKER
+	binary.BigEndian.PutUint16(buf[1:], uint16(slot))
+	return buf
+}
+
+// UserKeyspace bounds an iterator to the keys of the clients.
+func UserKeyspace() storage.Span {
+	return storage.Span{Lower: []byte{USER_KEY_MARKER}, Upper: []byte{USER_KEY_MARKER + 1}}
+}
+
+// SlotSpan bounds an iterator to the keys of the slots start-end, both included.
+func SlotSpan(start, end uint16) storage.Span {
+	return storage.Span{Lower: slotBoundary(uint32(start)), Upper: slotBoundary(uint32(end) + 1)}
+}
+
+// SlotInRange tells whether slot is in start-end, a range may wrap around.
+func SlotInRange(slot, start, end uint16) bool {
+	if start <= end {
+		return slot >= start && slot <= end
+	}
+	return slot >= start || slot <= end
+}
+
+// slotSpans returns the spans of the slots start-end in key order. A range that wraps
+// around (start > end) is made of two spans.
+func slotSpans(start, end uint16) []storage.Span {
+	if start > end {
+		return []storage.Span{SlotSpan(0, end), SlotSpan(start, STORAGE_SLOTS-1)}
+	}
+	return []storage.Span{SlotSpan(start, end)}
+}
+
+// ScanSlots calls fn with the client key and the stored value of every key in the
+// slots start-end. key and value are only valid during the call.
+func (e *Engine) ScanSlots(start, end uint16, fn func(key, value []byte) error) error {
+	return scanSlots(e.Db, start, end, func(stored, value []byte) error {
+		_, key, _ := DecodeUserKey(stored)
+		return fn(key, value)
+	})
+}
+
+// scanSlots calls fn with the stored key and value of every key in the slots start-end,
+// in key order.
+func scanSlots(r storage.Reader, start, end uint16, fn func(stored, value []byte) error) error {
+	for _, span := range slotSpans(start, end) {
+		iter, err := r.NewIter(span)
+		if err != nil {
+			return err
+		}
+		for ok := iter.First(); ok; ok = iter.Next() {
+			if err := fn(iter.Key(), iter.Value()); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SystemKeyspace bounds an iterator to the internal records.
+func SystemKeyspace() storage.Span {
+	return storage.Span{Lower: []byte{SYSTEM_KEY_MARKER}, Upper: []byte{SYSTEM_KEY_MARKER + 1}}
+}
+
+// GetSystem reads an internal record, the value is only valid until the closer is closed.
+func (e *Engine) GetSystem(name string) ([]byte, io.Closer, error) {
+	return e.Db.Get(SystemKey(name))
+}
+
+func (e *Engine) PutSystem(name string, value []byte) error {
+	return e.Db.Set(SystemKey(name), value, true)
+}
+
+func (e *Engine) DeleteSystem(name string) error {
+	return e.Db.Delete(SystemKey(name), true)
+}
@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"iris/buspool"
+	"iris/config"
+	"iris/serializer/pb"
+	"iris/storage"
+	"iris/utils"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+Reads.
+
+By default GET reads the value stored on this node. A connection switched to READONLY (or a
+single GET KEY READONLY) gets follower reads bounded by a maximum staleness: the value is read
+from this node if it holds a fresh enough copy of the range, otherwise from a replica in the
+same group as this node, and only then from the master, forwarded over the bus with RGET. A
+replica serves the read only when it is no more than the maximum staleness behind the master:
+
+  - replicas written synchronously use the last offset marker of their stream they applied
+    every write before, one missing a batch or cut off from the master turns stale
+    (replication/batch.go)
+  - async cross-group replicas use the last offset marker applied from the master, none while
+    writes were dropped from their stream and they weren't resynced (replication/async.go)
+
+On the minority side of a partition the master can't be reached, a node holding a copy of
+the range serves it as is, the others refuse the read.
+
+Bus messages:
+
+	RGET RemoteGetRequest{key, max_staleness_ms} -> RemoteGetResponse{found, stale, value, hlc_ts, checksum, sealed, compression}
+
+A local value that fails its checksum is repaired from the other copies before a GET
+answers, see checksum.go.
+*/
+
+const (
+	DEFAULT_MAX_READ_STALENESS = 5 * time.Second
+	REMOTE_READ_TIMEOUT        = 3 * time.Second
+)
+
+var (
+	errStaleReplica = errors.New("replica is too stale")
+	errKeyNotFound  = errors.New("key not found")
+	errRangeNotHeld = errors.New("master unreachable from a minority partition and range not held here")
+)
+
+// readMode is the READONLY state of one client connection.
+type readMode struct {
+	maxStaleness time.Duration
+}
+
+type readSessions struct {
+	conns sync.Map // net.Conn -> readMode
+}
+
+// SetReadOnly switches conn to follower reads with the given staleness bound.
+func (e *Engine) SetReadOnly(conn net.Conn, maxStaleness time.Duration) {
+	e.sessions.conns.Store(conn, readMode{maxStaleness: maxStaleness})
+}
+
+// SetReadWrite switches conn back to reading from the master.
+func (e *Engine) SetReadWrite(conn net.Conn) {
+	e.sessions.conns.Delete(conn)
+}
+
+// CloseSession forgets the read mode of a closed client connection.
+func (e *Engine) CloseSession(conn net.Conn) {
+	e.sessions.conns.Delete(conn)
+}
+
+func (e *Engine) readModeOf(conn net.Conn) (readMode, bool) {
+	mode, ok := e.sessions.conns.Load(conn)
+	if !ok {
+		return readMode{}, false
+	}
+	return mode.(readMode), true
+}
+
+func (e *Engine) maxReadStaleness() time.Duration {
+	if e.MaxReadStaleness > 0 {
+		return e.MaxReadStaleness
+	}
+	return DEFAULT_MAX_READ_STALENESS
+}
+
+// ReadLocal returns the value of key stored on this node.
+func (e *Engine) ReadLocal(key []byte) ([]byte, error) {
+	raw, err := e.readStored(key)
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := e.openValue(key, raw)
+	return payload, err
+}
+
+// readStored returns a copy of the stored value of key after checking its checksum. A
+// value failing it is counted, ErrValueChecksum is returned.
+func (e *Engine) readStored(key []byte) ([]byte, error) {
+	data, closer, err := e.Db.Get(EncodeUserKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, errKeyNotFound
+		}
+		return nil, err
+	}
+	defer closer.Close()
+
+	if _, _, _, err := DecodeValue(data); err != nil {
+		if errors.Is(err, ErrValueChecksum) {
+			e.corruptStored(key, "read")
+		}
+		return nil, err
+	}
+	return append([]byte{}, data...), nil
+}
+
+// readLocalRepaired is ReadLocal for the GETs of clients, a damaged value is repaired first.
+func (e *Engine) readLocalRepaired(key []byte) ([]byte, error) {
+	value, err := e.ReadLocal(key)
+	if errors.Is(err, ErrValueChecksum) && e.Repair != nil {
+		return e.Repair.Repair(key)
+	}
+	return value, err
+}
+
+// ReplicaFresh tells whether the copy of sr on this node is at most maxStaleness behind its master.
+func (e *Engine) ReplicaFresh(server *config.Server, sr *config.SlotRange, maxStaleness time.Duration) bool {
+	if sr.MasterID == server.ServerID {
+		return true
+	}
+	syncReplicas, asyncReplicas := server.SplitReplicasByGroup(sr)
+	for _, id := range syncReplicas {
+		if id != server.ServerID {
+			continue
+		}
+		if e.Stream == nil {
+			return false
+		}
+		staleness, ok := e.Stream.Staleness(sr.MasterID)
+		return ok && staleness <= maxStaleness
+	}
+	for _, id := range asyncReplicas {
+		if id != server.ServerID {
+			continue
+		}
+		if e.Async == nil {
+			return false
+		}
+		staleness, ok := e.Async.Staleness(sr.MasterID)
+		return ok && staleness <= maxStaleness
+	}
+	// this node doesn't hold the range
+	return false
+}
+
+// readKey routes a GET, see the comment at the top of the file.
+func (e *Engine) readKey(server *config.Server, key string, followerRead bool, maxStaleness time.Duration) ([]byte, error) {
+	if !followerRead {
+		return e.readLocalRepaired([]byte(key))
+	}
+
+	hash := utils.CalculateCRC16([]byte(key))
+	sr, ok := server.GetSlotRangeByIndex(server.FindNodeIdx(hash % server.N))
+	if !ok {
+		return nil, errors.New("range not found")
+	}
+
+	if sr.MasterID == server.ServerID || e.ReplicaFresh(server, sr, maxStaleness) {
+		return e.readLocalRepaired([]byte(key))
+	}
+	if server.InMinorityPartition() {
+		if !slices.Contains(sr.Nodes, server.ServerID) {
+			return nil, errRangeNotHeld
+		}
+		return e.readLocalRepaired([]byte(key))
+	}
+
+	// a replica from before follower reads would ignore the staleness bound
+	replicas := sr.Nodes
+	if !server.ClusterSupports(config.CAP_FOLLOWER_READS) {
+		replicas = nil
+	}
+	localGroup := server.GetServerGroup()
+	for _, id := range replicas {
+		if id == server.ServerID {
+			continue
+		}
+		node, ok := server.GetConnectedNodeData(id)
+		if !ok || node.Group != localGroup {
+			continue
+		}
+		value, err := e.remoteGet(server, id, key, maxStaleness)
+		if err == nil || errors.Is(err, errKeyNotFound) {
+			return value, err
+		}
+	}
+
+	value, err := e.remoteGet(server, sr.MasterID, key, -1)
+	if err != nil && !errors.Is(err, errKeyNotFound) {
+		e.Gossip.Suspect(sr.MasterID)
+	}
+	return value, err
+}
+
+// remoteGet reads key from nodeID over the bus. A negative maxStaleness reads
+// unconditionally (used for the master).
+func (e *Engine) remoteGet(server *config.Server, nodeID string, key string, maxStaleness time.Duration) ([]byte, error) {
+	resp, err := e.rget(server, nodeID, []byte(key), maxStaleness)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.Stale:
+		return nil, errStaleReplica
+	case !resp.Found:
+		return nil, errKeyNotFound
+	case resp.Checksum != nil && *resp.Checksum != ValueChecksum(resp.HlcTs, resp.Value):
+		return nil, e.corruptReceived([]byte(key), "RGET from "+nodeID)
+	}
+	enc, err := wireEncoding(resp.Compression, resp.Sealed)
+	if err != nil {
+		return nil, err
+	}
+	return e.decodePayload([]byte(key), resp.HlcTs, resp.Value, enc)
+}
+
+func (e *Engine) rget(server *config.Server, nodeID string, key []byte, maxStaleness time.Duration) (*pb.RemoteGetResponse, error) {
+	node, ok := server.GetConnectedNodeData(nodeID)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", nodeID)
+	}
+	busAddr, err := utils.BumpPort(node.Addr, 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &pb.RemoteGetRequest{Key: key, MaxStalenessMs: -1}
+	if maxStaleness >= 0 {
+		req.MaxStalenessMs = maxStaleness.Milliseconds()
+	}
+	var resp pb.RemoteGetResponse
+	if err := buspool.Call(busAddr, pb.BusCommand_RGET, req, &resp, REMOTE_READ_TIMEOUT); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// HandleRemoteGet answers an RGET from another node.
+func (e *Engine) HandleRemoteGet(server *config.Server, req *pb.RemoteGetRequest) (*pb.RemoteGetResponse, error) {
+	if err := CheckUserKey(req.Key); err != nil {
+		return nil, err
+	}
+	if req.MaxStalenessMs >= 0 {
+		hash := utils.CalculateCRC16(req.Key)
+		sr, ok := server.GetSlotRangeByIndex(server.FindNodeIdx(hash % server.N))
+		if !ok || !e.ReplicaFresh(server, sr, time.Duration(req.MaxStalenessMs)*time.Millisecond) {
+			return &pb.RemoteGetResponse{Stale: true}, nil
+		}
+	}
+
+	raw, err := e.readStored(req.Key)
+	switch {
+	case errors.Is(err, errKeyNotFound):
+		return &pb.RemoteGetResponse{}, nil
+	case errors.Is(err, ErrValueChecksum):
+		// the caller may be repairing its own copy, don't wait on ours
+		e.Repair.Queue(req.Key)
+		return nil, fmt.Errorf("read failed: %w", err)
+	case err != nil:
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	rep, err := e.ReplicationOf(server, req.Key, raw)
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	return &pb.RemoteGetResponse{Found: true, Value: rep.Value, HlcTs: rep.HlcTs, Checksum: rep.Checksum, Sealed: rep.Sealed, Compression: rep.Compression}, nil
+}
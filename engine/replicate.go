@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"iris/config"
+	"iris/replication"
+	"iris/serializer/pb"
+	"log"
+	"slices"
+	"time"
+)
+
+// REPLICATE_TIMEOUT bounds a single REP sent while the cluster doesn't support REP_BATCH.
+const REPLICATE_TIMEOUT = 10 * time.Second
+
+// ReplicateWrite sends a write to the replicas of sr. Replicas in the
+// group of the master are written synchronously, with AsyncCrossGroup set on the range
+// the ones in other groups are handed to the async replication stream.
+// The synchronous writes go through the batched stream of every replica in parallel,
+// or one REP at a time while some node of the cluster doesn't support REP_BATCH.
+// Returns false if a synchronous replica didn't acknowledge the command.
+func (e *Engine) ReplicateWrite(server *config.Server, sr *config.SlotRange, rep *pb.ReplicateRequest) bool {
+	syncReplicas, asyncReplicas := server.SplitReplicasByGroup(sr)
+	for _, id := range asyncReplicas {
+		if e.Async != nil {
+			e.Async.Enqueue(id, pb.BusCommand_REP, rep)
+		} else if !server.SendReplicaCMD(pb.BusCommand_REP, rep, id) {
+			e.Gossip.Suspect(id)
+		}
+	}
+
+	if e.Stream != nil && server.ClusterSupports(config.CAP_BATCH_REPLICATION) {
+		pending := make([]*replication.Pending, len(syncReplicas))
+		for i, id := range syncReplicas {
+			pending[i] = e.Stream.Enqueue(id, rep)
+		}
+		ok := true
+		for i, p := range pending {
+			if err := p.Wait(); err != nil {
+				log.Printf("[WARN]: replicating key %q to %s failed: %v\n", rep.Key, syncReplicas[i], err)
+				e.Gossip.Suspect(syncReplicas[i])
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	for _, id := range syncReplicas {
+		if err := server.CallReplica(id, pb.BusCommand_REP, rep, nil, REPLICATE_TIMEOUT); err != nil {
+			log.Printf("[WARN]: replicating key %q to %s failed: %v\n", rep.Key, id, err)
+			e.Gossip.Suspect(id)
+			return false
+		}
+	}
+	return true
+}
+
+// ResyncAsyncReplica sends nodeID again, as SST files, every range mastered here that it
+// replicates asynchronously. Used once writes to it were dropped from the async stream.
+func (e *Engine) ResyncAsyncReplica(server *config.Server, nodeID string) error {
+	return e.resyncReplica(server, nodeID, true)
+}
+
+// ResyncSyncReplica sends nodeID again every range mastered here that it replicates
+// synchronously. Used once a replication batch to it was given up.
+func (e *Engine) ResyncSyncReplica(server *config.Server, nodeID string) error {
+	return e.resyncReplica(server, nodeID, false)
+}
+
+func (e *Engine) resyncReplica(server *config.Server, nodeID string, async bool) error {
+	if !server.ClusterSupports(config.CAP_SST_TRANSFER) {
+		return errors.New("not every node supports SST transfers")
+	}
+	for _, sr := range server.GetServerMetadata() {
+		if sr.MasterID != server.ServerID {
+			continue
+		}
+		syncReplicas, asyncReplicas := server.SplitReplicasByGroup(&sr)
+		replicas := syncReplicas
+		if async {
+			replicas = asyncReplicas
+		}
+		if !slices.Contains(replicas, nodeID) {
+			continue
+		}
+		keys, replayed, err := e.TransferRange(server, nodeID, sr.Start, sr.End)
+		if err != nil {
+			return fmt.Errorf("slots %d-%d: %w", sr.Start, sr.End, err)
+		}
+		log.Printf("[INFO]: resynced slots %d-%d on %s: %d keys, %d replayed\n", sr.Start, sr.End, nodeID, keys, replayed)
+	}
+	return nil
+}
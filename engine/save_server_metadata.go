@@ -1,18 +1,73 @@
 package engine
 
 import (
-	"bytes"
-	"encoding/gob"
+	"errors"
 	"iris/config"
-
-	"github.com/cockroachdb/pebble"
+	"iris/storage"
+	"log"
 )
 
+// SaveServerMetadata persists the identity and cluster view of the node in the system
+// keyspace, see config/metadata_store.go.
 func (e *Engine) SaveServerMetadata(s *config.Server) error {
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+	data, err := config.EncodeNodeMetadata(s.PersistedMetadata())
+	if err != nil {
 		return err
 	}
+	return e.PutSystem(config.METADATA_KEY, data)
+}
+
+// LoadServerMetadata reads the persisted metadata, migrated to the current version.
+// Returns config.ErrNoMetadata when the node never saved any, and the version the
+// record was stored with.
+func (e *Engine) LoadServerMetadata() (*config.Server, uint32, error) {
+	if err := e.moveLegacyMetadata(); err != nil {
+		return nil, 0, err
+	}
+
+	raw, closer, err := e.GetSystem(config.METADATA_KEY)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, 0, config.ErrNoMetadata
+		}
+		return nil, 0, err
+	}
+	defer closer.Close()
 
-	return e.Db.Set([]byte("config:server:metadata"), buf.Bytes(), pebble.Sync)
+	md, version, err := config.DecodeNodeMetadata(raw)
+	if err != nil {
+		return nil, version, err
+	}
+	return config.ServerFromMetadata(md), version, nil
+}
+
+// moveLegacyMetadata moves the metadata saved under the user key LEGACY_METADATA_KEY
+// into the system keyspace, in a single batch.
+func (e *Engine) moveLegacyMetadata() error {
+	raw, closer, err := e.Db.Get([]byte(config.LEGACY_METADATA_KEY))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data := append([]byte{}, raw...)
+	closer.Close()
+
+	batch := e.Db.NewBatch()
+	defer batch.Close()
+	if _, closer, err := e.GetSystem(config.METADATA_KEY); err == nil {
+		// already moved, the user key is a leftover
+		closer.Close()
+	} else if err := batch.Set(SystemKey(config.METADATA_KEY), data); err != nil {
+		return err
+	}
+	if err := batch.Delete([]byte(config.LEGACY_METADATA_KEY)); err != nil {
+		return err
+	}
+	if err := batch.Commit(true); err != nil {
+		return err
+	}
+	log.Printf("[INFO]: moved node metadata from user key %q to the system keyspace\n", config.LEGACY_METADATA_KEY)
+	return nil
 }
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iris/config"
+	"iris/storage"
+	"log"
+)
+
+/*
+On-disk layout of the user keys, recorded in the system keyspace under STORAGE_FORMAT_KEY:
+
+	1: raw client keys at the top level of the keyspace (no record)
+	2: slot-prefixed keys, see keyspace.go
+
+A node refuses to start on data in an older layout, the operator converts it offline
+with `iris -migrate_storage`, which runs MigrateKeyEncoding and exits.
+*/
+
+const (
+	STORAGE_FORMAT_KEY            = "storage/format"
+	STORAGE_FORMAT_VERSION uint32 = 2
+	MIGRATION_BATCH_SIZE          = 1024
+)
+
+var ErrLegacyKeyEncoding = errors.New("data directory uses the key encoding from before slot prefixes, stop the node and run it once with -migrate_storage")
+
+// legacyKeyspace bounds an iterator to the raw client keys of format 1. Clients use a
+// text protocol, their keys never start with the 0x00 or 0x01 markers.
+func legacyKeyspace() storage.Span {
+	return storage.Span{Lower: []byte{USER_KEY_MARKER + 1}}
+}
+
+func (e *Engine) storageFormat() (uint32, bool, error) {
+	raw, closer, err := e.GetSystem(STORAGE_FORMAT_KEY)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer closer.Close()
+	if len(raw) != 4 {
+		return 0, false, fmt.Errorf("invalid storage format record (%d bytes)", len(raw))
+	}
+	return binary.BigEndian.Uint32(raw), true, nil
+}
+
+func (e *Engine) setStorageFormat(version uint32) error {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, version)
+	return e.PutSystem(STORAGE_FORMAT_KEY, buf)
+}
+
+// hasLegacyKeys tells whether a client key is still stored in format 1. The metadata
+// under LEGACY_METADATA_KEY is moved on its own when it is loaded.
+func (e *Engine) hasLegacyKeys() (bool, error) {
+	iter, err := e.Db.NewIter(legacyKeyspace())
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if string(iter.Key()) != config.LEGACY_METADATA_KEY {
+			return true, nil
+		}
+	}
+	return false, iter.Error()
+}
+
+// CheckStorageFormat makes sure the data directory uses the current key layout. An empty
+// directory is stamped with it, one holding keys in the old layout is refused with
+// ErrLegacyKeyEncoding.
+func (e *Engine) CheckStorageFormat() error {
+	version, ok, err := e.storageFormat()
+	if err != nil {
+		return err
+	}
+	if ok {
+		if version > STORAGE_FORMAT_VERSION {
+			return fmt.Errorf("storage format %d was written by a newer release, this one reads up to %d", version, STORAGE_FORMAT_VERSION)
+		}
+		if version == STORAGE_FORMAT_VERSION {
+			return nil
+		}
+	}
+
+	legacy, err := e.hasLegacyKeys()
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return ErrLegacyKeyEncoding
+	}
+	return e.setStorageFormat(STORAGE_FORMAT_VERSION)
+}
+
+// MigrateKeyEncoding rewrites every client key stored in format 1 under its slot prefix,
+// MIGRATION_BATCH_SIZE keys per batch, and records the current format. The node must not
+// be serving. An interrupted run can be started again, it continues with the keys left.
+// Returns the number of keys moved.
+func (e *Engine) MigrateKeyEncoding() (int, error) {
+	if err := e.moveLegacyMetadata(); err != nil {
+		return 0, err
+	}
+
+	iter, err := e.Db.NewIter(legacyKeyspace())
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	moved := 0
+	batch := e.Db.NewBatch()
+	commit := func() error {
+		if batch.Empty() {
+			return nil
+		}
+		if err := batch.Commit(true); err != nil {
+			return err
+		}
+		batch.Close()
+		batch = e.Db.NewBatch()
+		log.Printf("[INFO]: migrated %d keys to the slot-prefixed encoding\n", moved)
+		return nil
+	}
+	defer func() { batch.Close() }()
+
+	for ok := iter.First(); ok; ok = iter.Next() {
+		key := iter.Key()
+		if err := batch.Set(EncodeUserKey(key), iter.Value()); err != nil {
+			return moved, err
+		}
+		if err := batch.Delete(key); err != nil {
+			return moved, err
+		}
+		moved++
+		if moved%MIGRATION_BATCH_SIZE == 0 {
+			if err := commit(); err != nil {
+				return moved, err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return moved, err
+	}
+	if err := commit(); err != nil {
+		return moved, err
+	}
+	return moved, e.setStorageFormat(STORAGE_FORMAT_VERSION)
+}
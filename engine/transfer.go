@@ -0,0 +1,470 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iris/buspool"
+	"iris/config"
+	"iris/serializer/pb"
+	"iris/storage"
+	"iris/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/google/uuid"
+)
+
+/*
+Bulk range transfers.
+
+A new replica of a range gets the data of the range as SST files instead of one REP per key:
+
+ 1. the sender takes a snapshot of the storage and writes the keys of the slots into SST files of
+    at most SST_TRANSFER_FILE_SIZE, the keys of a range are contiguous (see keyspace.go)
+ 2. every file is streamed in SST_TRANSFER_CHUNK_SIZE pieces, each with its crc32c:
+
+	SST_CHUNK SstChunk{transfer_id, file, offset, data, checksum}
+
+ 3. the target checks the size and crc32c of every file and ingests them all at once:
+
+	SST_INGEST SstIngest{transfer_id, start, end, files} -> SstIngestAck{bytes}
+
+ 4. the sender replays the keys written since the snapshot with REP_BATCH
+
+The files carry the values as stored, sealed (encryption.go) and compressed (compression.go),
+a value is decoded first when not every node reads its encoding. The target seals again in
+the background the values of the files not sealed with its active key.
+
+Ingested keys replace the stored ones without the last-writer-wins check. A write that reached
+the target during the transfer may be hidden by an older value of the snapshot, step 4 writes it
+again: every key whose live value differs from the snapshot is replayed, last-writer-wins. A key
+of the snapshot deleted since is deleted on the target, unless it was written there after the
+value of the snapshot.
+
+Transfers in progress live in TRANSFER_DIR of the data directory, it is emptied on startup.
+*/
+
+const (
+	TRANSFER_DIR            = "transfers"
+	SST_TRANSFER_FILE_SIZE  = 64 * 1024 * 1024
+	SST_TRANSFER_CHUNK_SIZE = 4 * 1024 * 1024
+	SST_TRANSFER_TIMEOUT    = 30 * time.Second
+	SST_INGEST_TIMEOUT      = 5 * time.Minute
+)
+
+var (
+	ErrTransferChecksum = errors.New("range transfer checksum mismatch")
+	errTransferGap      = errors.New("range transfer chunk out of order")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// transferSSTFormat is readable by every pebble format version, the target may run an older one.
+var transferSSTFormat = pebble.FormatMostCompatible.MaxTableFormat()
+
+// receiving serializes the SST_CHUNK and SST_INGEST handlers.
+var receiving sync.Mutex
+
+func (e *Engine) transferDir() string {
+	return filepath.Join(e.Dir, TRANSFER_DIR)
+}
+
+func (e *Engine) removeTransferFiles() {
+	if e.Dir == "" {
+		return
+	}
+	if err := os.RemoveAll(e.transferDir()); err != nil {
+		log.Printf("[WARN]: failed to remove old range transfer files: %v\n", err)
+	}
+}
+
+// TransferRange sends the keys of the slots start-end to nodeID as SST files. Returns the
+// number of keys sent in the files and replayed afterwards.
+func (e *Engine) TransferRange(server *config.Server, nodeID string, start, end uint16) (int, int, error) {
+	node, ok := server.GetConnectedNodeData(nodeID)
+	if !ok {
+		return 0, 0, fmt.Errorf("node %s not found", nodeID)
+	}
+	busAddr, err := utils.BumpPort(node.Addr, 10000)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	snap := e.Db.NewSnapshot()
+	defer snap.Close()
+
+	transferID := uuid.NewString()
+	dir := filepath.Join(e.transferDir(), "out-"+transferID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	paths, keys, err := e.writeRangeSSTs(server, snap, dir, start, end)
+	if err != nil {
+		return 0, 0, fmt.Errorf("building SST files: %w", err)
+	}
+
+	if len(paths) > 0 {
+		ingest := &pb.SstIngest{TransferId: transferID, Start: uint32(start), End: uint32(end)}
+		for i, path := range paths {
+			file, err := sendSST(busAddr, transferID, uint32(i), path)
+			if err != nil {
+				return 0, 0, fmt.Errorf("sending %s: %w", filepath.Base(path), err)
+			}
+			ingest.Files = append(ingest.Files, file)
+		}
+		var ack pb.SstIngestAck
+		if err := buspool.Call(busAddr, pb.BusCommand_SST_INGEST, ingest, &ack, SST_INGEST_TIMEOUT); err != nil {
+			return 0, 0, fmt.Errorf("ingest on %s: %w", nodeID, err)
+		}
+	}
+
+	replayed, err := e.replaySince(snap, server, busAddr, start, end)
+	if err != nil {
+		return keys, 0, fmt.Errorf("replaying writes after the snapshot: %w", err)
+	}
+	return keys, replayed, nil
+}
+
+// writeRangeSSTs writes the keys of the slots start-end into SST files in dir. A value failing
+// its checksum is left out and queued for repair, the target gets it once repaired.
+func (e *Engine) writeRangeSSTs(server *config.Server, r storage.Reader, dir string, start, end uint16) ([]string, int, error) {
+	var (
+		paths  []string
+		writer *sstable.Writer
+		keys   int
+	)
+	closeWriter := func() error {
+		if writer == nil {
+			return nil
+		}
+		err := writer.Close()
+		writer = nil
+		return err
+	}
+
+	err := scanSlots(r, start, end, func(stored, value []byte) error {
+		ts, body, enc, err := DecodeValue(value)
+		if errors.Is(err, ErrValueChecksum) {
+			e.skipCorrupt(stored, "range transfer")
+			return nil
+		}
+		if err == nil && !clusterReads(server, enc) {
+			_, key, _ := DecodeUserKey(stored)
+			payload, err := e.decodePayload(key, ts, body, enc)
+			if err != nil {
+				return fmt.Errorf("%q: %w", key, err)
+			}
+			value = EncodeValue(ts, payload)
+		}
+		if writer != nil && writer.EstimatedSize() >= SST_TRANSFER_FILE_SIZE {
+			if err := closeWriter(); err != nil {
+				return err
+			}
+		}
+		if writer == nil {
+			path := filepath.Join(dir, fmt.Sprintf("%06d.sst", len(paths)))
+			f, err := vfs.Default.Create(path)
+			if err != nil {
+				return err
+			}
+			writer = sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{TableFormat: transferSSTFormat})
+			paths = append(paths, path)
+		}
+		keys++
+		return writer.Set(stored, value)
+	})
+	if err != nil {
+		closeWriter()
+		return nil, 0, err
+	}
+	return paths, keys, closeWriter()
+}
+
+// sendSST streams one file in chunks and returns its size and checksum.
+func sendSST(busAddr, transferID string, index uint32, path string) (*pb.SstFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file := &pb.SstFile{File: index}
+	buf := make([]byte, SST_TRANSFER_CHUNK_SIZE)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			chunk := &pb.SstChunk{
+				TransferId: transferID,
+				File:       index,
+				Offset:     file.Size,
+				Data:       buf[:n],
+				Checksum:   crc32.Checksum(buf[:n], castagnoli),
+			}
+			if err := buspool.Call(busAddr, pb.BusCommand_SST_CHUNK, chunk, nil, SST_TRANSFER_TIMEOUT); err != nil {
+				return nil, err
+			}
+			file.Checksum = crc32.Update(file.Checksum, castagnoli, buf[:n])
+			file.Size += uint64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return file, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// replaySince sends every key of the slots whose live value differs from the snapshot, and
+// a delete for every key of the snapshot no longer stored.
+func (e *Engine) replaySince(snap storage.Snapshot, server *config.Server, busAddr string, start, end uint16) (int, error) {
+	var (
+		entries  []*pb.ReplicateRequest
+		size     int
+		replayed int
+		seq      uint64 = 1
+	)
+	flush := func() error {
+		if len(entries) == 0 {
+			return nil
+		}
+		batch := &pb.ReplicateBatch{MasterId: server.ServerID, FirstSeq: seq, Entries: entries}
+		var ack pb.ReplicateBatchAck
+		if err := buspool.Call(busAddr, pb.BusCommand_REP_BATCH, batch, &ack, SST_TRANSFER_TIMEOUT); err != nil {
+			return err
+		}
+		seq += uint64(len(entries))
+		replayed += len(entries)
+		entries, size = nil, 0
+		return nil
+	}
+
+	err := scanSlots(e.Db, start, end, func(stored, value []byte) error {
+		old, closer, err := snap.Get(stored)
+		switch {
+		case err == nil:
+			same := bytes.Equal(old, value)
+			closer.Close()
+			if same {
+				return nil
+			}
+		case !errors.Is(err, storage.ErrNotFound):
+			return err
+		}
+
+		_, key, _ := DecodeUserKey(stored)
+		rep, err := e.ReplicationOf(server, key, value)
+		if errors.Is(err, ErrValueChecksum) {
+			e.skipCorrupt(stored, "range transfer")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%q: %w", key, err)
+		}
+		entries = append(entries, rep)
+		size += len(rep.Key) + len(rep.Value)
+		if size >= SST_TRANSFER_CHUNK_SIZE {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return replayed, err
+	}
+	if !server.ClusterSupports(config.CAP_REPLICATED_DELETES) {
+		log.Printf("[WARN]: not every node applies replicated deletes, keys of slots %d-%d deleted during the transfer stay on the target\n", start, end)
+		return replayed, flush()
+	}
+
+	// the keys of the snapshot deleted since
+	err = scanSlots(snap, start, end, func(stored, value []byte) error {
+		_, closer, err := e.Db.Get(stored)
+		if err == nil {
+			closer.Close()
+			return nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		ts, _, _, err := DecodeValue(value)
+		if err != nil {
+			// left out of the files
+			return nil
+		}
+		_, key, _ := DecodeUserKey(stored)
+		rep := NewReplicateRequest(append([]byte{}, key...), nil, ts)
+		rep.Deleted = true
+		entries = append(entries, rep)
+		size += len(rep.Key)
+		if size >= SST_TRANSFER_CHUNK_SIZE {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return replayed, err
+	}
+	return replayed, flush()
+}
+
+// incomingDir returns the directory of a transfer received from another node.
+func (e *Engine) incomingDir(transferID string) (string, error) {
+	if _, err := uuid.Parse(transferID); err != nil {
+		return "", fmt.Errorf("invalid transfer ID %q", transferID)
+	}
+	return filepath.Join(e.transferDir(), "in-"+transferID), nil
+}
+
+// ReceiveSSTChunk appends a chunk to the file it belongs to.
+func (e *Engine) ReceiveSSTChunk(req *pb.SstChunk) error {
+	if crc32.Checksum(req.Data, castagnoli) != req.Checksum {
+		return fmt.Errorf("%w: chunk at %d of file %d", ErrTransferChecksum, req.Offset, req.File)
+	}
+	dir, err := e.incomingDir(req.TransferId)
+	if err != nil {
+		return err
+	}
+
+	receiving.Lock()
+	defer receiving.Unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%06d.sst", req.File)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if uint64(info.Size()) != req.Offset {
+		return fmt.Errorf("%w: file %d has %d bytes, chunk starts at %d", errTransferGap, req.File, info.Size(), req.Offset)
+	}
+	if _, err := f.Write(req.Data); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// IngestTransfer checks the files of a transfer against the sizes and checksums of the sender
+// and ingests them. The files are removed either way, a failed transfer is started over.
+func (e *Engine) IngestTransfer(req *pb.SstIngest) (*pb.SstIngestAck, error) {
+	dir, err := e.incomingDir(req.TransferId)
+	if err != nil {
+		return nil, err
+	}
+
+	receiving.Lock()
+	defer receiving.Unlock()
+	defer os.RemoveAll(dir)
+
+	paths := make([]string, 0, len(req.Files))
+	total := uint64(0)
+	reseal := false
+	for _, file := range req.Files {
+		path := filepath.Join(dir, fmt.Sprintf("%06d.sst", file.File))
+		size, sum, err := checksumFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if size != file.Size || sum != file.Checksum {
+			return nil, fmt.Errorf("%w: file %d has %d bytes (crc32c %08x), sender wrote %d (crc32c %08x)",
+				ErrTransferChecksum, file.File, size, sum, file.Size, file.Checksum)
+		}
+		// ingestion skips the checks of the bus handlers, a file may only hold keys of the range
+		// and values that match their checksum
+		unsealed, err := e.checkSSTKeys(path, uint16(req.Start), uint16(req.End))
+		if err != nil {
+			if errors.Is(err, ErrValueChecksum) {
+				e.checksums.received.Add(1)
+			}
+			return nil, fmt.Errorf("file %d: %w", file.File, err)
+		}
+		reseal = reseal || unsealed
+		paths = append(paths, path)
+		total += size
+	}
+
+	if err := e.Db.Ingest(paths); err != nil {
+		return nil, fmt.Errorf("ingest failed: %w", err)
+	}
+	log.Printf("[INFO]: ingested %d SST files (%d bytes) of slots %d-%d\n", len(paths), total, req.Start, req.End)
+	if reseal {
+		e.StartRotation()
+	}
+	return &pb.SstIngestAck{Bytes: total}, nil
+}
+
+// checkSSTKeys makes sure every key of an SST file is a user key of the slots start-end and
+// every value decodes and opens with the keys of this node. Returns whether a value isn't
+// sealed with the active key.
+func (e *Engine) checkSSTKeys(path string, start, end uint16) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	r, err := sstable.NewReader(readable, sstable.ReaderOptions{})
+	if err != nil {
+		readable.Close()
+		return false, err
+	}
+	defer r.Close()
+
+	iter, err := r.NewIter(nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+	unsealed := false
+	for k, lv := iter.First(); k != nil; k, lv = iter.Next() {
+		slot, key, ok := DecodeUserKey(k.UserKey)
+		if !ok || !SlotInRange(slot, start, end) {
+			return false, fmt.Errorf("key %q is outside slots %d-%d", k.UserKey, start, end)
+		}
+		value, _, err := lv.Value(nil)
+		if err != nil {
+			return false, err
+		}
+		if _, _, err := e.openValue(key, value); err != nil {
+			return false, fmt.Errorf("value of %q: %w", key, err)
+		}
+		unsealed = unsealed || (e.Keys != nil && e.needsSealing(value))
+	}
+	return unsealed, iter.Error()
+}
+
+func checksumFile(path string) (uint64, uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.New(castagnoli)
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(n), h.Sum32(), nil
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"iris/storage"
+	"iris/utils"
+	"log"
+
+	"github.com/cockroachdb/pebble"
+)
+
+/*
+Pebble tuning and storage administration.
+
+The options of pebble come from the config file, a value left at 0 keeps the default of pebble:
+
+	pebble_cache_size_mb               block cache shared by all the levels
+	pebble_memtable_size_mb            size of one memtable, a full one is flushed to L0
+	pebble_max_concurrent_compactions  compactions running at the same time
+	pebble_l0_compaction_threshold     L0 read amplification that starts a compaction
+	pebble_l0_stop_writes_threshold    L0 read amplification at which writes are stopped
+
+The bus admin commands COMPACT, METRICS and FLUSH call CompactSlots, StorageMetrics and Flush.
+The options are ignored with storage_engine memory, COMPACT and FLUSH do nothing there.
+*/
+
+const MAX_MEMTABLE_SIZE_MB = 4095 // pebble keeps memtables below 4GB
+
+// PebbleOptions builds the pebble options from the config.
+func PebbleOptions(cfg *utils.Config) *pebble.Options {
+	opts := &pebble.Options{}
+	if cfg == nil {
+		return opts
+	}
+
+	if cfg.PebbleCacheSizeMB > 0 {
+		opts.Cache = pebble.NewCache(int64(cfg.PebbleCacheSizeMB) << 20)
+	}
+	switch {
+	case cfg.PebbleMemTableSizeMB > MAX_MEMTABLE_SIZE_MB:
+		log.Printf("[WARN]: pebble_memtable_size_mb %d is above the limit, using %d\n", cfg.PebbleMemTableSizeMB, MAX_MEMTABLE_SIZE_MB)
+		opts.MemTableSize = MAX_MEMTABLE_SIZE_MB << 20
+	case cfg.PebbleMemTableSizeMB > 0:
+		opts.MemTableSize = uint64(cfg.PebbleMemTableSizeMB) << 20
+	}
+	if n := cfg.PebbleMaxConcurrentCompactions; n > 0 {
+		opts.MaxConcurrentCompactions = func() int { return n }
+	}
+	if cfg.PebbleL0CompactionThreshold > 0 {
+		opts.L0CompactionThreshold = cfg.PebbleL0CompactionThreshold
+	}
+	if cfg.PebbleL0StopWritesThreshold > 0 {
+		opts.L0StopWritesThreshold = cfg.PebbleL0StopWritesThreshold
+	}
+	if opts.L0CompactionThreshold > 0 && opts.L0StopWritesThreshold > 0 && opts.L0StopWritesThreshold <= opts.L0CompactionThreshold {
+		log.Printf("[WARN]: pebble_l0_stop_writes_threshold %d is not above pebble_l0_compaction_threshold %d, writes would stop before L0 is compacted\n",
+			opts.L0StopWritesThreshold, opts.L0CompactionThreshold)
+	}
+	return opts
+}
+
+// CompactSlots compacts the keys of the slots start-end, a range that wraps around is compacted
+// in two spans.
+func (e *Engine) CompactSlots(start, end uint16) error {
+	for _, span := range slotSpans(start, end) {
+		if err := e.Db.Compact(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompactAll compacts the whole keyspace, the internal records included.
+func (e *Engine) CompactAll() error {
+	return e.Db.Compact(storage.Span{Lower: SystemKeyspace().Lower, Upper: UserKeyspace().Upper})
+}
+
+// Flush writes the memtables to L0.
+func (e *Engine) Flush() error {
+	return e.Db.Flush()
+}
+
+// StorageMetrics renders the state of the storage backend for METRICS.
+func (e *Engine) StorageMetrics() string {
+	return e.Db.Metrics()
+}
@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"iris/serializer/pb"
+	"iris/storage"
+	"sort"
+	"sync"
+)
+
+/*
+Values are stored in an envelope that carries the HLC timestamp of the write:
+
+	0x00 | version (1 byte) | HLC timestamp (8 bytes, big endian) | crc32c (4 bytes) | body
+
+	version 1: no crc32c field, written before checksums, read unverified
+	version 2: the body is the payload
+	version 3: the body is the payload sealed with a key of the key file, see encryption.go
+	version 4: an encoding byte precedes the body: the codec compressing the payload
+	           (compression.go) and the ENCODING_SEALED flag
+
+The checksum covers the timestamp and everything after the header, see checksum.go, a
+sealed value is verified without its key. Values are written in the oldest version that
+holds their encoding.
+
+Client values come in through the text protocol and never start with a NUL byte, so a
+value without the marker was written before timestamps existed. Those decode with
+timestamp 0 and lose against any stamped write.
+*/
+const (
+	VALUE_MARKER          byte = 0x00
+	VALUE_VERSION         byte = 2
+	VALUE_VERSION_V1      byte = 1 // no checksum
+	VALUE_VERSION_SEALED  byte = 3
+	VALUE_VERSION_ENCODED byte = 4 // encoding byte before the body
+	VALUE_HEADER_SIZE          = 2 + 8 + 4
+	VALUE_HEADER_SIZE_V1       = 2 + 8
+)
+
+// Encoding tells how the body of a stored value is encoded: the codec of the payload in
+// the low bits, ENCODING_SEALED when it is sealed.
+type Encoding byte
+
+const (
+	CODEC_NONE      Encoding = 0
+	CODEC_SNAPPY    Encoding = 1
+	CODEC_ZSTD      Encoding = 2
+	CODEC_MASK      Encoding = 0x0f
+	ENCODING_SEALED Encoding = 0x80
+)
+
+func (enc Encoding) Codec() Encoding {
+	return enc & CODEC_MASK
+}
+
+func (enc Encoding) Sealed() bool {
+	return enc&ENCODING_SEALED != 0
+}
+
+var (
+	ErrCorruptValue  = errors.New("corrupt value envelope")
+	ErrValueChecksum = fmt.Errorf("%w: checksum mismatch", ErrCorruptValue)
+)
+
+// EncodeValue returns the stored value of a payload as is, Engine.encodeValue compresses
+// and seals it when those are on.
+func EncodeValue(ts uint64, payload []byte) []byte {
+	return encodeEnvelope(VALUE_VERSION, ts, payload)
+}
+
+// encodeStored returns the stored value of a body encoded with enc.
+func encodeStored(ts uint64, enc Encoding, body []byte) []byte {
+	switch enc {
+	case CODEC_NONE:
+		return encodeEnvelope(VALUE_VERSION, ts, body)
+	case ENCODING_SEALED:
+		return encodeEnvelope(VALUE_VERSION_SEALED, ts, body)
+	}
+	encoded := make([]byte, 1+len(body))
+	encoded[0] = byte(enc)
+	copy(encoded[1:], body)
+	return encodeEnvelope(VALUE_VERSION_ENCODED, ts, encoded)
+}
+
+func encodeEnvelope(version byte, ts uint64, body []byte) []byte {
+	buf := make([]byte, VALUE_HEADER_SIZE+len(body))
+	buf[0] = VALUE_MARKER
+	buf[1] = version
+	binary.BigEndian.PutUint64(buf[2:10], ts)
+	binary.BigEndian.PutUint32(buf[10:VALUE_HEADER_SIZE], ValueChecksum(ts, body))
+	copy(buf[VALUE_HEADER_SIZE:], body)
+	return buf
+}
+
+// DecodeValue returns the timestamp, body and encoding of a stored value, ErrValueChecksum
+// if the value doesn't match its checksum. Engine.openValue returns the payload. The body
+// aliases raw, copy it if raw is owned by the storage.
+func DecodeValue(raw []byte) (ts uint64, body []byte, enc Encoding, err error) {
+	if len(raw) == 0 || raw[0] != VALUE_MARKER {
+		// written before timestamps
+		return 0, raw, CODEC_NONE, nil
+	}
+	if len(raw) < 2 {
+		return 0, nil, 0, ErrCorruptValue
+	}
+
+	switch raw[1] {
+	case VALUE_VERSION_V1:
+		if len(raw) < VALUE_HEADER_SIZE_V1 {
+			return 0, nil, 0, ErrCorruptValue
+		}
+		return binary.BigEndian.Uint64(raw[2:10]), raw[VALUE_HEADER_SIZE_V1:], CODEC_NONE, nil
+	case VALUE_VERSION, VALUE_VERSION_SEALED, VALUE_VERSION_ENCODED:
+		if len(raw) < VALUE_HEADER_SIZE {
+			return 0, nil, 0, ErrCorruptValue
+		}
+		ts, body := binary.BigEndian.Uint64(raw[2:10]), raw[VALUE_HEADER_SIZE:]
+		if binary.BigEndian.Uint32(raw[10:VALUE_HEADER_SIZE]) != ValueChecksum(ts, body) {
+			return 0, nil, 0, ErrValueChecksum
+		}
+		switch raw[1] {
+		case VALUE_VERSION_SEALED:
+			return ts, body, ENCODING_SEALED, nil
+		case VALUE_VERSION_ENCODED:
+			if len(body) == 0 {
+				return 0, nil, 0, ErrCorruptValue
+			}
+			return ts, body[1:], Encoding(body[0]), nil
+		}
+		return ts, body, CODEC_NONE, nil
+	default:
+		return 0, nil, 0, ErrCorruptValue
+	}
+}
+
+// lwwStripes serializes the read-compare-write of PutLWW per key.
+const lwwStripes = 64
+
+type lwwLocks [lwwStripes]sync.Mutex
+
+func (l *lwwLocks) forKey(key []byte) *sync.Mutex {
+	return &l[crc32.ChecksumIEEE(key)%lwwStripes]
+}
+
+// newerWrite is the last-writer-wins order: the higher timestamp wins, on a tie the
+// bigger payload wins so every replica picks the same value.
+func newerWrite(ts uint64, payload []byte, oldTs uint64, oldPayload []byte) bool {
+	if ts != oldTs {
+		return ts > oldTs
+	}
+	return bytes.Compare(payload, oldPayload) > 0
+}
+
+// PutStamped writes a new local value with a fresh HLC timestamp, used by the master of the range.
+// mode "" uses the durability of the node. Returns the stored value, see Engine.ReplicationOf.
+func (e *Engine) PutStamped(key []byte, payload []byte, mode DurabilityMode) ([]byte, error) {
+	mu := e.lww.forKey(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, err := e.encodeValue(key, e.Clock.Now(), payload)
+	if err != nil {
+		return nil, err
+	}
+	batch := e.Db.NewBatch()
+	if err := batch.Set(EncodeUserKey(key), value); err != nil {
+		batch.Close()
+		return nil, err
+	}
+	return value, e.commit(batch, mode)
+}
+
+// replacesStored tells whether a replicated write of key wins over the stored value current,
+// and whether current failed its checksum: the write then repairs it once committed.
+// A damaged stored value, or one this node can't open, always loses.
+func (e *Engine) replacesStored(key []byte, ts uint64, payload []byte, current []byte) (newer, repairs bool) {
+	oldTs, oldBody, enc, err := DecodeValue(current)
+	if err != nil {
+		if errors.Is(err, ErrValueChecksum) {
+			e.corruptStored(key, "replication")
+			return true, true
+		}
+		return true, false
+	}
+	if ts != oldTs {
+		return ts > oldTs, false
+	}
+	oldPayload, err := e.decodePayload(key, oldTs, oldBody, enc)
+	if err != nil {
+		return true, false
+	}
+	return newerWrite(ts, payload, oldTs, oldPayload), false
+}
+
+// replacedBy is replacesStored for any replicated write: a delete removes the values
+// written up to its timestamp.
+func (e *Engine) replacedBy(rep *pb.ReplicateRequest, payload []byte, current []byte) (newer, repairs bool) {
+	if !rep.Deleted {
+		return e.replacesStored(rep.Key, rep.HlcTs, payload, current)
+	}
+	oldTs, _, _, err := DecodeValue(current)
+	return err != nil || oldTs <= rep.HlcTs, false
+}
+
+// PutLWW applies a replicated value unless the stored value was written later.
+// Returns whether the value was applied.
+func (e *Engine) PutLWW(rep *pb.ReplicateRequest) (bool, error) {
+	value, payload, err := e.replicatedValue(rep)
+	if err != nil {
+		return false, err
+	}
+	e.Clock.Update(rep.HlcTs)
+
+	mu := e.lww.forKey(rep.Key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	stored := EncodeUserKey(rep.Key)
+	current, closer, err := e.Db.Get(stored)
+	repairs := false
+	switch {
+	case err == nil:
+		var newer bool
+		newer, repairs = e.replacedBy(rep, payload, current)
+		closer.Close()
+		if !newer {
+			return false, nil
+		}
+	case !errors.Is(err, storage.ErrNotFound):
+		return false, err
+	case rep.Deleted:
+		return false, nil
+	}
+
+	batch := e.Db.NewBatch()
+	if err := setOrDelete(batch, stored, value, rep.Deleted); err != nil {
+		batch.Close()
+		return false, err
+	}
+	if err := e.commit(batch, ""); err != nil {
+		return false, err
+	}
+	if repairs {
+		e.checksums.repaired.Add(1)
+	}
+	return true, nil
+}
+
+func setOrDelete(batch storage.Batch, key, value []byte, deleted bool) error {
+	if deleted {
+		return batch.Delete(key)
+	}
+	return batch.Set(key, value)
+}
+
+// lockAll locks the stripes of every key, in stripe order so concurrent batches can't deadlock.
+// Returns the function releasing them.
+func (l *lwwLocks) lockAll(keys [][]byte) func() {
+	stripes := make(map[uint32]bool, len(keys))
+	for _, key := range keys {
+		stripes[crc32.ChecksumIEEE(key)%lwwStripes] = true
+	}
+	order := make([]uint32, 0, len(stripes))
+	for idx := range stripes {
+		order = append(order, idx)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	for _, idx := range order {
+		l[idx].Lock()
+	}
+	return func() {
+		for i := len(order) - 1; i >= 0; i-- {
+			l[order[i]].Unlock()
+		}
+	}
+}
+
+// PutBatchLWW applies a batch of replicated values last-writer-wins, like PutLWW, and
+// commits them in a single batch with one sync. Returns how many were applied.
+func (e *Engine) PutBatchLWW(entries []*pb.ReplicateRequest) (int, error) {
+	keys := make([][]byte, len(entries))
+	values := make([][]byte, len(entries))
+	payloads := make([][]byte, len(entries))
+	for i, entry := range entries {
+		var err error
+		if values[i], payloads[i], err = e.replicatedValue(entry); err != nil {
+			return 0, err
+		}
+		keys[i] = entry.Key
+		e.Clock.Update(entry.HlcTs)
+	}
+	unlock := e.lww.lockAll(keys)
+	defer unlock()
+
+	// indexed, so a key written twice in the batch is compared against the first write
+	batch := e.Db.NewIndexedBatch()
+	defer batch.Close()
+
+	applied, repaired := 0, 0
+	for i, entry := range entries {
+		stored := EncodeUserKey(entry.Key)
+		current, closer, err := batch.Get(stored)
+		switch {
+		case err == nil:
+			newer, repairs := e.replacedBy(entry, payloads[i], current)
+			closer.Close()
+			if !newer {
+				continue
+			}
+			if repairs {
+				repaired++
+			}
+		case !errors.Is(err, storage.ErrNotFound):
+			return 0, err
+		case entry.Deleted:
+			continue
+		}
+
+		if err := setOrDelete(batch, stored, values[i], entry.Deleted); err != nil {
+			return 0, err
+		}
+		applied++
+	}
+
+	if applied == 0 {
+		return 0, nil
+	}
+	if err := batch.Commit(e.syncReplicatedBatch()); err != nil {
+		return 0, err
+	}
+	e.checksums.repaired.Add(uint64(repaired))
+	return applied, nil
+}
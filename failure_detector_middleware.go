@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"iris/config"
+	"iris/engine"
+	"log"
+	"time"
+)
+
+const FAILURE_DETECTOR_INTERVAL = 5 * time.Second
+
+// FailureDetectorMiddleware runs the master side failure detector. Followers that stay
+// DEAD for longer than the eviction grace period are removed from the cluster, their
+// ranges fail over to a replica and the replication factor is restored afterwards. A dead
+// node holding the only copy of a range stays in the cluster until an operator brings it back.
+func FailureDetectorMiddleware(server *config.Server, IrisDb *engine.Engine) {
+	held := make(map[string]bool) // dead nodes kept for holding the only copy of a range
+	for {
+		time.Sleep(FAILURE_DETECTOR_INTERVAL)
+
+		// only the master receives heartbeats
+		if server.GetMasterNodeID() != server.ServerID {
+			continue
+		}
+
+		dead := make(map[string]bool)
+		for _, nodeID := range server.EvaluateNodeHealth() {
+			dead[nodeID] = true
+			err := evictDeadNode(nodeID, server, IrisDb)
+			if !errors.Is(err, config.ErrSoleHolder) {
+				continue
+			}
+			if !held[nodeID] {
+				log.Printf("[WARN]: not evicting dead node %s: %v, its ranges stay unavailable until it comes back\n", nodeID, err)
+			}
+			held[nodeID] = true
+		}
+		for nodeID := range held {
+			if !dead[nodeID] {
+				delete(held, nodeID)
+			}
+		}
+	}
+}
+
+func evictDeadNode(nodeID string, server *config.Server, IrisDb *engine.Engine) error {
+	if err := server.EvictNode(nodeID); err != nil {
+		if !errors.Is(err, config.ErrSoleHolder) {
+			log.Printf("[ERROR]: failed to evict node %s: %v\n", nodeID, err)
+		}
+		return err
+	}
+	log.Printf("[FAILURE DETECTOR]: evicted dead node %s from the cluster\n", nodeID)
+	if err := IrisDb.SaveServerMetadata(server); err != nil {
+		log.Printf("[WARN] Failed to save server config after evicting %s: %v", nodeID, err)
+	}
+
+	acked := server.BroadcastClusterSnapshot(nodeID)
+	log.Printf("[FAILURE DETECTOR]: node %s evicted, cluster version %d sent to %d peers\n",
+		nodeID, server.GetClusterVersion(), acked)
+
+	// the promoted replicas left their ranges one replica short
+	for _, masterID := range server.GetMasterIDs() {
+		mapping := server.RepairReplication(masterID)
+		handleDistributionFromMaster(mapping, server, IrisDb)
+	}
+
+	if err := IrisDb.SaveServerMetadata(server); err != nil {
+		log.Printf("[WARN] Failed to save server config after repairing replication: %v", err)
+	}
+	return nil
+}
+
+// PartitionMonitorMiddleware tracks whether this node is on the minority side of a network
+// split. When the partition heals the node pulls the snapshot from the master, whichever
+// side moved the cluster version further wins. A master steps down if the majority elected
+// another one meanwhile.
+func PartitionMonitorMiddleware(server *config.Server, IrisDb *engine.Engine) {
+	for {
+		time.Sleep(FAILURE_DETECTOR_INTERVAL)
+
+		minority, changed := server.UpdatePartitionState()
+		if !changed || minority {
+			continue
+		}
+
+		server.GlobalPause.Store(true)
+		var err error
+		if server.GetMasterNodeID() == server.ServerID {
+			err = server.ReconcileMastership()
+		} else {
+			err = server.RequestMetadataSnapShot()
+		}
+		server.GlobalPause.Store(false)
+		if err != nil {
+			log.Printf("[WARN]: failed to reconcile metadata after the partition healed: %v\n", err)
+			continue
+		}
+		if err := IrisDb.SaveServerMetadata(server); err != nil {
+			log.Printf("[WARN] Failed to save server config after the partition healed: %v", err)
+		}
+	}
+}
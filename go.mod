@@ -4,9 +4,12 @@ go 1.24.0
 
 require (
 	github.com/cockroachdb/pebble v1.1.5
+	github.com/golang/snappy v0.0.4
 	github.com/google/uuid v1.6.0
 	github.com/howeyc/crc16 v0.0.0-20171223171357-2b2a61e366a6
+	github.com/klauspost/compress v1.16.0
 	github.com/shirou/gopsutil/v4 v4.26.1
+	google.golang.org/protobuf v1.33.0
 )
 
 require (
@@ -23,8 +26,6 @@ require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
-	github.com/klauspost/compress v1.16.0 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
@@ -42,5 +43,4 @@ require (
 	golang.org/x/exp v0.0.0-20230626212559-97b1e661b5df // indirect
 	golang.org/x/sys v0.40.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
 )
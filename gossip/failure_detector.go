@@ -0,0 +1,98 @@
+package gossip
+
+import (
+	"log"
+	"time"
+)
+
+const FAILURE_DETECTOR_INTERVAL = 1 * time.Second
+
+// SetPhiThresholds overrides the phi levels at which a node becomes SUSPECT and DEAD.
+// Non positive values keep the current threshold.
+func (g *Gossip) SetPhiThresholds(suspect, dead float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if suspect > 0 {
+		g.suspectPhi = suspect
+	}
+	if dead > 0 {
+		g.deadPhi = dead
+	}
+	if g.deadPhi < g.suspectPhi {
+		log.Printf("[WARN]: dead phi threshold %.2f is lower than suspect threshold %.2f, using %.2f\n", g.deadPhi, g.suspectPhi, g.suspectPhi)
+		g.deadPhi = g.suspectPhi
+	}
+}
+
+// DetectFailures periodically evaluates the phi of every known peer and moves
+// it ALIVE -> SUSPECT -> DEAD once the configured thresholds are crossed.
+func (g *Gossip) DetectFailures() {
+	ticker := time.NewTicker(FAILURE_DETECTOR_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			g.evaluatePhi(now)
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+func (g *Gossip) evaluatePhi(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for nodeID, state := range g.table {
+		if nodeID == g.localID {
+			continue
+		}
+		d, ok := g.detectors[nodeID]
+		if !ok {
+			continue
+		}
+
+		phi := d.phi(now)
+		switch {
+		case state.Health == ALIVE && phi >= g.suspectPhi:
+			// probe before raising the suspicion
+			go g.confirmSuspicion(nodeID, phi)
+
+		case state.Health == SUSPECT && phi >= g.deadPhi:
+			state.Health = DEAD
+			state.Version++
+			g.publishLocked(HealthEvent{NodeID: nodeID, Health: DEAD, Phi: phi})
+		}
+	}
+}
+
+// observeLocked records evidence that nodeID was alive at the given time. It only
+// feeds the phi detector, the health of the node is governed by incarnations.
+// Caller must hold g.mu.
+func (g *Gossip) observeLocked(nodeID string, now time.Time) {
+	if nodeID == "" || nodeID == g.localID {
+		return
+	}
+
+	if d, ok := g.detectors[nodeID]; ok {
+		d.heartbeat(now)
+	} else {
+		g.detectors[nodeID] = newPhiDetector(now)
+	}
+
+	if state, ok := g.table[nodeID]; ok {
+		state.LastSeen = now
+	}
+}
+
+// publishLocked never blocks, the gossip loop must keep running even if nobody listens.
+func (g *Gossip) publishLocked(ev HealthEvent) {
+	log.Printf("[GOSSIP]: node %s is now %s (phi=%.2f)\n", ev.NodeID, ev.Health, ev.Phi)
+	select {
+	case g.HealthEvents <- ev:
+	default:
+		log.Printf("[WARN]: gossip health event for %s dropped, channel full\n", ev.NodeID)
+	}
+}
@@ -2,6 +2,7 @@ package gossip
 
 import (
 	"iris/serializer/pb"
+	"net"
 	"sync"
 	"time"
 )
@@ -20,6 +21,19 @@ const (
 	INTRA_GOSSIP
 )
 
+func (h NodeHealth) String() string {
+	switch h {
+	case ALIVE:
+		return "ALIVE"
+	case SUSPECT:
+		return "SUSPECT"
+	case DEAD:
+		return "DEAD"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 type NodeState struct {
 	NodeID         string
 	Group          string
@@ -27,6 +41,30 @@ type NodeState struct {
 	LastSeen       time.Time
 	SuspicionCount int
 	Version        uint64
+	Heartbeat      uint64 // only ever incremented by the node itself, a higher value proves it is alive
+	Incarnation    uint64 // SWIM incarnation, only ever incremented by the node itself to refute suspicion
+
+	// piggybacking bookkeeping for the UDP transport
+	gossipCount       int // how many datagrams carried this entry since it last changed
+	gossipedVersion   uint64
+	gossipedHeartbeat uint64
+}
+
+// MetadataEvent is published on Gossip.MetadataEvents when a peer gossips a newer
+// cluster version than ours, or the same version with different metadata (Diverged).
+type MetadataEvent struct {
+	NodeID         string
+	ClusterVersion uint64
+	MetadataHash   uint64
+	Diverged       bool
+}
+
+// HealthEvent is published on Gossip.HealthEvents whenever the local failure
+// detector moves a node to a different health state.
+type HealthEvent struct {
+	NodeID string
+	Health NodeHealth
+	Phi    float64
 }
 
 /*
@@ -40,6 +78,8 @@ type ClusterView interface {
 	GetAllGroups() []string
 	GetLocalNodeID() string
 	GetLocalGroup() string
+	GetClusterVersion() uint64
+	MetadataHash() uint64
 }
 
 type GossipTable map[string]*NodeState
@@ -69,18 +109,41 @@ type Gossip struct {
 	InterGossipsChan    chan *pb.GossipMessage
 	SuspectMessagesChan chan string //receives the nodeid from the engine package(when connection fail in the local node)
 	stop                chan struct{}
+
+	/*
+		phi-accrual failure detector per peer, fed by the arrival of gossip from (or about) the peer.
+		SUSPECT and DEAD transitions (and recoveries back to ALIVE) are published on HealthEvents.
+	*/
+	detectors    map[string]*phiDetector
+	probing      map[string]bool // nodes with an indirect probe in flight
+	suspectPhi   float64
+	deadPhi      float64
+	HealthEvents chan HealthEvent
+
+	MetadataEvents chan MetadataEvent
+
+	udpConn *net.UDPConn      // nil until ServeUDP is running, gossip falls back to TCP
+	rounds  map[string]uint64 // gossip rounds sent to each peer, drives the periodic full sync
 }
 
 func NewGossip(view ClusterView) *Gossip {
 	gossip := &Gossip{
-		localID:          view.GetLocalNodeID(),
-		Group:            view.GetLocalGroup(),
-		view:             view,
-		table:            make(GossipTable),
-		DeadEvents:       make(chan string, 10),
-		JoinEvents:       make(chan NodeState, 10),
-		IntraGossipsChan: make(chan *pb.GossipMessage, 10),
-		InterGossipsChan: make(chan *pb.GossipMessage, 10),
+		localID:             view.GetLocalNodeID(),
+		Group:               view.GetLocalGroup(),
+		view:                view,
+		table:               make(GossipTable),
+		DeadEvents:          make(chan string, 10),
+		JoinEvents:          make(chan NodeState, 10),
+		IntraGossipsChan:    make(chan *pb.GossipMessage, 10),
+		InterGossipsChan:    make(chan *pb.GossipMessage, 10),
+		SuspectMessagesChan: make(chan string, 16),
+		detectors:           make(map[string]*phiDetector),
+		probing:             make(map[string]bool),
+		suspectPhi:          DEFAULT_SUSPECT_PHI,
+		deadPhi:             DEFAULT_DEAD_PHI,
+		HealthEvents:        make(chan HealthEvent, 64),
+		MetadataEvents:      make(chan MetadataEvent, 8),
+		rounds:              make(map[string]uint64),
 	}
 
 	gossip.seedFromView()
@@ -92,15 +155,19 @@ func (g *Gossip) seedFromView() {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	now := time.Now()
 	for _, group_name := range g.view.GetAllGroups() {
 		for _, nodeID := range g.view.GetGroupMembers(group_name) {
 			g.table[nodeID] = &NodeState{
 				NodeID:   nodeID,
 				Group:    group_name,
 				Health:   ALIVE,
-				LastSeen: time.Now(),
+				LastSeen: now,
 				Version:  0,
 			}
+			if nodeID != g.localID {
+				g.detectors[nodeID] = newPhiDetector(now)
+			}
 		}
 	}
 }
@@ -115,20 +182,13 @@ func (g *Gossip) MonitorChannel() {
 			if !ok {
 				return
 			}
-			g.mu.Lock()
-			if state, exists := g.table[nodeID]; exists {
-				state.Health = DEAD
-				state.Version += 1
-			}
-			g.mu.Unlock()
+			g.handleDeadEvent(nodeID)
 
 		case node, ok := <-g.JoinEvents:
 			if !ok {
 				return
 			}
-			g.mu.Lock()
-			g.table[node.NodeID] = &node
-			g.mu.Unlock()
+			g.handleJoinEvent(node)
 
 		case msg, ok := <-g.InterGossipsChan:
 			if !ok {
@@ -154,15 +214,80 @@ func (g *Gossip) MonitorChannel() {
 	}
 }
 
+// handleDeadEvent marks a node that left (or was evicted from) the cluster as DEAD and
+// stops tracking it. The entry stays in the table with a bumped version so the DEAD state
+// wins over older ALIVE rumours still going around.
+func (g *Gossip) handleDeadEvent(nodeID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if nodeID == g.localID {
+		return
+	}
+	state, exists := g.table[nodeID]
+	if !exists {
+		return
+	}
+	state.Health = DEAD
+	state.Version += 1
+	delete(g.detectors, nodeID)
+	delete(g.probing, nodeID)
+	delete(g.rounds, nodeID)
+}
+
+// handleJoinEvent adds a node that joined the cluster to the table. A node that rejoins
+// with the same ID is revived: its entry is marked ALIVE with a bumped version so the
+// DEAD state gossiped earlier doesn't stick to it.
+func (g *Gossip) handleJoinEvent(node NodeState) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if node.NodeID == g.localID {
+		return
+	}
+	now := time.Now()
+	if state, exists := g.table[node.NodeID]; exists {
+		if node.Group != "" {
+			state.Group = node.Group
+		}
+		state.Health = ALIVE
+		state.SuspicionCount = 0
+		state.LastSeen = now
+		state.Version += 1
+	} else {
+		node.LastSeen = now
+		g.table[node.NodeID] = &node
+	}
+	g.detectors[node.NodeID] = newPhiDetector(now)
+}
+
+// Suspect reports a failed connection to nodeID, e.g. from the client path in the engine.
+// It never blocks the caller, the report is dropped if the gossip loop is busy.
+func (g *Gossip) Suspect(nodeID string) {
+	if g == nil || nodeID == "" || nodeID == g.localID {
+		return
+	}
+	select {
+	case g.SuspectMessagesChan <- nodeID:
+	default:
+	}
+}
+
 func (g *Gossip) handleSuspectMessagesLocal(nodeid string) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	g.table[nodeid].SuspicionCount++
-	g.table[nodeid].Version++
+	state, ok := g.table[nodeid]
+	if !ok {
+		return
+	}
 
-	//task
-	//.. send the suspect msg to the master node
+	// a failed connection from this node alone is not enough, the peer is probed
+	// directly and through other members before it is marked SUSPECT. The SUSPECT
+	// event is published on HealthEvents and the server reports it to the master.
+	if state.Health == ALIVE {
+		go g.confirmSuspicion(nodeid, 0)
+	}
 }
 
 // func (g *Gossip) GetNodeFromTable(id string) *NodeState{
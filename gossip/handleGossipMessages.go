@@ -2,37 +2,124 @@ package gossip
 
 import (
 	"iris/serializer/pb"
+	"log"
 	"time"
 )
 
 func (g *Gossip) handleGossipMessage(msg *pb.GossipMessage) {
+	g.checkMetadataVersion(msg)
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	now := time.Now()
+
+	// receiving a message is direct evidence that the sender is alive
+	g.observeLocked(msg.SenderId, now)
+
 	for _, incoming := range msg.States {
+		if incoming.NodeId == g.localID {
+			g.refuteLocked(incoming)
+			continue
+		}
 
 		local, exist := g.table[incoming.NodeId]
 		if !exist {
 			g.table[incoming.NodeId] = protoMessageToNodeState(incoming)
+			g.detectors[incoming.NodeId] = newPhiDetector(now)
 			continue
 		}
 
-		if incoming.Version > local.Version {
-			local.Health = NodeHealth(incoming.Health)
-			local.Version = incoming.Version
+		if g.mergeLocked(local, NodeHealth(incoming.Health), incoming.Incarnation) {
+			local.SuspicionCount = int(incoming.SuspicionCount)
 		}
 
-		if incoming.Health == pb.NodeHealth(SUSPECT) && incoming.Version > local.Version {
-			if local.LastSeen.After(time.Unix(incoming.LastSeen, 0)) {
-				local.Version = incoming.Version + 1
-				continue
-			}
+		// the node bumped its heartbeat since we last heard about it, so it was alive
+		// more recently than our view. This only feeds the failure detector, clearing a
+		// suspicion is up to the node itself by refuting it with a higher incarnation.
+		if incoming.Heartbeat > local.Heartbeat {
+			local.Heartbeat = incoming.Heartbeat
+			g.observeLocked(incoming.NodeId, now)
 		}
+	}
+}
 
-		if msg.SenderId == local.NodeID {
-			local.LastSeen = time.Now()
-		}
+// checkMetadataVersion compares the cluster version carried by the gossip with ours
+// and asks the server to pull the snapshot from the sender when it knows better.
+func (g *Gossip) checkMetadataVersion(msg *pb.GossipMessage) {
+	if msg.ClusterVersion == 0 {
+		return
+	}
+
+	ev := MetadataEvent{
+		NodeID:         msg.SenderId,
+		ClusterVersion: msg.ClusterVersion,
+		MetadataHash:   msg.MetadataHash,
+	}
+
+	local := g.view.GetClusterVersion()
+	switch {
+	case msg.ClusterVersion > local:
+		log.Printf("[GOSSIP]: %s knows cluster version %d (local %d)\n", msg.SenderId, msg.ClusterVersion, local)
+	case msg.ClusterVersion == local && msg.MetadataHash != 0 && msg.MetadataHash != g.view.MetadataHash():
+		log.Printf("[GOSSIP]: metadata of %s diverged from ours at cluster version %d\n", msg.SenderId, local)
+		ev.Diverged = true
+	default:
+		return
+	}
+
+	select {
+	case g.MetadataEvents <- ev:
+	default:
+		// a pull is already queued, the next gossip round will remind us
+	}
+}
+
+// mergeLocked applies a rumour about a node following the SWIM precedence rules:
+// a higher incarnation always wins, at the same incarnation DEAD beats SUSPECT beats ALIVE.
+// Returns true if the local state changed. Caller must hold g.mu.
+func (g *Gossip) mergeLocked(local *NodeState, health NodeHealth, incarnation uint64) bool {
+	if incarnation < local.Incarnation || (incarnation == local.Incarnation && health <= local.Health) {
+		return false
+	}
+
+	previous := local.Health
+	local.Health = health
+	local.Incarnation = incarnation
+	local.Version++
+
+	if health == ALIVE && previous != ALIVE {
+		local.SuspicionCount = 0
+		g.publishLocked(HealthEvent{NodeID: local.NodeID, Health: ALIVE})
+	}
+	return true
+}
+
+// refuteLocked handles a rumour about the local node. If someone thinks we are
+// SUSPECT or DEAD we bump our incarnation, the new ALIVE state overrides the rumour
+// everywhere it spreads. Caller must hold g.mu.
+func (g *Gossip) refuteLocked(incoming *pb.NodeState) {
+	self := g.selfLocked()
+	if NodeHealth(incoming.Health) == ALIVE || incoming.Incarnation < self.Incarnation {
+		return
+	}
+
+	self.Incarnation = incoming.Incarnation + 1
+	self.Health = ALIVE
+	self.Version++
+	log.Printf("[GOSSIP]: refuting %s rumour about this node, incarnation is now %d\n",
+		NodeHealth(incoming.Health), self.Incarnation)
+}
+
+// selfLocked returns the table entry of the local node, creating it if needed.
+// Caller must hold g.mu.
+func (g *Gossip) selfLocked() *NodeState {
+	self, ok := g.table[g.localID]
+	if !ok {
+		self = &NodeState{NodeID: g.localID, Group: g.Group, Health: ALIVE, LastSeen: time.Now()}
+		g.table[g.localID] = self
 	}
+	return self
 }
 
 func protoMessageToNodeState(msg *pb.NodeState) *NodeState {
@@ -43,5 +130,7 @@ func protoMessageToNodeState(msg *pb.NodeState) *NodeState {
 		LastSeen:       time.Time{},
 		SuspicionCount: int(msg.SuspicionCount),
 		Version:        msg.Version,
+		Heartbeat:      msg.Heartbeat,
+		Incarnation:    msg.Incarnation,
 	}
 }
@@ -1,14 +1,8 @@
 package gossip
 
 import (
-	"encoding/base64"
-	"iris/serializer/pb"
-	"log"
 	"math/rand"
-	"net"
 	"time"
-
-	"github.com/gogo/protobuf/proto"
 )
 
 const INTER_GOSSIP_FACTOR = 2
@@ -19,41 +13,23 @@ func (g *Gossip) InterGossip() {
 
 		groups := g.view.GetAllGroups()
 		for i := 0; i < INTER_GOSSIP_FACTOR; i++ {
+			if len(groups) == 0 {
+				break
+			}
 			randgrp := rand.Uint32() % uint32(len(groups))
 
 			selectedGroup := groups[randgrp]
 			members := g.view.GetGroupMembers(selectedGroup)
-			randomNum := rand.Uint32() * uint32(len(members))
-			selectedNode := members[randomNum]
-
-			addr, exist := g.view.GetNodeAddr(selectedNode)
-			if !exist {
-				log.Println("Beware the node is not present in the server")
-				return
+			if len(members) == 0 {
+				continue
 			}
-
-			conn, err := net.DialTimeout("tcp", addr, time.Second*3)
-			if err != nil {
-				return
+			randomNum := rand.Uint32() % uint32(len(members))
+			selectedNode := members[randomNum]
+			if selectedNode == g.localID {
+				continue
 			}
 
-			states := g.ToGossipStates()
-
-			data := &pb.GossipMessage{
-				MessageType: 1,
-				SenderId:    g.localID,
-				States:      states,
-			}
-			payload, err := proto.Marshal(data)
-			if err != nil {
-				return
-			}
-			encoded := base64.StdEncoding.EncodeToString(payload)
-			msg := "GOSSIP " + encoded + "\n"
-			_, err = conn.Write([]byte(msg))
-			if err != nil {
-				return
-			}
+			g.gossipTo(selectedNode, INTER_GOSSIP)
 		}
 	}
 
@@ -1,14 +1,9 @@
 package gossip
 
 import (
-	"encoding/base64"
 	"iris/serializer/pb"
-	"log"
 	"math/rand"
-	"net"
 	"time"
-
-	"github.com/gogo/protobuf/proto"
 )
 
 /*Gossips the state of the node to randomly selected nodes in the group same as the current node.*/
@@ -17,37 +12,16 @@ func (g *Gossip) IntraGossip() {
 		time.Sleep(10 * time.Second)
 
 		members := g.view.GetGroupMembers(g.Group)
+		if len(members) == 0 {
+			continue
+		}
 		randomNum := rand.Uint32() % uint32(len(members))
 		selectedNode := members[randomNum]
-
-		addr, exist := g.view.GetNodeAddr(selectedNode)
-		if !exist {
-			log.Println("Beware the node is not present in the server")
-			return
+		if selectedNode == g.localID {
+			continue
 		}
 
-		conn, err := net.DialTimeout("tcp", addr, time.Second*3)
-		if err != nil {
-			return
-		}
-
-		states := g.ToGossipStates()
-
-		data := &pb.GossipMessage{
-			MessageType: 1,
-			SenderId:    g.localID,
-			States:      states,
-		}
-		payload, err := proto.Marshal(data)
-		if err != nil {
-			return
-		}
-		encoded := base64.StdEncoding.EncodeToString(payload)
-		msg := "GOSSIP " + encoded + "\n"
-		_, err = conn.Write([]byte(msg))
-		if err != nil {
-			return
-		}
+		g.gossipTo(selectedNode, INTRA_GOSSIP)
 	}
 
 }
@@ -60,6 +34,8 @@ func ToNodeStateProtobuf(nodestate *NodeState) *pb.NodeState {
 		LastSeen:       nodestate.LastSeen.Unix(),
 		SuspicionCount: int32(nodestate.SuspicionCount),
 		Version:        nodestate.Version,
+		Heartbeat:      nodestate.Heartbeat,
+		Incarnation:    nodestate.Incarnation,
 	}
 }
 
@@ -67,6 +43,8 @@ func (g *Gossip) ToGossipStates() []*pb.NodeState {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	g.beatLocked()
+
 	states := make([]*pb.NodeState, 0, len(g.table))
 
 	for _, node := range g.table {
@@ -74,3 +52,11 @@ func (g *Gossip) ToGossipStates() []*pb.NodeState {
 	}
 	return states
 }
+
+// beatLocked bumps the heartbeat of the local node, every outgoing gossip carries a fresh one.
+// Caller must hold g.mu.
+func (g *Gossip) beatLocked() {
+	self := g.selfLocked()
+	self.Heartbeat++
+	self.LastSeen = time.Now()
+}
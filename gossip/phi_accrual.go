@@ -0,0 +1,92 @@
+package gossip
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	DEFAULT_SUSPECT_PHI = 8.0
+	DEFAULT_DEAD_PHI    = 16.0
+
+	PHI_WINDOW_SIZE = 100 // number of inter-arrival samples kept per node
+	PHI_MIN_STD_DEV = 500 * time.Millisecond
+
+	// expected gap between two pieces of evidence about a node, used to
+	// bootstrap a detector before it has seen any real arrivals
+	PHI_BOOTSTRAP_INTERVAL = 10 * time.Second
+)
+
+/*
+phiDetector is an adaptive phi-accrual failure detector (Hayashibara et al.) for a single peer.
+Instead of a fixed timeout it keeps a window of inter-arrival times of the evidence that the peer
+is alive and reports phi = -log10(P(next arrival is later than now)). phi grows the longer we go
+without hearing from the peer, relative to how regularly we used to hear from it.
+*/
+type phiDetector struct {
+	intervals []float64 // milliseconds, ring buffer of the last PHI_WINDOW_SIZE samples
+	next      int
+	sum       float64
+	sumSq     float64
+	last      time.Time
+}
+
+func newPhiDetector(now time.Time) *phiDetector {
+	d := &phiDetector{
+		intervals: make([]float64, 0, PHI_WINDOW_SIZE),
+		last:      now,
+	}
+
+	// seed with the expected interval and some jitter so phi has something to work with
+	mean := float64(PHI_BOOTSTRAP_INTERVAL.Milliseconds())
+	d.addInterval(mean - mean/4)
+	d.addInterval(mean + mean/4)
+	return d
+}
+
+func (d *phiDetector) addInterval(ms float64) {
+	if len(d.intervals) < PHI_WINDOW_SIZE {
+		d.intervals = append(d.intervals, ms)
+	} else {
+		old := d.intervals[d.next]
+		d.sum -= old
+		d.sumSq -= old * old
+		d.intervals[d.next] = ms
+		d.next = (d.next + 1) % PHI_WINDOW_SIZE
+	}
+	d.sum += ms
+	d.sumSq += ms * ms
+}
+
+// heartbeat records a new arrival.
+func (d *phiDetector) heartbeat(now time.Time) {
+	if now.After(d.last) {
+		d.addInterval(float64(now.Sub(d.last).Milliseconds()))
+	}
+	d.last = now
+}
+
+// phi returns the suspicion level for the peer at the given time.
+func (d *phiDetector) phi(now time.Time) float64 {
+	n := float64(len(d.intervals))
+	if n == 0 {
+		return 0
+	}
+
+	mean := d.sum / n
+	variance := d.sumSq/n - mean*mean
+	stdDev := math.Sqrt(math.Max(variance, 0))
+	if minStd := float64(PHI_MIN_STD_DEV.Milliseconds()); stdDev < minStd {
+		stdDev = minStd
+	}
+
+	elapsed := float64(now.Sub(d.last).Milliseconds())
+
+	// logistic approximation of the normal CDF, same as the one used by Akka and Cassandra
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1.0 + e))
+	}
+	return -math.Log10(1.0 - 1.0/(1.0+e))
+}
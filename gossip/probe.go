@@ -0,0 +1,193 @@
+package gossip
+
+import (
+	"fmt"
+	"iris/buspool"
+	"iris/serializer/pb"
+	"iris/utils"
+	"math/rand"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	PROBE_TIMEOUT         = 1 * time.Second
+	INDIRECT_PROBE_FANOUT = 3 // k members asked to ping the target on our behalf
+)
+
+/*
+SWIM style probing. Before a node is marked SUSPECT it is pinged directly, and if that
+fails, INDIRECT_PROBE_FANOUT random members are asked to ping it for us (PING_REQ).
+Only when nobody can reach the node the suspicion is raised, so a flaky link between
+two nodes no longer looks like a dead node.
+
+Bus messages:
+	PING     PingRequest{sender}            -> PingAck{node, incarnation}
+	PING_REQ PingReqRequest{sender, target} -> PingAck{target, incarnation}, ack unset if the target didn't answer
+*/
+
+// Ping sends a direct PING to nodeID and returns the incarnation it answered with.
+func (g *Gossip) Ping(nodeID string) (uint64, error) {
+	req := &pb.PingRequest{SenderId: g.localID}
+	return g.sendProbe(nodeID, pb.BusCommand_PING, req, nodeID, PROBE_TIMEOUT)
+}
+
+// pingReq asks helperID to ping targetID on our behalf.
+func (g *Gossip) pingReq(helperID, targetID string) (uint64, error) {
+	req := &pb.PingReqRequest{SenderId: g.localID, TargetId: targetID}
+	// the helper needs up to PROBE_TIMEOUT for its own ping
+	return g.sendProbe(helperID, pb.BusCommand_PING_REQ, req, targetID, 2*PROBE_TIMEOUT+PROBE_TIMEOUT/2)
+}
+
+// sendProbe sends a probe to nodeID and returns the incarnation of ackFrom from the reply.
+func (g *Gossip) sendProbe(nodeID string, command pb.BusCommand, req proto.Message, ackFrom string, timeout time.Duration) (uint64, error) {
+	addr, ok := g.view.GetNodeAddr(nodeID)
+	if !ok {
+		return 0, fmt.Errorf("node %s not found", nodeID)
+	}
+	busAddr, err := utils.BumpPort(addr, 10000)
+	if err != nil {
+		return 0, err
+	}
+
+	var ack pb.PingAck
+	if err := buspool.Call(busAddr, command, req, &ack, timeout); err != nil {
+		return 0, err
+	}
+	if !ack.Ack || ack.NodeId != ackFrom {
+		return 0, fmt.Errorf("no ack from %s", ackFrom)
+	}
+	return ack.Incarnation, nil
+}
+
+// probe pings nodeID directly and then indirectly through up to
+// INDIRECT_PROBE_FANOUT other members. Returns true if anyone got an ACK.
+func (g *Gossip) probe(nodeID string) bool {
+	incarnation, err := g.Ping(nodeID)
+	if err == nil {
+		g.ackReceived(nodeID, incarnation)
+		return true
+	}
+
+	helpers := g.probeHelpers(nodeID)
+	if len(helpers) == 0 {
+		return false
+	}
+
+	acks := make(chan uint64, len(helpers))
+	for _, helper := range helpers {
+		go func(helper string) {
+			inc, err := g.pingReq(helper, nodeID)
+			if err != nil {
+				acks <- 0
+				return
+			}
+			// incarnations start at 0, shift by one so 0 means no ack
+			acks <- inc + 1
+		}(helper)
+	}
+
+	reached := false
+	for range helpers {
+		if inc := <-acks; inc > 0 {
+			if !reached {
+				g.ackReceived(nodeID, inc-1)
+			}
+			reached = true
+		}
+	}
+	return reached
+}
+
+// probeHelpers picks random ALIVE members (excluding us and the target) for indirect probing.
+func (g *Gossip) probeHelpers(target string) []string {
+	g.mu.RLock()
+	candidates := make([]string, 0, len(g.table))
+	for id, state := range g.table {
+		if id == g.localID || id == target || state.Health != ALIVE {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	g.mu.RUnlock()
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > INDIRECT_PROBE_FANOUT {
+		candidates = candidates[:INDIRECT_PROBE_FANOUT]
+	}
+	return candidates
+}
+
+func (g *Gossip) ackReceived(nodeID string, incarnation uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.observeLocked(nodeID, time.Now())
+	if state, ok := g.table[nodeID]; ok {
+		g.mergeLocked(state, ALIVE, incarnation)
+	}
+}
+
+// confirmSuspicion probes nodeID and only marks it SUSPECT if the probe fails.
+// At most one probe per node runs at a time.
+func (g *Gossip) confirmSuspicion(nodeID string, phi float64) {
+	g.mu.Lock()
+	if g.probing[nodeID] {
+		g.mu.Unlock()
+		return
+	}
+	g.probing[nodeID] = true
+	g.mu.Unlock()
+
+	reachable := g.probe(nodeID)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.probing, nodeID)
+
+	state, ok := g.table[nodeID]
+	if !ok || reachable || state.Health != ALIVE {
+		return
+	}
+	state.Health = SUSPECT
+	state.SuspicionCount++
+	state.Version++
+	g.publishLocked(HealthEvent{NodeID: nodeID, Health: SUSPECT, Phi: phi})
+}
+
+// HandlePing answers a direct PING from the bus.
+func (g *Gossip) HandlePing(senderID string) *pb.PingAck {
+	g.mu.Lock()
+	g.observeLocked(senderID, time.Now())
+	g.mu.Unlock()
+
+	return &pb.PingAck{Ack: true, NodeId: g.localID, Incarnation: g.LocalIncarnation()}
+}
+
+// HandlePingReq pings targetID on behalf of senderID.
+func (g *Gossip) HandlePingReq(senderID, targetID string) *pb.PingAck {
+	g.mu.Lock()
+	g.observeLocked(senderID, time.Now())
+	g.mu.Unlock()
+
+	incarnation, err := g.Ping(targetID)
+	if err != nil {
+		return &pb.PingAck{NodeId: targetID}
+	}
+	g.ackReceived(targetID, incarnation)
+	return &pb.PingAck{Ack: true, NodeId: targetID, Incarnation: incarnation}
+}
+
+// LocalIncarnation returns the current incarnation number of this node.
+func (g *Gossip) LocalIncarnation() uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if self, ok := g.table[g.localID]; ok {
+		return self.Incarnation
+	}
+	return 0
+}
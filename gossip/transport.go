@@ -0,0 +1,196 @@
+package gossip
+
+import (
+	"errors"
+	"iris/buspool"
+	"iris/serializer/pb"
+	"iris/utils"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Gossip is sent as raw protobuf datagrams over UDP on the bus port number. A datagram only
+piggybacks as many state deltas as fit in MAX_DATAGRAM_SIZE, the entries that changed most
+recently and were sent the least go first. Every ANTI_ENTROPY_ROUNDS rounds to a peer, or when
+UDP is not available, the full table is pushed over the TCP bus with the GOSSIP command instead.
+*/
+const (
+	MAX_DATAGRAM_SIZE   = 1400 // stay below the usual ethernet MTU to avoid fragmentation
+	UDP_READ_BUFFER     = 64 * 1024
+	ANTI_ENTROPY_ROUNDS = 6
+	RETRANSMIT_FACTOR   = 3 // an unchanged entry is piggybacked RETRANSMIT_FACTOR*log2(n+1) times
+)
+
+// ServeUDP receives gossip datagrams on the given port. Outgoing datagrams are sent
+// from the same socket so peers always see the bus port as source.
+func (g *Gossip) ServeUDP(port string) {
+	addr, err := net.ResolveUDPAddr("udp4", ":"+port)
+	if err != nil {
+		log.Printf("[WARN]: invalid gossip UDP port %s: %v, gossip will use TCP only\n", port, err)
+		return
+	}
+	conn, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		log.Printf("[WARN]: couldn't listen for gossip on udp:%s: %v, gossip will use TCP only\n", port, err)
+		return
+	}
+
+	g.mu.Lock()
+	g.udpConn = conn
+	g.mu.Unlock()
+	log.Printf("🚀Gossip listening at udp:%s", port)
+
+	buf := make([]byte, UDP_READ_BUFFER)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		msg := &pb.GossipMessage{}
+		if err := proto.Unmarshal(buf[:n], msg); err != nil {
+			continue
+		}
+		g.Deliver(msg)
+	}
+}
+
+// Deliver hands an incoming gossip message (from UDP or the TCP bus) to MonitorChannel.
+func (g *Gossip) Deliver(msg *pb.GossipMessage) {
+	if msg.MessageType == pb.MessageType_INTER_GOSSIP {
+		//inter(comm to other groups)
+		g.InterGossipsChan <- msg
+	} else {
+		//intra (comm within the group)
+		g.IntraGossipsChan <- msg
+	}
+}
+
+// gossipTo sends the local gossip table to nodeID. A failed round doesn't stop the
+// gossip loop, the node is probed (directly and indirectly) before anyone suspects it.
+func (g *Gossip) gossipTo(nodeID string, messageType MessageType) {
+	addr, exist := g.view.GetNodeAddr(nodeID)
+	if !exist {
+		log.Println("Beware the node is not present in the server")
+		return
+	}
+	busAddr, err := utils.BumpPort(addr, 10000)
+	if err != nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.rounds[nodeID]++
+	fullSync := g.udpConn == nil || g.rounds[nodeID]%ANTI_ENTROPY_ROUNDS == 0
+	g.mu.Unlock()
+
+	if !fullSync {
+		payload, err := g.buildDatagram(messageType)
+		if err == nil {
+			if err := g.sendUDP(busAddr, payload); err == nil {
+				return
+			}
+		}
+		// too big or UDP failed, fall back to TCP
+	}
+
+	if err := g.sendTCP(busAddr, messageType); err != nil {
+		log.Printf("[GOSSIP]: failed to reach %s: %v\n", nodeID, err)
+		go g.confirmSuspicion(nodeID, 0)
+	}
+}
+
+func (g *Gossip) sendUDP(busAddr string, payload []byte) error {
+	g.mu.RLock()
+	conn := g.udpConn
+	g.mu.RUnlock()
+	if conn == nil {
+		return errors.New("gossip UDP socket not running")
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp4", busAddr)
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteToUDP(payload, raddr)
+	return err
+}
+
+// sendTCP pushes the full gossip table over the bus, used for anti-entropy and large payloads.
+func (g *Gossip) sendTCP(busAddr string, messageType MessageType) error {
+	data := g.newMessage(messageType, g.ToGossipStates())
+	return buspool.Call(busAddr, pb.BusCommand_GOSSIP, data, nil, time.Second*3)
+}
+
+func (g *Gossip) newMessage(messageType MessageType, states []*pb.NodeState) *pb.GossipMessage {
+	return &pb.GossipMessage{
+		MessageType:    pb.MessageType(messageType),
+		SenderId:       g.localID,
+		States:         states,
+		ClusterVersion: g.view.GetClusterVersion(),
+		MetadataHash:   g.view.MetadataHash(),
+	}
+}
+
+// buildDatagram encodes a gossip message that fits in MAX_DATAGRAM_SIZE. The local node is
+// always included, the remaining space goes to the entries piggybacked the least since they
+// last changed. Entries that were retransmitted often enough are left to the full sync.
+func (g *Gossip) buildDatagram(messageType MessageType) ([]byte, error) {
+	msg := g.newMessage(messageType, nil)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.beatLocked()
+	limit := int(math.Ceil(RETRANSMIT_FACTOR * math.Log2(float64(len(g.table)+1))))
+
+	candidates := make([]*NodeState, 0, len(g.table))
+	for id, state := range g.table {
+		if state.Version != state.gossipedVersion || state.Heartbeat != state.gossipedHeartbeat {
+			state.gossipedVersion = state.Version
+			state.gossipedHeartbeat = state.Heartbeat
+			state.gossipCount = 0
+		}
+		if id != g.localID && state.gossipCount >= limit {
+			continue
+		}
+		candidates = append(candidates, state)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].NodeID == g.localID {
+			return true
+		}
+		if candidates[j].NodeID == g.localID {
+			return false
+		}
+		return candidates[i].gossipCount < candidates[j].gossipCount
+	})
+
+	size := proto.Size(msg)
+	for _, state := range candidates {
+		st := ToNodeStateProtobuf(state)
+		// field tag + length prefix of the embedded message
+		entrySize := proto.Size(st) + 1 + protowire.SizeVarint(uint64(proto.Size(st)))
+		if size+entrySize > MAX_DATAGRAM_SIZE {
+			if len(msg.States) == 0 {
+				return nil, errors.New("gossip entry doesn't fit in a datagram")
+			}
+			break
+		}
+		msg.States = append(msg.States, st)
+		state.gossipCount++
+		size += entrySize
+	}
+
+	return proto.Marshal(msg)
+}
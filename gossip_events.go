@@ -0,0 +1,86 @@
+package main
+
+import (
+	"iris/config"
+	"iris/engine"
+	"iris/gossip"
+	"log"
+	"time"
+)
+
+// WireGossipMembership forwards membership changes of the cluster metadata (COMMIT,
+// LEAVE, evictions and applied snapshots) to gossip, so its table follows the metadata.
+func WireGossipMembership(server *config.Server, g *gossip.Gossip) {
+	server.SetMembershipHook(func(joined []config.Node, left []string) {
+		for _, node := range joined {
+			g.JoinEvents <- gossip.NodeState{
+				NodeID:   node.ServerID,
+				Group:    node.Group,
+				Health:   gossip.ALIVE,
+				LastSeen: time.Now(),
+			}
+		}
+		for _, id := range left {
+			g.DeadEvents <- id
+		}
+	})
+}
+
+// WatchGossipHealth consumes the health transitions of the gossip failure detector.
+// Nodes this server considers SUSPECT or DEAD are added to the UNREACHABLE list of
+// its heartbeat, which is how the master learns about them. DEAD nodes are also
+// reported to the master right away.
+func WatchGossipHealth(server *config.Server, g *gossip.Gossip) {
+	for ev := range g.HealthEvents {
+		switch ev.Health {
+		case gossip.SUSPECT, gossip.DEAD:
+			log.Printf("[GOSSIP]: reporting %s as unreachable (%s, phi=%.2f)\n", ev.NodeID, ev.Health, ev.Phi)
+			server.MarkUnreachable(ev.NodeID)
+			if ev.Health == gossip.DEAD {
+				go func(nodeID string) {
+					if err := server.ReportDeadNode(nodeID); err != nil {
+						log.Printf("[WARN]: failed to report %s to the master: %v\n", nodeID, err)
+					}
+				}(ev.NodeID)
+			}
+		case gossip.ALIVE:
+			server.ClearUnreachable(ev.NodeID)
+		}
+	}
+}
+
+// WatchGossipMetadata pulls the cluster snapshot whenever gossip reveals that a peer
+// has newer metadata, so changes reach every node even when the master is down.
+func WatchGossipMetadata(server *config.Server, g *gossip.Gossip, IrisDb *engine.Engine) {
+	for ev := range g.MetadataEvents {
+		var err error
+		if ev.Diverged {
+			// same version, different content: the master's view wins
+			if server.GetMasterNodeID() == server.ServerID {
+				continue
+			}
+			server.GlobalPause.Store(true)
+			err = server.RequestMetadataSnapShot()
+			server.GlobalPause.Store(false)
+		} else {
+			if ev.ClusterVersion <= server.GetClusterVersion() {
+				continue
+			}
+			server.GlobalPause.Store(true)
+			err = server.RequestMetadataSnapShotFrom(ev.NodeID)
+			if err != nil {
+				log.Printf("[WARN]: failed to pull metadata from %s: %v, trying the master\n", ev.NodeID, err)
+				err = server.RequestMetadataSnapShot()
+			}
+			server.GlobalPause.Store(false)
+		}
+
+		if err != nil {
+			log.Printf("[WARN]: failed to sync metadata announced by %s (version %d): %v\n", ev.NodeID, ev.ClusterVersion, err)
+			continue
+		}
+		if err := IrisDb.SaveServerMetadata(server); err != nil {
+			log.Printf("[WARN] Failed to save server config after metadata sync: %v", err)
+		}
+	}
+}
@@ -1,29 +1,28 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
 	"errors"
 	"iris/config"
 	"iris/engine"
 	"log"
-
-	"github.com/cockroachdb/pebble"
 )
 
+// CheckAndLoadMetadata restores the node from the metadata it persisted. A record in an
+// older format is migrated and written back in the current one.
 func CheckAndLoadMetadata(e *engine.Engine) (*config.Server, error) {
-	data, err := e.Get("config:server:metadata")
+	server, version, err := e.LoadServerMetadata()
 	if err != nil {
-		if err == pebble.ErrNotFound {
+		if errors.Is(err, config.ErrNoMetadata) {
 			log.Printf("[INFO]: No Saved Metadata Found\n")
-			// call config.NewServer() here if no saved metadata found!!
-			return nil, errors.New("no saved Metadata")
 		}
+		return nil, err
 	}
 
-	var server config.Server
-	if err := gob.NewDecoder(bytes.NewReader([]byte(data))).Decode(&server); err != nil {
-		return nil, err
+	if version < config.METADATA_VERSION {
+		log.Printf("[INFO]: migrated node metadata from version %d to %d\n", version, config.METADATA_VERSION)
+		if err := e.SaveServerMetadata(server); err != nil {
+			log.Printf("[WARN]: failed to write the migrated node metadata: %v\n", err)
+		}
 	}
-	return &server, nil
+	return server, nil
 }
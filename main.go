@@ -2,16 +2,20 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"io"
 	"log"
 	"net"
 	"strings"
+	"time"
 
 	"iris/bus"
+	"iris/buspool"
 	"iris/config"
 	"iris/engine"
 	"iris/gossip"
+	"iris/replication"
 	"iris/utils"
 )
 
@@ -23,6 +27,7 @@ func main() {
 	clusterAddr := flag.String("cluster_server", "", "Address of a server in the cluster to join (optional)")
 	node_group := flag.String("node_group", "", " Group of the node, eg: asia-ind, eu-west, us-east")
 	config_file := flag.String("config_file", "", "Path to server config file(optional)")
+	migrate_storage := flag.Bool("migrate_storage", false, "Convert the data directory to the slot-prefixed key encoding and exit")
 	flag.Parse()
 
 	var configData *utils.Config
@@ -36,19 +41,43 @@ func main() {
 		configData = &utils.Config{}
 	}
 
-	IrisDb, err := engine.NewEngine(configData.RocksDBPath)
+	IrisDb, err := engine.OpenEngine(configData)
 	if err != nil {
-		log.Fatalf("Failed to init Pebble DB: %v", err)
+		log.Fatalf("Failed to init the storage: %v", err)
 	}
 	defer IrisDb.Close()
+	IrisDb.ConfigureDurability(configData.Durability, time.Duration(configData.DurabilitySyncIntervalMs)*time.Millisecond)
+	IrisDb.ConfigureCompression(configData.Compression, configData.CompressionMinSize)
+	if *migrate_storage {
+		moved, err := IrisDb.MigrateKeyEncoding()
+		if err != nil {
+			log.Fatalf("[ERROR]: storage migration stopped after %d keys: %v. Run it again to continue.\n", moved, err)
+		}
+		log.Printf("[INFO]: storage migration done, %d keys moved\n", moved)
+		return
+	}
+	if err := IrisDb.CheckStorageFormat(); err != nil {
+		log.Fatalf("[ERROR]: can't use the data directory: %v\n", err)
+	}
+	if err := IrisDb.CheckEncryption(); err != nil {
+		log.Fatalf("[ERROR]: can't use the data directory: %v\n", err)
+	}
+	if IrisDb.Keys != nil {
+		config.AddLocalCapability(config.CAP_SEALED_VALUES)
+	}
 	var server *config.Server
 	loaded_data, err := CheckAndLoadMetadata(IrisDb)
-	if err == nil {
+	switch {
+	case err == nil:
 		server = loaded_data
+		server.ConfigureFailureDetection(configData)
 		log.Printf("[INFO] Loaded server config from database. ServerID: %s\n", server.ServerID)
-	} else {
+	case errors.Is(err, config.ErrNoMetadata):
 		server = config.NewServer(configData, node_group)
 		log.Printf("[INFO] Created new server config. ServerID: %s\n", server.ServerID)
+	default:
+		// starting as a new node would orphan the data of this one, let the operator decide
+		log.Fatalf("[ERROR]: can't restore the node from %s: %v. Repair or delete the key (or the data directory) to start as a new node.\n", config.METADATA_KEY, err)
 	}
 
 	// IMPORTANT: Always refresh the Host field with current machine IP
@@ -77,9 +106,23 @@ func main() {
 	log.Printf("🌐Host IP:%s | Addr:%s | Bus Port:%s\n", server.Host, server.Addr, server.BusPort)
 	log.Printf("📊Cluster Info - Version: %d, Nodes: %d, Slot Ranges: %d\n", server.Cluster_Version, server.Nnode, server.GetSlotRangeCount())
 	gossip := gossip.NewGossip(server)
+	gossip.SetPhiThresholds(configData.PhiSuspectThreshold, configData.PhiDeadThreshold)
 	IrisDb.Gossip = gossip
+	IrisDb.Async = replication.NewAsyncReplicator(server)
+	IrisDb.Async.SetResync(func(nodeID string) error { return IrisDb.ResyncAsyncReplica(server, nodeID) })
+	IrisDb.Stream = replication.NewBatchReplicator(server)
+	IrisDb.Stream.SetResync(func(nodeID string) error { return IrisDb.ResyncSyncReplica(server, nodeID) })
+	IrisDb.MaxReadStaleness = time.Duration(configData.MaxReadStalenessMs) * time.Millisecond
+	IrisDb.GC = engine.NewRangeGC(IrisDb, server, time.Duration(configData.GCGracePeriod)*time.Second, configData.GCDryRun)
+	IrisDb.Repair = engine.NewValueRepair(IrisDb, server)
+	// exchange protocol versions and capabilities on every new bus connection
+	buspool.Default.SetHandshake(server.Hello, server.RecordHello)
 	Bus := bus.NewBus(server, IrisDb, gossip)
 	go Bus.NewBusRoute()
+	go buspool.Default.HealthCheck()
+	// before the join, so the nodes it brings in reach the gossip table
+	WireGossipMembership(server, gossip)
+	go gossip.MonitorChannel()
 
 	// Determine cluster address: flag takes precedence, then config file
 	clusterAddrToUse := *clusterAddr
@@ -96,11 +139,21 @@ func main() {
 		}
 	}
 
+	go gossip.ServeUDP(server.BusPort)
+	go gossip.DetectFailures()
+	go WatchGossipHealth(server, gossip)
+	go WatchGossipMetadata(server, gossip, IrisDb)
 	go gossip.InterGossip()
 	go gossip.IntraGossip()
 
 	// Start replica validator AFTER cluster metadata is loaded
 	go ReplicaValidatorMiddleware(server, IrisDb)
+	go FailureDetectorMiddleware(server, IrisDb)
+	go IrisDb.Async.MarkOffsets()
+	go IrisDb.Stream.MarkOffsets()
+	go PartitionMonitorMiddleware(server, IrisDb)
+	go IrisDb.GC.Run()
+	go IrisDb.Repair.Run()
 
 	go server.Heartbeat()
 	for {
@@ -122,6 +175,7 @@ func main() {
 func handleConnection(conn net.Conn, db *engine.Engine, server *config.Server) {
 	defer server.Wg.Done()
 	defer conn.Close()
+	defer db.CloseSession(conn)
 	reader := bufio.NewReader(conn)
 	for {
 		line, err := reader.ReadString('\n')
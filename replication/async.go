@@ -0,0 +1,433 @@
+package replication
+
+import (
+	"errors"
+	"iris/config"
+	"iris/serializer/pb"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Asynchronous cross-group replication.
+
+Ranges with AsyncCrossGroup set only replicate synchronously to the replicas in the group
+(datacenter) of their master. Replicas in other groups are fed by a per-replica stream:
+the write is queued here and a background sender ships the REP commands in order, retrying
+until the replica acknowledges them. The SET returns as soon as the local group has it.
+
+Every queued command gets a sequence number, the replica acknowledges them in order.
+Consecutive REP commands are shipped together as one REP_BATCH (see batch.go). The
+number of unacknowledged commands and the age of the oldest one are the lag of the replica,
+Lag() aggregates them per remote group.
+
+Every ASYNC_OFFSET_INTERVAL the master also queues an offset marker into each stream:
+
+	REPL_OFFSET ReplicationOffset{master_id, seq, master_unix_ms, dropped}
+
+Since the stream is applied in order, a replica that applied the marker has every write the
+master made before <master_unix_ms>, unless <dropped> writes were dropped from the stream
+since the replica was last resynced. The replica uses the last marker to bound how stale
+its copy is when serving follower reads, see Staleness.
+
+A stream holds at most ASYNC_QUEUE_LIMIT commands, the oldest are dropped past it. The replica
+then misses writes: it is resynced with range transfers of the ranges it replicates from this
+master (the resync hook, see SetResync), attempted every ASYNC_RESYNC_INTERVAL until one
+completes without more writes dropped meanwhile. Lag() counts the replicas being resynced.
+*/
+
+const (
+	ASYNC_QUEUE_LIMIT     = 100000 // commands kept per replica before the oldest are dropped
+	ASYNC_RETRY_INTERVAL  = 1 * time.Second
+	ASYNC_OFFSET_INTERVAL = 1 * time.Second
+	ASYNC_RESYNC_INTERVAL = 5 * time.Second
+)
+
+type entry struct {
+	seq      uint64
+	command  pb.BusCommand
+	msg      proto.Message
+	queuedAt time.Time
+	marker   bool
+}
+
+// offset is the last REPL_OFFSET marker a replica applied from a master.
+type offset struct {
+	seq        uint64
+	masterTime time.Time
+	dropped    uint64
+}
+
+type stream struct {
+	nodeID string
+
+	mu        sync.Mutex
+	pending   []entry
+	lastSeq   uint64 // last queued command
+	ackedSeq  uint64 // last command acknowledged by the replica
+	dropped   uint64
+	unsynced  uint64 // dropped since the replica was last resynced
+	resyncing bool
+	notify    chan struct{}
+}
+
+// GroupLag is the replication lag of all the async replicas in one remote group.
+type GroupLag struct {
+	Group     string
+	Replicas  int
+	Pending   uint64        // commands queued but not yet acknowledged
+	Lag       time.Duration // age of the oldest unacknowledged command
+	Dropped   uint64        // commands lost because a queue overflowed
+	Resyncing int           // replicas missing dropped commands until their resync completes
+}
+
+type AsyncReplicator struct {
+	server *config.Server
+
+	mu      sync.Mutex
+	streams map[string]*stream
+	applied map[string]offset // master ID -> last marker applied on this replica
+	resync  func(nodeID string) error
+}
+
+func NewAsyncReplicator(server *config.Server) *AsyncReplicator {
+	return &AsyncReplicator{
+		server:  server,
+		streams: make(map[string]*stream),
+		applied: make(map[string]offset),
+	}
+}
+
+// SetResync sets the hook sending a replica again the ranges it replicates from this node,
+// before the first write is queued.
+func (r *AsyncReplicator) SetResync(resync func(nodeID string) error) {
+	r.resync = resync
+}
+
+// Enqueue queues a replication command for nodeID, the sender for the node is started on first use.
+func (r *AsyncReplicator) Enqueue(nodeID string, command pb.BusCommand, msg proto.Message) {
+	st := r.streamFor(nodeID)
+
+	st.mu.Lock()
+	st.lastSeq++
+	st.pending = append(st.pending, entry{seq: st.lastSeq, command: command, msg: msg, queuedAt: time.Now()})
+	r.trimLocked(st)
+	st.mu.Unlock()
+
+	st.wake()
+}
+
+// trimLocked drops the oldest commands once the queue is over ASYNC_QUEUE_LIMIT and starts
+// the resync of the replica. Caller must hold st.mu.
+func (r *AsyncReplicator) trimLocked(st *stream) {
+	if len(st.pending) > ASYNC_QUEUE_LIMIT {
+		overflow := len(st.pending) - ASYNC_QUEUE_LIMIT
+		if st.unsynced == 0 {
+			log.Printf("[WARN]: async replication queue of %s is full, dropping the oldest writes and resyncing the replica\n", st.nodeID)
+		}
+		st.dropped += uint64(overflow)
+		st.unsynced += uint64(overflow)
+		st.pending = st.pending[overflow:]
+		if !st.resyncing {
+			st.resyncing = true
+			go r.resyncReplica(st)
+		}
+	}
+}
+
+// resyncReplica sends the replica of st its ranges again until a transfer completes
+// without writes dropped meanwhile, or the replica leaves the cluster.
+func (r *AsyncReplicator) resyncReplica(st *stream) {
+	for {
+		st.mu.Lock()
+		unsynced := st.unsynced
+		st.mu.Unlock()
+
+		err := errors.New("no resync hook")
+		if r.resync != nil {
+			err = r.resync(st.nodeID)
+		}
+
+		st.mu.Lock()
+		if err == nil && st.unsynced == unsynced {
+			st.unsynced = 0
+			st.resyncing = false
+			st.mu.Unlock()
+			log.Printf("[INFO]: async replica %s resynced after %d dropped writes\n", st.nodeID, unsynced)
+			return
+		}
+		st.mu.Unlock()
+
+		if err != nil {
+			log.Printf("[WARN]: resync of async replica %s failed: %v\n", st.nodeID, err)
+		}
+		if !r.server.HasNode(st.nodeID) {
+			return
+		}
+		time.Sleep(ASYNC_RESYNC_INTERVAL)
+	}
+}
+
+func (st *stream) wake() {
+	select {
+	case st.notify <- struct{}{}:
+	default:
+	}
+}
+
+// MarkOffsets periodically queues an offset marker for every async replica of the
+// ranges mastered by this node.
+func (r *AsyncReplicator) MarkOffsets() {
+	for {
+		time.Sleep(ASYNC_OFFSET_INTERVAL)
+
+		targets := make(map[string]bool)
+		for _, sr := range r.server.GetServerMetadata() {
+			if sr.MasterID != r.server.ServerID || !sr.AsyncCrossGroup {
+				continue
+			}
+			_, async := r.server.SplitReplicasByGroup(&sr)
+			for _, id := range async {
+				targets[id] = true
+			}
+		}
+
+		for id := range targets {
+			r.enqueueMarker(id)
+		}
+	}
+}
+
+func (r *AsyncReplicator) enqueueMarker(nodeID string) {
+	st := r.streamFor(nodeID)
+
+	st.mu.Lock()
+	now := time.Now()
+	if n := len(st.pending); n > 0 && st.pending[n-1].marker {
+		// the replica hasn't caught up with the previous marker, move it forward instead of queueing another.
+		// The message is replaced rather than updated, the sender may be encoding the old one.
+		st.pending[n-1].msg = r.offsetMarker(st, st.pending[n-1].seq, now)
+		st.mu.Unlock()
+		return
+	}
+	st.lastSeq++
+	msg := r.offsetMarker(st, st.lastSeq, now)
+	st.pending = append(st.pending, entry{seq: st.lastSeq, command: pb.BusCommand_REPL_OFFSET, msg: msg, queuedAt: now, marker: true})
+	r.trimLocked(st)
+	st.mu.Unlock()
+
+	st.wake()
+}
+
+// offsetMarker builds a marker of st. Caller must hold st.mu.
+func (r *AsyncReplicator) offsetMarker(st *stream, seq uint64, now time.Time) *pb.ReplicationOffset {
+	return &pb.ReplicationOffset{MasterId: r.server.ServerID, Seq: seq, MasterUnixMs: now.UnixMilli(), Dropped: st.unsynced}
+}
+
+// ObserveOffset records an offset marker applied on this replica.
+func (r *AsyncReplicator) ObserveOffset(masterID string, seq uint64, masterTime time.Time, dropped uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.applied[masterID]; ok && current.masterTime.After(masterTime) {
+		return
+	}
+	r.applied[masterID] = offset{seq: seq, masterTime: masterTime, dropped: dropped}
+}
+
+// Staleness returns how far this replica may be behind masterID: every write the master
+// made more than the returned duration ago has been applied here. Returns false if no
+// marker from masterID was applied yet, or if the last one reports dropped writes: the
+// replica is missing them until the master resynced it. Clock skew between the nodes adds
+// to the bound.
+func (r *AsyncReplicator) Staleness(masterID string) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	off, ok := r.applied[masterID]
+	if !ok || off.dropped > 0 {
+		return 0, false
+	}
+	staleness := time.Since(off.masterTime)
+	if staleness < 0 {
+		staleness = 0
+	}
+	return staleness, true
+}
+
+// ReplicaOffset is the last offset marker a replica applied from one master.
+type ReplicaOffset struct {
+	MasterID  string
+	Seq       uint64
+	Staleness time.Duration
+	Dropped   uint64
+}
+
+// AppliedOffsets returns the offsets this replica applied, sorted by master ID.
+func (r *AsyncReplicator) AppliedOffsets() []ReplicaOffset {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	offsets := make([]ReplicaOffset, 0, len(r.applied))
+	for id, off := range r.applied {
+		offsets = append(offsets, ReplicaOffset{MasterID: id, Seq: off.seq, Staleness: time.Since(off.masterTime), Dropped: off.dropped})
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i].MasterID < offsets[j].MasterID })
+	return offsets
+}
+
+func (r *AsyncReplicator) streamFor(nodeID string) *stream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.streams[nodeID]
+	if !ok {
+		st = &stream{nodeID: nodeID, notify: make(chan struct{}, 1)}
+		r.streams[nodeID] = st
+		go r.run(st)
+	}
+	return st
+}
+
+// run ships the queued commands of one replica in order. It stops once the
+// replica is no longer part of the cluster.
+func (r *AsyncReplicator) run(st *stream) {
+	for {
+		st.mu.Lock()
+		if len(st.pending) == 0 {
+			st.mu.Unlock()
+			select {
+			case <-st.notify:
+			case <-time.After(ASYNC_RETRY_INTERVAL):
+			}
+			if !r.server.HasNode(st.nodeID) {
+				r.remove(st)
+				return
+			}
+			continue
+		}
+		head := st.pending[0]
+		batch := r.batchLocked(st)
+		st.mu.Unlock()
+
+		lastSeq := head.seq
+		sent := false
+		if len(batch) > 1 {
+			sent = r.sendBatch(st, head.seq, batch)
+			lastSeq = head.seq + uint64(len(batch)) - 1
+		} else {
+			sent = r.server.SendReplicaCMD(head.command, head.msg, st.nodeID)
+		}
+		if !sent {
+			if !r.server.HasNode(st.nodeID) {
+				r.remove(st)
+				return
+			}
+			time.Sleep(ASYNC_RETRY_INTERVAL)
+			continue
+		}
+
+		st.mu.Lock()
+		// the queue may have been trimmed while sending
+		for len(st.pending) > 0 && st.pending[0].seq <= lastSeq {
+			st.pending = st.pending[1:]
+		}
+		st.ackedSeq = lastSeq
+		st.mu.Unlock()
+	}
+}
+
+// batchLocked returns the REP commands at the head of the queue, up to the next offset
+// marker, to be sent as one REP_BATCH. Empty while some node doesn't support REP_BATCH.
+// Caller must hold st.mu.
+func (r *AsyncReplicator) batchLocked(st *stream) []*pb.ReplicateRequest {
+	if !r.server.ClusterSupports(config.CAP_BATCH_REPLICATION) {
+		return nil
+	}
+	batch := []*pb.ReplicateRequest{}
+	for _, e := range st.pending {
+		rep, ok := e.msg.(*pb.ReplicateRequest)
+		if e.marker || !ok || len(batch) == REPL_BATCH_MAX_ENTRIES {
+			break
+		}
+		batch = append(batch, rep)
+	}
+	return batch
+}
+
+func (r *AsyncReplicator) sendBatch(st *stream, firstSeq uint64, entries []*pb.ReplicateRequest) bool {
+	batch := &pb.ReplicateBatch{MasterId: r.server.ServerID, FirstSeq: firstSeq, Entries: entries}
+	var ack pb.ReplicateBatchAck
+	err := r.server.CallReplica(st.nodeID, pb.BusCommand_REP_BATCH, batch, &ack, REPL_BATCH_TIMEOUT)
+	if err == nil && ack.AckedSeq != firstSeq+uint64(len(entries))-1 {
+		err = ErrBatchRejected
+	}
+	if err != nil {
+		log.Printf("[WARN]: async replication batch to %s failed: %v\n", st.nodeID, err)
+		return false
+	}
+	return true
+}
+
+func (r *AsyncReplicator) remove(st *stream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.streams[st.nodeID] == st {
+		delete(r.streams, st.nodeID)
+	}
+	st.mu.Lock()
+	if len(st.pending) > 0 {
+		log.Printf("[WARN]: %s left the cluster with %d async writes not replicated\n", st.nodeID, len(st.pending))
+	}
+	st.mu.Unlock()
+}
+
+// Lag returns the replication lag per remote group, sorted by group name.
+func (r *AsyncReplicator) Lag() []GroupLag {
+	r.mu.Lock()
+	streams := make([]*stream, 0, len(r.streams))
+	for _, st := range r.streams {
+		streams = append(streams, st)
+	}
+	r.mu.Unlock()
+
+	now := time.Now()
+	groups := make(map[string]*GroupLag)
+	for _, st := range streams {
+		node, ok := r.server.GetConnectedNodeData(st.nodeID)
+		if !ok {
+			continue
+		}
+		gl, ok := groups[node.Group]
+		if !ok {
+			gl = &GroupLag{Group: node.Group}
+			groups[node.Group] = gl
+		}
+
+		st.mu.Lock()
+		gl.Replicas++
+		gl.Pending += uint64(len(st.pending))
+		gl.Dropped += st.dropped
+		if st.unsynced > 0 {
+			gl.Resyncing++
+		}
+		if len(st.pending) > 0 {
+			if lag := now.Sub(st.pending[0].queuedAt); lag > gl.Lag {
+				gl.Lag = lag
+			}
+		}
+		st.mu.Unlock()
+	}
+
+	lags := make([]GroupLag, 0, len(groups))
+	for _, gl := range groups {
+		lags = append(lags, *gl)
+	}
+	sort.Slice(lags, func(i, j int) bool { return lags[i].Group < lags[j].Group })
+	return lags
+}
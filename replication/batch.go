@@ -0,0 +1,523 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"iris/buspool"
+	"iris/config"
+	"iris/serializer/pb"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Batched synchronous replication.
+
+Writes to the replicas in the group of the master go through a per-replica stream instead
+of one REP per write. Enqueue appends the write to the batch being filled for the replica,
+a batch is closed at REPL_BATCH_MAX_ENTRIES writes or REPL_BATCH_MAX_BYTES. The sender ships
+it as
+
+	REP_BATCH ReplicateBatch{master_id, first_seq, entries, stream_id, acked_seq}
+
+and the replica applies all the entries in one pebble batch, committed with a single sync.
+The replica answers with one cumulative ReplicateBatchAck{acked_seq}: every entry up to
+acked_seq is durable on the replica.
+
+Up to REPL_BATCH_MAX_INFLIGHT batches per replica are on the wire at the same time over the
+multiplexed bus connection. While they are, new writes pile up in the next batch, so the
+busier the master the bigger the batches. An idle stream sends a write right away.
+
+Batches may be applied out of order on the replica when several are in flight, the values
+carry their HLC timestamp and are applied last-writer-wins, so the outcome is the same.
+
+A batch that fails fails the writes waiting on it. One lost on the way (a transport error)
+is sent again every REPL_BATCH_RETRY_INTERVAL, up to REPL_BATCH_MAX_ATTEMPTS times. One the
+replica refused, or acknowledged with another sequence number, would be refused again: it is
+given up right away, like a batch out of attempts. The replica then misses writes, it is
+resynced with range transfers of the ranges it replicates from this master (the resync hook,
+see SetResync), attempted every REPL_BATCH_RESYNC_INTERVAL until one completes without more
+batches given up meanwhile. Until then the cumulative ack stays below the first write given
+up. A batch given up because the replica left holds the ack for good.
+
+Every batch carries the ID of its stream and the cumulative ack of the master, the replica
+tracks the writes it applied without a gap. Every ASYNC_OFFSET_INTERVAL the master also sends
+each replica in the group of its ranges an offset marker, straight rather than queued:
+
+	REPL_OFFSET ReplicationOffset{master_id, seq, master_unix_ms, stream_id, acked_seq}
+
+seq is the last write queued for the replica at master_unix_ms. A replica that applied every
+write up to seq has all the writes the master made before master_unix_ms, Staleness bounds
+its copy with the last such marker. A replica missing a batch, or cut off from the master,
+stops moving it forward and turns stale like an async replica.
+*/
+
+const (
+	REPL_BATCH_MAX_ENTRIES     = 1024
+	REPL_BATCH_MAX_BYTES       = 4 * 1024 * 1024
+	REPL_BATCH_MAX_INFLIGHT    = 4
+	REPL_BATCH_TIMEOUT         = 10 * time.Second
+	REPL_BATCH_RETRY_INTERVAL  = 1 * time.Second
+	REPL_BATCH_MAX_ATTEMPTS    = 5
+	REPL_BATCH_RESYNC_INTERVAL = 5 * time.Second
+	REPL_BATCH_IDLE_TIMEOUT    = 1 * time.Minute // an idle stream is dropped once its replica left
+)
+
+var ErrBatchRejected = errors.New("replica acknowledged a different sequence number")
+
+// Pending is the outcome of a write queued with Enqueue, shared by every write of a batch.
+type Pending struct {
+	done chan struct{}
+	err  error
+}
+
+// Wait blocks until the replica acknowledged the batch of the write or the batch failed.
+func (p *Pending) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// queuedBatch is a batch waiting for a free in-flight slot, the last one is still filled.
+type queuedBatch struct {
+	firstSeq uint64
+	entries  []*pb.ReplicateRequest
+	bytes    int
+	pending  *Pending // nil once the writes got the outcome
+	retry    bool     // sent before and failed, no write is added to it
+	attempts int
+}
+
+// report hands the outcome of the first attempt to the writes waiting on the batch.
+func (qb *queuedBatch) report(err error) {
+	if qb.pending == nil {
+		return
+	}
+	qb.pending.err = err
+	close(qb.pending.done)
+	qb.pending = nil
+}
+
+type batchStream struct {
+	nodeID string
+	id     uint64 // random, a new stream starts over on the replica
+
+	mu        sync.Mutex
+	queued    []*queuedBatch
+	lastSeq   uint64 // last queued write
+	ackedSeq  uint64 // every write up to it was acknowledged
+	lostSeq   uint64 // first write of the oldest batch given up, 0 if none
+	unsynced  int    // batches given up since the replica was last resynced
+	resyncing bool
+	inflight  map[uint64]uint64 // first seq -> last seq of the batches on the wire
+	notify    chan struct{}
+	slots     chan struct{} // REPL_BATCH_MAX_INFLIGHT tokens
+	removed   bool
+}
+
+type BatchReplicator struct {
+	server *config.Server
+	resync func(nodeID string) error
+
+	mu       sync.Mutex
+	streams  map[string]*batchStream
+	progress map[string]*syncProgress // master ID -> batches applied on this replica
+}
+
+// syncProgress is what this replica applied of the stream of one master.
+type syncProgress struct {
+	streamID uint64
+	next     uint64            // every write before it was applied
+	ahead    map[uint64]uint64 // first seq -> last seq of the batches applied past a missing one
+	freshAt  time.Time         // master time of the last marker covered by next
+}
+
+func NewBatchReplicator(server *config.Server) *BatchReplicator {
+	return &BatchReplicator{
+		server:   server,
+		streams:  make(map[string]*batchStream),
+		progress: make(map[string]*syncProgress),
+	}
+}
+
+// SetResync sets the hook sending a replica its ranges again once a batch to it was given up.
+func (r *BatchReplicator) SetResync(resync func(nodeID string) error) {
+	r.resync = resync
+}
+
+// Enqueue adds a write to the stream of nodeID, the sender for the node is started on first use.
+func (r *BatchReplicator) Enqueue(nodeID string, rep *pb.ReplicateRequest) *Pending {
+	size := len(rep.Key) + len(rep.Value)
+
+	st := r.streamFor(nodeID)
+	st.mu.Lock()
+	for st.removed {
+		// the sender of this stream stopped, start over with a new one
+		st.mu.Unlock()
+		st = r.streamFor(nodeID)
+		st.mu.Lock()
+	}
+	st.lastSeq++
+	var qb *queuedBatch
+	if n := len(st.queued); n > 0 {
+		qb = st.queued[n-1]
+	}
+	if qb == nil || qb.retry || len(qb.entries) >= REPL_BATCH_MAX_ENTRIES || qb.bytes+size > REPL_BATCH_MAX_BYTES {
+		qb = &queuedBatch{firstSeq: st.lastSeq, pending: &Pending{done: make(chan struct{})}}
+		st.queued = append(st.queued, qb)
+	}
+	qb.entries = append(qb.entries, rep)
+	qb.bytes += size
+	pending := qb.pending
+	st.mu.Unlock()
+
+	st.wake()
+	return pending
+}
+
+func (st *batchStream) wake() {
+	select {
+	case st.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *BatchReplicator) streamFor(nodeID string) *batchStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.streams[nodeID]
+	if !ok {
+		st = &batchStream{
+			nodeID:   nodeID,
+			id:       rand.Uint64() | 1,
+			inflight: make(map[uint64]uint64),
+			notify:   make(chan struct{}, 1),
+			slots:    make(chan struct{}, REPL_BATCH_MAX_INFLIGHT),
+		}
+		r.streams[nodeID] = st
+		go r.run(st)
+	}
+	return st
+}
+
+// take removes the oldest queued batch from the stream and marks it in flight.
+func (st *batchStream) take() *queuedBatch {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.queued) == 0 {
+		return nil
+	}
+	qb := st.queued[0]
+	st.queued = st.queued[1:]
+	st.inflight[qb.firstSeq] = qb.firstSeq + uint64(len(qb.entries)) - 1
+	return qb
+}
+
+// run hands the batches of one replica to the senders, at most REPL_BATCH_MAX_INFLIGHT
+// at a time. It stops once the stream is idle and the replica left the cluster.
+func (r *BatchReplicator) run(st *batchStream) {
+	for {
+		select {
+		case <-st.notify:
+		case <-time.After(REPL_BATCH_IDLE_TIMEOUT):
+			if !r.server.HasNode(st.nodeID) && r.remove(st) {
+				return
+			}
+			continue
+		}
+
+		for {
+			st.slots <- struct{}{}
+			qb := st.take()
+			if qb == nil {
+				<-st.slots
+				break
+			}
+			go func() {
+				defer func() { <-st.slots }()
+				r.send(st, qb)
+			}()
+		}
+	}
+}
+
+// send ships one batch and reports the outcome to the writes waiting on it. A failed batch
+// is queued again or given up, see retry.
+func (r *BatchReplicator) send(st *batchStream, qb *queuedBatch) {
+	st.mu.Lock()
+	batch := &pb.ReplicateBatch{MasterId: r.server.ServerID, FirstSeq: qb.firstSeq, Entries: qb.entries, StreamId: st.id, AckedSeq: st.ackedSeq}
+	st.mu.Unlock()
+	lastSeq := qb.firstSeq + uint64(len(qb.entries)) - 1
+
+	var ack pb.ReplicateBatchAck
+	err := r.server.CallReplica(st.nodeID, pb.BusCommand_REP_BATCH, batch, &ack, REPL_BATCH_TIMEOUT)
+	if err == nil && ack.AckedSeq != lastSeq {
+		err = fmt.Errorf("%w: sent %d-%d, acked %d", ErrBatchRejected, batch.FirstSeq, lastSeq, ack.AckedSeq)
+	}
+	if err != nil {
+		log.Printf("[WARN]: replication batch %d-%d to %s failed: %v\n", batch.FirstSeq, lastSeq, st.nodeID, err)
+		qb.report(err)
+		r.retry(st, qb, rejected(err))
+		return
+	}
+
+	st.mu.Lock()
+	delete(st.inflight, batch.FirstSeq)
+	// cumulative: everything before the oldest batch still on the wire, queued or lost is done
+	acked := lastSeq
+	if len(st.queued) > 0 {
+		acked = min(acked, st.queued[0].firstSeq-1)
+	}
+	for first := range st.inflight {
+		acked = min(acked, first-1)
+	}
+	if st.lostSeq > 0 {
+		acked = min(acked, st.lostSeq-1)
+	}
+	if acked > st.ackedSeq {
+		st.ackedSeq = acked
+	}
+	st.mu.Unlock()
+
+	qb.report(nil)
+}
+
+// rejected tells whether a batch reached the replica and was refused there, sending it
+// again would be refused the same way.
+func rejected(err error) bool {
+	var remoteErr *buspool.RemoteError
+	return errors.As(err, &remoteErr) || errors.Is(err, ErrBatchRejected) || errors.Is(err, buspool.ErrIncompatible)
+}
+
+// retry queues a failed batch again after REPL_BATCH_RETRY_INTERVAL, in sequence order. Its
+// in-flight entry is kept meanwhile so the ack doesn't move past it. A rejected batch, or
+// one out of attempts, is given up and the replica resynced.
+func (r *BatchReplicator) retry(st *batchStream, qb *queuedBatch, rejected bool) {
+	qb.attempts++
+	lastSeq := qb.firstSeq + uint64(len(qb.entries)) - 1
+	giveUp := rejected || qb.attempts >= REPL_BATCH_MAX_ATTEMPTS
+	if !giveUp && r.server.HasNode(st.nodeID) {
+		time.Sleep(REPL_BATCH_RETRY_INTERVAL)
+	}
+
+	st.mu.Lock()
+	delete(st.inflight, qb.firstSeq)
+	left := !r.server.HasNode(st.nodeID)
+	if left || giveUp {
+		if st.lostSeq == 0 || qb.firstSeq < st.lostSeq {
+			st.lostSeq = qb.firstSeq
+		}
+		if left {
+			log.Printf("[WARN]: %s left the cluster, replication batch %d-%d given up\n", st.nodeID, qb.firstSeq, lastSeq)
+			st.mu.Unlock()
+			return
+		}
+		log.Printf("[WARN]: replication batch %d-%d to %s given up after %d attempts, resyncing the replica\n", qb.firstSeq, lastSeq, st.nodeID, qb.attempts)
+		st.unsynced++
+		if !st.resyncing {
+			st.resyncing = true
+			go r.resyncReplica(st)
+		}
+		st.mu.Unlock()
+		return
+	}
+	qb.retry = true
+	i := sort.Search(len(st.queued), func(i int) bool { return st.queued[i].firstSeq > qb.firstSeq })
+	st.queued = slices.Insert(st.queued, i, qb)
+	st.mu.Unlock()
+
+	st.wake()
+}
+
+// resyncReplica sends the replica of st its ranges again until a transfer completes without
+// batches given up meanwhile, or the replica leaves the cluster. The ack may then move past
+// the batches given up, the transfer carried their writes.
+func (r *BatchReplicator) resyncReplica(st *batchStream) {
+	for {
+		st.mu.Lock()
+		unsynced := st.unsynced
+		st.mu.Unlock()
+
+		err := errors.New("no resync hook")
+		if r.resync != nil {
+			err = r.resync(st.nodeID)
+		}
+
+		st.mu.Lock()
+		if err == nil && st.unsynced == unsynced {
+			st.unsynced = 0
+			st.lostSeq = 0
+			st.resyncing = false
+			st.mu.Unlock()
+			log.Printf("[INFO]: replica %s resynced after %d batches given up\n", st.nodeID, unsynced)
+			return
+		}
+		st.mu.Unlock()
+
+		if err != nil {
+			log.Printf("[WARN]: resync of replica %s failed: %v\n", st.nodeID, err)
+		}
+		if !r.server.HasNode(st.nodeID) {
+			st.mu.Lock()
+			st.resyncing = false
+			st.mu.Unlock()
+			return
+		}
+		time.Sleep(REPL_BATCH_RESYNC_INTERVAL)
+	}
+}
+
+// remove drops an idle stream, returns false if writes were queued in the meantime.
+func (r *BatchReplicator) remove(st *batchStream) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.queued) > 0 || len(st.inflight) > 0 {
+		return false
+	}
+	if r.streams[st.nodeID] == st {
+		delete(r.streams, st.nodeID)
+	}
+	st.removed = true
+	return true
+}
+
+// ObserveBatch records a REP_BATCH applied on this replica. Batches from other senders than
+// the synchronous streams (stream ID 0) are ignored.
+func (r *BatchReplicator) ObserveBatch(req *pb.ReplicateBatch) {
+	if req.StreamId == 0 || len(req.Entries) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.progressLocked(req.MasterId, req.StreamId, req.AckedSeq)
+	p.ahead[req.FirstSeq] = req.FirstSeq + uint64(len(req.Entries)) - 1
+	for moved := true; moved; {
+		moved = false
+		for first, last := range p.ahead {
+			if first <= p.next {
+				p.next = max(p.next, last+1)
+				delete(p.ahead, first)
+				moved = true
+			}
+		}
+	}
+}
+
+// progressLocked returns the progress of the stream of masterID, started over for a new
+// stream. Every write up to ackedSeq was applied. Caller must hold r.mu.
+func (r *BatchReplicator) progressLocked(masterID string, streamID, ackedSeq uint64) *syncProgress {
+	p, ok := r.progress[masterID]
+	if !ok || p.streamID != streamID {
+		p = &syncProgress{streamID: streamID, next: 1, ahead: make(map[uint64]uint64)}
+		r.progress[masterID] = p
+	}
+	p.next = max(p.next, ackedSeq+1)
+	return p
+}
+
+// ObserveOffset records an offset marker of a synchronous stream received on this replica.
+func (r *BatchReplicator) ObserveOffset(req *pb.ReplicationOffset) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.progressLocked(req.MasterId, req.StreamId, req.AckedSeq)
+	masterTime := time.UnixMilli(req.MasterUnixMs)
+	if p.next > req.Seq && masterTime.After(p.freshAt) {
+		p.freshAt = masterTime
+	}
+}
+
+// Staleness returns how far this replica may be behind masterID: every write the master
+// made more than the returned duration ago has been applied here. Returns false if no
+// marker of masterID was covered yet. Clock skew between the nodes adds to the bound.
+func (r *BatchReplicator) Staleness(masterID string) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.progress[masterID]
+	if !ok || p.freshAt.IsZero() {
+		return 0, false
+	}
+	return max(time.Since(p.freshAt), 0), true
+}
+
+// MarkOffsets periodically sends an offset marker to every synchronous replica of the
+// ranges mastered by this node.
+func (r *BatchReplicator) MarkOffsets() {
+	for {
+		time.Sleep(ASYNC_OFFSET_INTERVAL)
+
+		targets := make(map[string]bool)
+		for _, sr := range r.server.GetServerMetadata() {
+			if sr.MasterID != r.server.ServerID {
+				continue
+			}
+			syncReplicas, _ := r.server.SplitReplicasByGroup(&sr)
+			for _, id := range syncReplicas {
+				targets[id] = true
+			}
+		}
+
+		for id := range targets {
+			st := r.streamFor(id)
+			st.mu.Lock()
+			marker := &pb.ReplicationOffset{
+				MasterId:     r.server.ServerID,
+				Seq:          st.lastSeq,
+				MasterUnixMs: time.Now().UnixMilli(),
+				StreamId:     st.id,
+				AckedSeq:     st.ackedSeq,
+			}
+			st.mu.Unlock()
+			go func() {
+				if err := r.server.CallReplica(id, pb.BusCommand_REPL_OFFSET, marker, nil, REPL_BATCH_TIMEOUT); err != nil {
+					log.Printf("[WARN]: offset marker to %s failed: %v\n", id, err)
+				}
+			}()
+		}
+	}
+}
+
+// StreamState is the progress of the batched stream to one replica.
+type StreamState struct {
+	NodeID    string
+	LastSeq   uint64 // last queued write
+	AckedSeq  uint64 // every write up to it was acknowledged
+	InFlight  int    // batches on the wire
+	Retrying  int    // failed batches queued again
+	Resyncing bool   // batches were given up, the replica is sent its ranges again
+}
+
+// Streams returns the state of every stream, sorted by node ID.
+func (r *BatchReplicator) Streams() []StreamState {
+	r.mu.Lock()
+	streams := make([]*batchStream, 0, len(r.streams))
+	for _, st := range r.streams {
+		streams = append(streams, st)
+	}
+	r.mu.Unlock()
+
+	states := make([]StreamState, 0, len(streams))
+	for _, st := range streams {
+		st.mu.Lock()
+		state := StreamState{NodeID: st.nodeID, LastSeq: st.lastSeq, AckedSeq: st.ackedSeq, InFlight: len(st.inflight), Resyncing: st.resyncing}
+		for _, qb := range st.queued {
+			if qb.retry {
+				state.Retrying++
+			}
+		}
+		states = append(states, state)
+		st.mu.Unlock()
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].NodeID < states[j].NodeID })
+	return states
+}
@@ -0,0 +1,186 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"iris/buspool"
+	"iris/config"
+	"iris/serializer/pb"
+	"testing"
+	"time"
+)
+
+const (
+	testMaster = "master"
+	testStream = 7
+)
+
+func batch(first uint64, n int) *pb.ReplicateBatch {
+	return &pb.ReplicateBatch{
+		MasterId: testMaster,
+		StreamId: testStream,
+		FirstSeq: first,
+		Entries:  make([]*pb.ReplicateRequest, n),
+	}
+}
+
+func marker(seq, ackedSeq uint64, age time.Duration) *pb.ReplicationOffset {
+	return &pb.ReplicationOffset{
+		MasterId:     testMaster,
+		Seq:          seq,
+		MasterUnixMs: time.Now().Add(-age).UnixMilli(),
+		StreamId:     testStream,
+		AckedSeq:     ackedSeq,
+	}
+}
+
+func TestSyncStaleness(t *testing.T) {
+	const maxStaleness = 5 * time.Second
+
+	tests := []struct {
+		name    string
+		observe func(r *BatchReplicator)
+		ok      bool
+		fresh   bool
+	}{
+		{"NeverHeard", func(r *BatchReplicator) {}, false, false},
+		{"BatchesWithoutMarker", func(r *BatchReplicator) {
+			r.ObserveBatch(batch(1, 3))
+		}, false, false},
+		{"RecentMarker", func(r *BatchReplicator) {
+			r.ObserveBatch(batch(1, 3))
+			r.ObserveOffset(marker(3, 0, 0))
+		}, true, true},
+		{"MasterSilent", func(r *BatchReplicator) {
+			r.ObserveBatch(batch(1, 3))
+			r.ObserveOffset(marker(3, 0, 10*time.Second))
+		}, true, false},
+		{"MarkerPastMissingBatch", func(r *BatchReplicator) {
+			r.ObserveBatch(batch(1, 3))
+			r.ObserveBatch(batch(6, 2))
+			r.ObserveOffset(marker(7, 0, 0))
+		}, false, false},
+		{"MissingBatchArrived", func(r *BatchReplicator) {
+			r.ObserveBatch(batch(1, 3))
+			r.ObserveBatch(batch(6, 2))
+			r.ObserveOffset(marker(7, 0, 0))
+			r.ObserveBatch(batch(4, 2))
+			r.ObserveOffset(marker(7, 0, 0))
+		}, true, true},
+		{"AckedByMaster", func(r *BatchReplicator) {
+			r.ObserveOffset(marker(9, 9, 0))
+		}, true, true},
+		{"NewStream", func(r *BatchReplicator) {
+			r.ObserveBatch(batch(1, 3))
+			r.ObserveOffset(marker(3, 0, 0))
+			next := marker(2, 0, 0)
+			next.StreamId = testStream + 1
+			r.ObserveOffset(next)
+		}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBatchReplicator(&config.Server{})
+			tt.observe(r)
+
+			staleness, ok := r.Staleness(testMaster)
+			if ok != tt.ok {
+				t.Fatalf("Staleness ok = %v, want %v", ok, tt.ok)
+			}
+			if fresh := ok && staleness <= maxStaleness; fresh != tt.fresh {
+				t.Fatalf("fresh = %v (staleness %v), want %v", fresh, staleness, tt.fresh)
+			}
+		})
+	}
+}
+
+func TestRejected(t *testing.T) {
+	tests := []struct {
+		err      error
+		rejected bool
+	}{
+		{&buspool.RemoteError{Command: pb.BusCommand_REP_BATCH, Message: "checksum mismatch"}, true},
+		{fmt.Errorf("%w: sent 1-3, acked 0", ErrBatchRejected), true},
+		{buspool.ErrIncompatible, true},
+		{buspool.ErrConnClosed, false},
+		{errors.New("i/o timeout"), false},
+	}
+	for _, tt := range tests {
+		if got := rejected(tt.err); got != tt.rejected {
+			t.Errorf("rejected(%v) = %v, want %v", tt.err, got, tt.rejected)
+		}
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		rejected bool
+	}{
+		{"Rejected", 0, true},
+		{"OutOfAttempts", REPL_BATCH_MAX_ATTEMPTS - 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &config.Server{Nodes: map[string]*config.Node{"r1": {ServerID: "r1"}}}
+			r := NewBatchReplicator(server)
+			resynced := make(chan string, 1)
+			r.SetResync(func(nodeID string) error {
+				resynced <- nodeID
+				return nil
+			})
+
+			st := &batchStream{nodeID: "r1", inflight: map[uint64]uint64{4: 6}, notify: make(chan struct{}, 1)}
+			qb := &queuedBatch{firstSeq: 4, entries: make([]*pb.ReplicateRequest, 3), attempts: tt.attempts}
+			r.retry(st, qb, tt.rejected)
+
+			st.mu.Lock()
+			queued, lostSeq := len(st.queued), st.lostSeq
+			st.mu.Unlock()
+			if queued != 0 || lostSeq != 4 {
+				t.Fatalf("queued %d, lostSeq %d, want the batch given up at 4", queued, lostSeq)
+			}
+
+			select {
+			case id := <-resynced:
+				if id != "r1" {
+					t.Fatalf("resynced %s, want r1", id)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("replica not resynced")
+			}
+			for deadline := time.Now().Add(time.Second); ; {
+				st.mu.Lock()
+				done := !st.resyncing && st.lostSeq == 0
+				st.mu.Unlock()
+				if done {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("ack still held after the resync")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestRetryRequeuesTransportError(t *testing.T) {
+	server := &config.Server{Nodes: map[string]*config.Node{"r1": {ServerID: "r1"}}}
+	r := NewBatchReplicator(server)
+	r.SetResync(func(nodeID string) error {
+		t.Error("replica resynced after one transport error")
+		return nil
+	})
+
+	st := &batchStream{nodeID: "r1", inflight: map[uint64]uint64{4: 6}, notify: make(chan struct{}, 1)}
+	qb := &queuedBatch{firstSeq: 4, entries: make([]*pb.ReplicateRequest, 3)}
+	r.retry(st, qb, false)
+
+	if len(st.queued) != 1 || !st.queued[0].retry || st.lostSeq != 0 {
+		t.Fatalf("queued %d, lostSeq %d, want the batch queued again", len(st.queued), st.lostSeq)
+	}
+}
@@ -0,0 +1,2841 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v7.35.0--rc2
+// source: bus.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Every bus request travels in a BusRequest frame, the body is the message of the
+// command (listed next to each command). The reply is a BusResponse, its body is
+// the reply message of the command or empty for commands that only acknowledge.
+type BusCommand int32
+
+const (
+	BusCommand_UNKNOWN_COMMAND  BusCommand = 0
+	BusCommand_BUS_PING         BusCommand = 1  // Empty -> Empty
+	BusCommand_JOIN             BusCommand = 2  // JoinRequest -> JoinResponse
+	BusCommand_PREPARE          BusCommand = 3  // PrepareRequest -> Empty
+	BusCommand_COMMIT           BusCommand = 4  // CommitRequest -> Empty
+	BusCommand_SNAPSHOT         BusCommand = 5  // ClusterSnapshot -> Empty
+	BusCommand_REQ_METADATA     BusCommand = 6  // Empty -> ClusterSnapshot
+	BusCommand_CLUSTER_METADATA BusCommand = 7  // ClusterMetadata -> Empty
+	BusCommand_CMU              BusCommand = 8  // MetadataUpdate -> Empty
+	BusCommand_LEAVE            BusCommand = 9  // LeaveRequest -> Empty
+	BusCommand_HEARTBEAT        BusCommand = 10 // HeartbeatRequest -> HeartbeatResponse
+	BusCommand_REQ_VOTE         BusCommand = 11 // VoteRequest -> VoteResponse
+	BusCommand_SUSPECT_LEADER   BusCommand = 12 // SuspectLeaderRequest -> Empty
+	BusCommand_INS              BusCommand = 13 // InsertRequest -> Empty
+	BusCommand_REP              BusCommand = 14 // ReplicateRequest -> Empty
+	BusCommand_REPL_OFFSET      BusCommand = 15 // ReplicationOffset -> Empty
+	BusCommand_RGET             BusCommand = 16 // RemoteGetRequest -> RemoteGetResponse
+	BusCommand_GOSSIP           BusCommand = 17 // GossipMessage -> Empty
+	BusCommand_PING             BusCommand = 18 // PingRequest -> PingAck
+	BusCommand_PING_REQ         BusCommand = 19 // PingReqRequest -> PingAck
+	BusCommand_NODE_DEAD        BusCommand = 20 // NodeDeadRequest -> Empty
+	BusCommand_SHOW             BusCommand = 21 // Empty -> ShowResponse
+	BusCommand_HELLO            BusCommand = 22 // Hello -> Hello, first request on every pooled connection
+	BusCommand_REP_BATCH        BusCommand = 23 // ReplicateBatch -> ReplicateBatchAck
+	BusCommand_SST_CHUNK        BusCommand = 24 // SstChunk -> Empty
+	BusCommand_SST_INGEST       BusCommand = 25 // SstIngest -> SstIngestAck
+)
+
+// Enum value maps for BusCommand.
+var (
+	BusCommand_name = map[int32]string{
+		0:  "UNKNOWN_COMMAND",
+		1:  "BUS_PING",
+		2:  "JOIN",
+		3:  "PREPARE",
+		4:  "COMMIT",
+		5:  "SNAPSHOT",
+		6:  "REQ_METADATA",
+		7:  "CLUSTER_METADATA",
+		8:  "CMU",
+		9:  "LEAVE",
+		10: "HEARTBEAT",
+		11: "REQ_VOTE",
+		12: "SUSPECT_LEADER",
+		13: "INS",
+		14: "REP",
+		15: "REPL_OFFSET",
+		16: "RGET",
+		17: "GOSSIP",
+		18: "PING",
+		19: "PING_REQ",
+		20: "NODE_DEAD",
+		21: "SHOW",
+		22: "HELLO",
+		23: "REP_BATCH",
+		24: "SST_CHUNK",
+		25: "SST_INGEST",
+	}
+	BusCommand_value = map[string]int32{
+		"UNKNOWN_COMMAND":  0,
+		"BUS_PING":         1,
+		"JOIN":             2,
+		"PREPARE":          3,
+		"COMMIT":           4,
+		"SNAPSHOT":         5,
+		"REQ_METADATA":     6,
+		"CLUSTER_METADATA": 7,
+		"CMU":              8,
+		"LEAVE":            9,
+		"HEARTBEAT":        10,
+		"REQ_VOTE":         11,
+		"SUSPECT_LEADER":   12,
+		"INS":              13,
+		"REP":              14,
+		"REPL_OFFSET":      15,
+		"RGET":             16,
+		"GOSSIP":           17,
+		"PING":             18,
+		"PING_REQ":         19,
+		"NODE_DEAD":        20,
+		"SHOW":             21,
+		"HELLO":            22,
+		"REP_BATCH":        23,
+		"SST_CHUNK":        24,
+		"SST_INGEST":       25,
+	}
+)
+
+func (x BusCommand) Enum() *BusCommand {
+	p := new(BusCommand)
+	*p = x
+	return p
+}
+
+func (x BusCommand) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BusCommand) Descriptor() protoreflect.EnumDescriptor {
+	return file_bus_proto_enumTypes[0].Descriptor()
+}
+
+func (BusCommand) Type() protoreflect.EnumType {
+	return &file_bus_proto_enumTypes[0]
+}
+
+func (x BusCommand) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BusCommand.Descriptor instead.
+func (BusCommand) EnumDescriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{0}
+}
+
+type MetadataUpdateOp int32
+
+const (
+	MetadataUpdateOp_REPLICA_ADD       MetadataUpdateOp = 0 // server_id becomes a replica of start-end
+	MetadataUpdateOp_REPAIR_REQUEST    MetadataUpdateOp = 1 // server_id asks the master to repair the replicas of its ranges
+	MetadataUpdateOp_ASYNC_REPLICATION MetadataUpdateOp = 2 // enabled switches async cross-group replication of start-end
+)
+
+// Enum value maps for MetadataUpdateOp.
+var (
+	MetadataUpdateOp_name = map[int32]string{
+		0: "REPLICA_ADD",
+		1: "REPAIR_REQUEST",
+		2: "ASYNC_REPLICATION",
+	}
+	MetadataUpdateOp_value = map[string]int32{
+		"REPLICA_ADD":       0,
+		"REPAIR_REQUEST":    1,
+		"ASYNC_REPLICATION": 2,
+	}
+)
+
+func (x MetadataUpdateOp) Enum() *MetadataUpdateOp {
+	p := new(MetadataUpdateOp)
+	*p = x
+	return p
+}
+
+func (x MetadataUpdateOp) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MetadataUpdateOp) Descriptor() protoreflect.EnumDescriptor {
+	return file_bus_proto_enumTypes[1].Descriptor()
+}
+
+func (MetadataUpdateOp) Type() protoreflect.EnumType {
+	return &file_bus_proto_enumTypes[1]
+}
+
+func (x MetadataUpdateOp) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MetadataUpdateOp.Descriptor instead.
+func (MetadataUpdateOp) EnumDescriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{1}
+}
+
+type HeartbeatStatus int32
+
+const (
+	HeartbeatStatus_HEARTBEAT_OK               HeartbeatStatus = 0
+	HeartbeatStatus_HEARTBEAT_VERSION_MISMATCH HeartbeatStatus = 1
+	HeartbeatStatus_HEARTBEAT_ERROR            HeartbeatStatus = 2
+)
+
+// Enum value maps for HeartbeatStatus.
+var (
+	HeartbeatStatus_name = map[int32]string{
+		0: "HEARTBEAT_OK",
+		1: "HEARTBEAT_VERSION_MISMATCH",
+		2: "HEARTBEAT_ERROR",
+	}
+	HeartbeatStatus_value = map[string]int32{
+		"HEARTBEAT_OK":               0,
+		"HEARTBEAT_VERSION_MISMATCH": 1,
+		"HEARTBEAT_ERROR":            2,
+	}
+)
+
+func (x HeartbeatStatus) Enum() *HeartbeatStatus {
+	p := new(HeartbeatStatus)
+	*p = x
+	return p
+}
+
+func (x HeartbeatStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (HeartbeatStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_bus_proto_enumTypes[2].Descriptor()
+}
+
+func (HeartbeatStatus) Type() protoreflect.EnumType {
+	return &file_bus_proto_enumTypes[2]
+}
+
+func (x HeartbeatStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use HeartbeatStatus.Descriptor instead.
+func (HeartbeatStatus) EnumDescriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{2}
+}
+
+type BusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       BusCommand             `protobuf:"varint,1,opt,name=command,proto3,enum=main.BusCommand" json:"command,omitempty"`
+	Body          []byte                 `protobuf:"bytes,2,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BusRequest) Reset() {
+	*x = BusRequest{}
+	mi := &file_bus_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BusRequest) ProtoMessage() {}
+
+func (x *BusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BusRequest.ProtoReflect.Descriptor instead.
+func (*BusRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *BusRequest) GetCommand() BusCommand {
+	if x != nil {
+		return x.Command
+	}
+	return BusCommand_UNKNOWN_COMMAND
+}
+
+func (x *BusRequest) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type BusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// set when the command failed, the body is empty then
+	Error         string `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	Body          []byte `protobuf:"bytes,2,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BusResponse) Reset() {
+	*x = BusResponse{}
+	mi := &file_bus_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BusResponse) ProtoMessage() {}
+
+func (x *BusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BusResponse.ProtoReflect.Descriptor instead.
+func (*BusResponse) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BusResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BusResponse) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type Empty struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	mi := &file_bus_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{2}
+}
+
+type Node struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServerId      string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	Addr          string                 `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	Status        int32                  `protobuf:"varint,3,opt,name=status,proto3" json:"status,omitempty"`
+	Group         string                 `protobuf:"bytes,4,opt,name=group,proto3" json:"group,omitempty"`
+	ResourceScore float64                `protobuf:"fixed64,5,opt,name=resource_score,json=resourceScore,proto3" json:"resource_score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Node) Reset() {
+	*x = Node{}
+	mi := &file_bus_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Node) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Node) ProtoMessage() {}
+
+func (x *Node) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Node.ProtoReflect.Descriptor instead.
+func (*Node) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Node) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *Node) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *Node) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *Node) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Node) GetResourceScore() float64 {
+	if x != nil {
+		return x.ResourceScore
+	}
+	return 0
+}
+
+type SlotRange struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Start           uint32                 `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	End             uint32                 `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`
+	MasterId        string                 `protobuf:"bytes,3,opt,name=master_id,json=masterId,proto3" json:"master_id,omitempty"`
+	Nodes           []string               `protobuf:"bytes,4,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	AsyncCrossGroup bool                   `protobuf:"varint,5,opt,name=async_cross_group,json=asyncCrossGroup,proto3" json:"async_cross_group,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *SlotRange) Reset() {
+	*x = SlotRange{}
+	mi := &file_bus_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SlotRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SlotRange) ProtoMessage() {}
+
+func (x *SlotRange) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SlotRange.ProtoReflect.Descriptor instead.
+func (*SlotRange) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SlotRange) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *SlotRange) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *SlotRange) GetMasterId() string {
+	if x != nil {
+		return x.MasterId
+	}
+	return ""
+}
+
+func (x *SlotRange) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *SlotRange) GetAsyncCrossGroup() bool {
+	if x != nil {
+		return x.AsyncCrossGroup
+	}
+	return false
+}
+
+type ClusterSnapshot struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ClusterVersion uint64                 `protobuf:"varint,1,opt,name=cluster_version,json=clusterVersion,proto3" json:"cluster_version,omitempty"`
+	TotalNodes     uint32                 `protobuf:"varint,2,opt,name=total_nodes,json=totalNodes,proto3" json:"total_nodes,omitempty"`
+	TotalSlots     uint32                 `protobuf:"varint,3,opt,name=total_slots,json=totalSlots,proto3" json:"total_slots,omitempty"`
+	Nodes          []*Node                `protobuf:"bytes,4,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Metadata       []*SlotRange           `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty"`
+	MasterNodeId   string                 `protobuf:"bytes,6,opt,name=master_node_id,json=masterNodeId,proto3" json:"master_node_id,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ClusterSnapshot) Reset() {
+	*x = ClusterSnapshot{}
+	mi := &file_bus_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClusterSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClusterSnapshot) ProtoMessage() {}
+
+func (x *ClusterSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClusterSnapshot.ProtoReflect.Descriptor instead.
+func (*ClusterSnapshot) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ClusterSnapshot) GetClusterVersion() uint64 {
+	if x != nil {
+		return x.ClusterVersion
+	}
+	return 0
+}
+
+func (x *ClusterSnapshot) GetTotalNodes() uint32 {
+	if x != nil {
+		return x.TotalNodes
+	}
+	return 0
+}
+
+func (x *ClusterSnapshot) GetTotalSlots() uint32 {
+	if x != nil {
+		return x.TotalSlots
+	}
+	return 0
+}
+
+func (x *ClusterSnapshot) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *ClusterSnapshot) GetMetadata() []*SlotRange {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *ClusterSnapshot) GetMasterNodeId() string {
+	if x != nil {
+		return x.MasterNodeId
+	}
+	return ""
+}
+
+type ClusterMetadata struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ranges        []*SlotRange           `protobuf:"bytes,1,rep,name=ranges,proto3" json:"ranges,omitempty"`
+	Nodes         []*Node                `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClusterMetadata) Reset() {
+	*x = ClusterMetadata{}
+	mi := &file_bus_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClusterMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClusterMetadata) ProtoMessage() {}
+
+func (x *ClusterMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClusterMetadata.ProtoReflect.Descriptor instead.
+func (*ClusterMetadata) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ClusterMetadata) GetRanges() []*SlotRange {
+	if x != nil {
+		return x.Ranges
+	}
+	return nil
+}
+
+func (x *ClusterMetadata) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type JoinRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServerId      string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	Port          string                 `protobuf:"bytes,2,opt,name=port,proto3" json:"port,omitempty"`
+	ResourceScore float64                `protobuf:"fixed64,3,opt,name=resource_score,json=resourceScore,proto3" json:"resource_score,omitempty"`
+	Group         string                 `protobuf:"bytes,4,opt,name=group,proto3" json:"group,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JoinRequest) Reset() {
+	*x = JoinRequest{}
+	mi := &file_bus_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JoinRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JoinRequest) ProtoMessage() {}
+
+func (x *JoinRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JoinRequest.ProtoReflect.Descriptor instead.
+func (*JoinRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *JoinRequest) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *JoinRequest) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *JoinRequest) GetResourceScore() float64 {
+	if x != nil {
+		return x.ResourceScore
+	}
+	return 0
+}
+
+func (x *JoinRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+type SlotSpan struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         uint32                 `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           uint32                 `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SlotSpan) Reset() {
+	*x = SlotSpan{}
+	mi := &file_bus_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SlotSpan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SlotSpan) ProtoMessage() {}
+
+func (x *SlotSpan) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SlotSpan.ProtoReflect.Descriptor instead.
+func (*SlotSpan) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SlotSpan) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *SlotSpan) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+type JoinResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Snapshot *ClusterSnapshot       `protobuf:"bytes,1,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	// true when the node was already a member of the cluster
+	Rejoin bool `protobuf:"varint,2,opt,name=rejoin,proto3" json:"rejoin,omitempty"`
+	// the ranges the node is responsible for
+	Ranges         []*SlotSpan `protobuf:"bytes,3,rep,name=ranges,proto3" json:"ranges,omitempty"`
+	ClusterVersion uint64      `protobuf:"varint,4,opt,name=cluster_version,json=clusterVersion,proto3" json:"cluster_version,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *JoinResponse) Reset() {
+	*x = JoinResponse{}
+	mi := &file_bus_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JoinResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JoinResponse) ProtoMessage() {}
+
+func (x *JoinResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JoinResponse.ProtoReflect.Descriptor instead.
+func (*JoinResponse) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *JoinResponse) GetSnapshot() *ClusterSnapshot {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (x *JoinResponse) GetRejoin() bool {
+	if x != nil {
+		return x.Rejoin
+	}
+	return false
+}
+
+func (x *JoinResponse) GetRanges() []*SlotSpan {
+	if x != nil {
+		return x.Ranges
+	}
+	return nil
+}
+
+func (x *JoinResponse) GetClusterVersion() uint64 {
+	if x != nil {
+		return x.ClusterVersion
+	}
+	return 0
+}
+
+type PrepareRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	MessageId        string                 `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	TargetNodeId     string                 `protobuf:"bytes,2,opt,name=target_node_id,json=targetNodeId,proto3" json:"target_node_id,omitempty"`
+	TargetNodeAddr   string                 `protobuf:"bytes,3,opt,name=target_node_addr,json=targetNodeAddr,proto3" json:"target_node_addr,omitempty"`
+	Start            uint32                 `protobuf:"varint,4,opt,name=start,proto3" json:"start,omitempty"`
+	End              uint32                 `protobuf:"varint,5,opt,name=end,proto3" json:"end,omitempty"`
+	ModifiedNodeId   string                 `protobuf:"bytes,6,opt,name=modified_node_id,json=modifiedNodeId,proto3" json:"modified_node_id,omitempty"`
+	ModifiedReplicas []string               `protobuf:"bytes,7,rep,name=modified_replicas,json=modifiedReplicas,proto3" json:"modified_replicas,omitempty"`
+	TargetReplicas   []string               `protobuf:"bytes,8,rep,name=target_replicas,json=targetReplicas,proto3" json:"target_replicas,omitempty"`
+	ResourceScore    float64                `protobuf:"fixed64,9,opt,name=resource_score,json=resourceScore,proto3" json:"resource_score,omitempty"`
+	Group            string                 `protobuf:"bytes,10,opt,name=group,proto3" json:"group,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *PrepareRequest) Reset() {
+	*x = PrepareRequest{}
+	mi := &file_bus_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PrepareRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrepareRequest) ProtoMessage() {}
+
+func (x *PrepareRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrepareRequest.ProtoReflect.Descriptor instead.
+func (*PrepareRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PrepareRequest) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *PrepareRequest) GetTargetNodeId() string {
+	if x != nil {
+		return x.TargetNodeId
+	}
+	return ""
+}
+
+func (x *PrepareRequest) GetTargetNodeAddr() string {
+	if x != nil {
+		return x.TargetNodeAddr
+	}
+	return ""
+}
+
+func (x *PrepareRequest) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *PrepareRequest) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *PrepareRequest) GetModifiedNodeId() string {
+	if x != nil {
+		return x.ModifiedNodeId
+	}
+	return ""
+}
+
+func (x *PrepareRequest) GetModifiedReplicas() []string {
+	if x != nil {
+		return x.ModifiedReplicas
+	}
+	return nil
+}
+
+func (x *PrepareRequest) GetTargetReplicas() []string {
+	if x != nil {
+		return x.TargetReplicas
+	}
+	return nil
+}
+
+func (x *PrepareRequest) GetResourceScore() float64 {
+	if x != nil {
+		return x.ResourceScore
+	}
+	return 0
+}
+
+func (x *PrepareRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+type CommitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     string                 `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitRequest) Reset() {
+	*x = CommitRequest{}
+	mi := &file_bus_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitRequest) ProtoMessage() {}
+
+func (x *CommitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitRequest.ProtoReflect.Descriptor instead.
+func (*CommitRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CommitRequest) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+type MetadataUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Op            MetadataUpdateOp       `protobuf:"varint,1,opt,name=op,proto3,enum=main.MetadataUpdateOp" json:"op,omitempty"`
+	ServerId      string                 `protobuf:"bytes,2,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	Start         uint32                 `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"`
+	End           uint32                 `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`
+	Enabled       bool                   `protobuf:"varint,5,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataUpdate) Reset() {
+	*x = MetadataUpdate{}
+	mi := &file_bus_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataUpdate) ProtoMessage() {}
+
+func (x *MetadataUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataUpdate.ProtoReflect.Descriptor instead.
+func (*MetadataUpdate) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *MetadataUpdate) GetOp() MetadataUpdateOp {
+	if x != nil {
+		return x.Op
+	}
+	return MetadataUpdateOp_REPLICA_ADD
+}
+
+func (x *MetadataUpdate) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *MetadataUpdate) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *MetadataUpdate) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *MetadataUpdate) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+type LeaveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServerId      string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaveRequest) Reset() {
+	*x = LeaveRequest{}
+	mi := &file_bus_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaveRequest) ProtoMessage() {}
+
+func (x *LeaveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaveRequest.ProtoReflect.Descriptor instead.
+func (*LeaveRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *LeaveRequest) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+type HeartbeatRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ServerId       string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	Unreachable    []string               `protobuf:"bytes,2,rep,name=unreachable,proto3" json:"unreachable,omitempty"`
+	Group          string                 `protobuf:"bytes,3,opt,name=group,proto3" json:"group,omitempty"`
+	ClusterVersion uint64                 `protobuf:"varint,4,opt,name=cluster_version,json=clusterVersion,proto3" json:"cluster_version,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_bus_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *HeartbeatRequest) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest) GetUnreachable() []string {
+	if x != nil {
+		return x.Unreachable
+	}
+	return nil
+}
+
+func (x *HeartbeatRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest) GetClusterVersion() uint64 {
+	if x != nil {
+		return x.ClusterVersion
+	}
+	return 0
+}
+
+type HeartbeatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        HeartbeatStatus        `protobuf:"varint,1,opt,name=status,proto3,enum=main.HeartbeatStatus" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_bus_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *HeartbeatResponse) GetStatus() HeartbeatStatus {
+	if x != nil {
+		return x.Status
+	}
+	return HeartbeatStatus_HEARTBEAT_OK
+}
+
+type VoteRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CandidateId    string                 `protobuf:"bytes,1,opt,name=candidate_id,json=candidateId,proto3" json:"candidate_id,omitempty"`
+	FailedMasterId string                 `protobuf:"bytes,2,opt,name=failed_master_id,json=failedMasterId,proto3" json:"failed_master_id,omitempty"`
+	ClusterVersion uint64                 `protobuf:"varint,3,opt,name=cluster_version,json=clusterVersion,proto3" json:"cluster_version,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *VoteRequest) Reset() {
+	*x = VoteRequest{}
+	mi := &file_bus_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoteRequest) ProtoMessage() {}
+
+func (x *VoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoteRequest.ProtoReflect.Descriptor instead.
+func (*VoteRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *VoteRequest) GetCandidateId() string {
+	if x != nil {
+		return x.CandidateId
+	}
+	return ""
+}
+
+func (x *VoteRequest) GetFailedMasterId() string {
+	if x != nil {
+		return x.FailedMasterId
+	}
+	return ""
+}
+
+func (x *VoteRequest) GetClusterVersion() uint64 {
+	if x != nil {
+		return x.ClusterVersion
+	}
+	return 0
+}
+
+type VoteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Granted       bool                   `protobuf:"varint,1,opt,name=granted,proto3" json:"granted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VoteResponse) Reset() {
+	*x = VoteResponse{}
+	mi := &file_bus_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoteResponse) ProtoMessage() {}
+
+func (x *VoteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoteResponse.ProtoReflect.Descriptor instead.
+func (*VoteResponse) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *VoteResponse) GetGranted() bool {
+	if x != nil {
+		return x.Granted
+	}
+	return false
+}
+
+type SuspectLeaderRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SenderId       string                 `protobuf:"bytes,1,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	MasterId       string                 `protobuf:"bytes,2,opt,name=master_id,json=masterId,proto3" json:"master_id,omitempty"`
+	ClusterVersion uint64                 `protobuf:"varint,3,opt,name=cluster_version,json=clusterVersion,proto3" json:"cluster_version,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SuspectLeaderRequest) Reset() {
+	*x = SuspectLeaderRequest{}
+	mi := &file_bus_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SuspectLeaderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SuspectLeaderRequest) ProtoMessage() {}
+
+func (x *SuspectLeaderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SuspectLeaderRequest.ProtoReflect.Descriptor instead.
+func (*SuspectLeaderRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SuspectLeaderRequest) GetSenderId() string {
+	if x != nil {
+		return x.SenderId
+	}
+	return ""
+}
+
+func (x *SuspectLeaderRequest) GetMasterId() string {
+	if x != nil {
+		return x.MasterId
+	}
+	return ""
+}
+
+func (x *SuspectLeaderRequest) GetClusterVersion() uint64 {
+	if x != nil {
+		return x.ClusterVersion
+	}
+	return 0
+}
+
+type InsertRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// durability chosen by the client (sync, group, periodic), empty for the default of the master
+	Durability string `protobuf:"bytes,3,opt,name=durability,proto3" json:"durability,omitempty"`
+	// crc32c of the value with timestamp 0, unset from nodes before v5
+	Checksum      *uint32 `protobuf:"varint,4,opt,name=checksum,proto3,oneof" json:"checksum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InsertRequest) Reset() {
+	*x = InsertRequest{}
+	mi := &file_bus_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InsertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InsertRequest) ProtoMessage() {}
+
+func (x *InsertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InsertRequest.ProtoReflect.Descriptor instead.
+func (*InsertRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *InsertRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *InsertRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *InsertRequest) GetDurability() string {
+	if x != nil {
+		return x.Durability
+	}
+	return ""
+}
+
+func (x *InsertRequest) GetChecksum() uint32 {
+	if x != nil && x.Checksum != nil {
+		return *x.Checksum
+	}
+	return 0
+}
+
+type ReplicateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// HLC timestamp of the write on the master, applied last-writer-wins
+	HlcTs uint64 `protobuf:"varint,3,opt,name=hlc_ts,json=hlcTs,proto3" json:"hlc_ts,omitempty"`
+	// crc32c of hlc_ts and value (see engine/checksum.go), unset from nodes before v5
+	Checksum *uint32 `protobuf:"varint,4,opt,name=checksum,proto3,oneof" json:"checksum,omitempty"`
+	// value is sealed with a key of the keyring (see engine/encryption.go)
+	Sealed bool `protobuf:"varint,5,opt,name=sealed,proto3" json:"sealed,omitempty"`
+	// codec compressing the value (see engine/compression.go), 0 uncompressed
+	Compression uint32 `protobuf:"varint,6,opt,name=compression,proto3" json:"compression,omitempty"`
+	// deletes the key unless its stored value is newer than hlc_ts, value is empty
+	Deleted       bool `protobuf:"varint,7,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicateRequest) Reset() {
+	*x = ReplicateRequest{}
+	mi := &file_bus_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicateRequest) ProtoMessage() {}
+
+func (x *ReplicateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicateRequest.ProtoReflect.Descriptor instead.
+func (*ReplicateRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ReplicateRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *ReplicateRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *ReplicateRequest) GetHlcTs() uint64 {
+	if x != nil {
+		return x.HlcTs
+	}
+	return 0
+}
+
+func (x *ReplicateRequest) GetChecksum() uint32 {
+	if x != nil && x.Checksum != nil {
+		return *x.Checksum
+	}
+	return 0
+}
+
+func (x *ReplicateRequest) GetSealed() bool {
+	if x != nil {
+		return x.Sealed
+	}
+	return false
+}
+
+func (x *ReplicateRequest) GetCompression() uint32 {
+	if x != nil {
+		return x.Compression
+	}
+	return 0
+}
+
+func (x *ReplicateRequest) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+// ReplicateBatch carries consecutive writes of one master to a replica, they are
+// applied in a single batch and acknowledged together.
+type ReplicateBatch struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	MasterId string                 `protobuf:"bytes,1,opt,name=master_id,json=masterId,proto3" json:"master_id,omitempty"`
+	// sequence number of the first entry in the stream of the master to this replica
+	FirstSeq uint64              `protobuf:"varint,2,opt,name=first_seq,json=firstSeq,proto3" json:"first_seq,omitempty"`
+	Entries  []*ReplicateRequest `protobuf:"bytes,3,rep,name=entries,proto3" json:"entries,omitempty"`
+	// identifies the synchronous stream of the batch (replication/batch.go), 0 for other senders
+	StreamId uint64 `protobuf:"varint,4,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	// every entry of the stream up to it was acknowledged by this replica
+	AckedSeq      uint64 `protobuf:"varint,5,opt,name=acked_seq,json=ackedSeq,proto3" json:"acked_seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicateBatch) Reset() {
+	*x = ReplicateBatch{}
+	mi := &file_bus_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicateBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicateBatch) ProtoMessage() {}
+
+func (x *ReplicateBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicateBatch.ProtoReflect.Descriptor instead.
+func (*ReplicateBatch) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ReplicateBatch) GetMasterId() string {
+	if x != nil {
+		return x.MasterId
+	}
+	return ""
+}
+
+func (x *ReplicateBatch) GetFirstSeq() uint64 {
+	if x != nil {
+		return x.FirstSeq
+	}
+	return 0
+}
+
+func (x *ReplicateBatch) GetEntries() []*ReplicateRequest {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *ReplicateBatch) GetStreamId() uint64 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *ReplicateBatch) GetAckedSeq() uint64 {
+	if x != nil {
+		return x.AckedSeq
+	}
+	return 0
+}
+
+type ReplicateBatchAck struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// sequence number of the last entry of the batch, every entry up to it is durable
+	AckedSeq uint64 `protobuf:"varint,1,opt,name=acked_seq,json=ackedSeq,proto3" json:"acked_seq,omitempty"`
+	// entries that were newer than the stored value
+	Applied       uint32 `protobuf:"varint,2,opt,name=applied,proto3" json:"applied,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicateBatchAck) Reset() {
+	*x = ReplicateBatchAck{}
+	mi := &file_bus_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicateBatchAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicateBatchAck) ProtoMessage() {}
+
+func (x *ReplicateBatchAck) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicateBatchAck.ProtoReflect.Descriptor instead.
+func (*ReplicateBatchAck) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ReplicateBatchAck) GetAckedSeq() uint64 {
+	if x != nil {
+		return x.AckedSeq
+	}
+	return 0
+}
+
+func (x *ReplicateBatchAck) GetApplied() uint32 {
+	if x != nil {
+		return x.Applied
+	}
+	return 0
+}
+
+// SstChunk is a piece of an SST file of a range transfer, the chunks of a file are
+// sent in order.
+type SstChunk struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	TransferId string                 `protobuf:"bytes,1,opt,name=transfer_id,json=transferId,proto3" json:"transfer_id,omitempty"`
+	// index of the file in the transfer
+	File   uint32 `protobuf:"varint,2,opt,name=file,proto3" json:"file,omitempty"`
+	Offset uint64 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	Data   []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	// crc32c of data
+	Checksum      uint32 `protobuf:"varint,5,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SstChunk) Reset() {
+	*x = SstChunk{}
+	mi := &file_bus_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SstChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SstChunk) ProtoMessage() {}
+
+func (x *SstChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SstChunk.ProtoReflect.Descriptor instead.
+func (*SstChunk) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *SstChunk) GetTransferId() string {
+	if x != nil {
+		return x.TransferId
+	}
+	return ""
+}
+
+func (x *SstChunk) GetFile() uint32 {
+	if x != nil {
+		return x.File
+	}
+	return 0
+}
+
+func (x *SstChunk) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *SstChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *SstChunk) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+type SstFile struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	File  uint32                 `protobuf:"varint,1,opt,name=file,proto3" json:"file,omitempty"`
+	Size  uint64                 `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	// crc32c of the whole file
+	Checksum      uint32 `protobuf:"varint,3,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SstFile) Reset() {
+	*x = SstFile{}
+	mi := &file_bus_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SstFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SstFile) ProtoMessage() {}
+
+func (x *SstFile) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SstFile.ProtoReflect.Descriptor instead.
+func (*SstFile) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *SstFile) GetFile() uint32 {
+	if x != nil {
+		return x.File
+	}
+	return 0
+}
+
+func (x *SstFile) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SstFile) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+// SstIngest asks the target of a range transfer to check and ingest the files it received.
+type SstIngest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransferId    string                 `protobuf:"bytes,1,opt,name=transfer_id,json=transferId,proto3" json:"transfer_id,omitempty"`
+	Start         uint32                 `protobuf:"varint,2,opt,name=start,proto3" json:"start,omitempty"`
+	End           uint32                 `protobuf:"varint,3,opt,name=end,proto3" json:"end,omitempty"`
+	Files         []*SstFile             `protobuf:"bytes,4,rep,name=files,proto3" json:"files,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SstIngest) Reset() {
+	*x = SstIngest{}
+	mi := &file_bus_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SstIngest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SstIngest) ProtoMessage() {}
+
+func (x *SstIngest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SstIngest.ProtoReflect.Descriptor instead.
+func (*SstIngest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *SstIngest) GetTransferId() string {
+	if x != nil {
+		return x.TransferId
+	}
+	return ""
+}
+
+func (x *SstIngest) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *SstIngest) GetEnd() uint32 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *SstIngest) GetFiles() []*SstFile {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+type SstIngestAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bytes         uint64                 `protobuf:"varint,1,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SstIngestAck) Reset() {
+	*x = SstIngestAck{}
+	mi := &file_bus_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SstIngestAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SstIngestAck) ProtoMessage() {}
+
+func (x *SstIngestAck) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SstIngestAck.ProtoReflect.Descriptor instead.
+func (*SstIngestAck) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *SstIngestAck) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type ReplicationOffset struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	MasterId     string                 `protobuf:"bytes,1,opt,name=master_id,json=masterId,proto3" json:"master_id,omitempty"`
+	Seq          uint64                 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	MasterUnixMs int64                  `protobuf:"varint,3,opt,name=master_unix_ms,json=masterUnixMs,proto3" json:"master_unix_ms,omitempty"`
+	// writes dropped from the stream since the replica was last resynced
+	Dropped uint64 `protobuf:"varint,4,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	// set on the markers of the synchronous streams (replication/batch.go), seq is then
+	// the last write queued for the replica and acked_seq the cumulative ack of the master
+	StreamId      uint64 `protobuf:"varint,5,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	AckedSeq      uint64 `protobuf:"varint,6,opt,name=acked_seq,json=ackedSeq,proto3" json:"acked_seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicationOffset) Reset() {
+	*x = ReplicationOffset{}
+	mi := &file_bus_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicationOffset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicationOffset) ProtoMessage() {}
+
+func (x *ReplicationOffset) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicationOffset.ProtoReflect.Descriptor instead.
+func (*ReplicationOffset) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ReplicationOffset) GetMasterId() string {
+	if x != nil {
+		return x.MasterId
+	}
+	return ""
+}
+
+func (x *ReplicationOffset) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ReplicationOffset) GetMasterUnixMs() int64 {
+	if x != nil {
+		return x.MasterUnixMs
+	}
+	return 0
+}
+
+func (x *ReplicationOffset) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *ReplicationOffset) GetStreamId() uint64 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *ReplicationOffset) GetAckedSeq() uint64 {
+	if x != nil {
+		return x.AckedSeq
+	}
+	return 0
+}
+
+type RemoteGetRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// negative reads unconditionally, otherwise the replica answers stale if it is further behind
+	MaxStalenessMs int64 `protobuf:"varint,2,opt,name=max_staleness_ms,json=maxStalenessMs,proto3" json:"max_staleness_ms,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RemoteGetRequest) Reset() {
+	*x = RemoteGetRequest{}
+	mi := &file_bus_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoteGetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoteGetRequest) ProtoMessage() {}
+
+func (x *RemoteGetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoteGetRequest.ProtoReflect.Descriptor instead.
+func (*RemoteGetRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *RemoteGetRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *RemoteGetRequest) GetMaxStalenessMs() int64 {
+	if x != nil {
+		return x.MaxStalenessMs
+	}
+	return 0
+}
+
+type RemoteGetResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Found bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	Stale bool                   `protobuf:"varint,2,opt,name=stale,proto3" json:"stale,omitempty"`
+	Value []byte                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	HlcTs uint64                 `protobuf:"varint,4,opt,name=hlc_ts,json=hlcTs,proto3" json:"hlc_ts,omitempty"`
+	// crc32c of hlc_ts and value, unset from nodes before v5
+	Checksum *uint32 `protobuf:"varint,5,opt,name=checksum,proto3,oneof" json:"checksum,omitempty"`
+	// value is sealed with a key of the keyring
+	Sealed bool `protobuf:"varint,6,opt,name=sealed,proto3" json:"sealed,omitempty"`
+	// codec compressing the value, 0 uncompressed
+	Compression   uint32 `protobuf:"varint,7,opt,name=compression,proto3" json:"compression,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoteGetResponse) Reset() {
+	*x = RemoteGetResponse{}
+	mi := &file_bus_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoteGetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoteGetResponse) ProtoMessage() {}
+
+func (x *RemoteGetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoteGetResponse.ProtoReflect.Descriptor instead.
+func (*RemoteGetResponse) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *RemoteGetResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *RemoteGetResponse) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+func (x *RemoteGetResponse) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *RemoteGetResponse) GetHlcTs() uint64 {
+	if x != nil {
+		return x.HlcTs
+	}
+	return 0
+}
+
+func (x *RemoteGetResponse) GetChecksum() uint32 {
+	if x != nil && x.Checksum != nil {
+		return *x.Checksum
+	}
+	return 0
+}
+
+func (x *RemoteGetResponse) GetSealed() bool {
+	if x != nil {
+		return x.Sealed
+	}
+	return false
+}
+
+func (x *RemoteGetResponse) GetCompression() uint32 {
+	if x != nil {
+		return x.Compression
+	}
+	return 0
+}
+
+type PingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SenderId      string                 `protobuf:"bytes,1,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingRequest) Reset() {
+	*x = PingRequest{}
+	mi := &file_bus_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingRequest) ProtoMessage() {}
+
+func (x *PingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingRequest.ProtoReflect.Descriptor instead.
+func (*PingRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *PingRequest) GetSenderId() string {
+	if x != nil {
+		return x.SenderId
+	}
+	return ""
+}
+
+type PingReqRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SenderId      string                 `protobuf:"bytes,1,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	TargetId      string                 `protobuf:"bytes,2,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingReqRequest) Reset() {
+	*x = PingReqRequest{}
+	mi := &file_bus_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingReqRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingReqRequest) ProtoMessage() {}
+
+func (x *PingReqRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingReqRequest.ProtoReflect.Descriptor instead.
+func (*PingReqRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *PingReqRequest) GetSenderId() string {
+	if x != nil {
+		return x.SenderId
+	}
+	return ""
+}
+
+func (x *PingReqRequest) GetTargetId() string {
+	if x != nil {
+		return x.TargetId
+	}
+	return ""
+}
+
+type PingAck struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// false when a PING_REQ helper couldn't reach the target
+	Ack           bool   `protobuf:"varint,1,opt,name=ack,proto3" json:"ack,omitempty"`
+	NodeId        string `protobuf:"bytes,2,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	Incarnation   uint64 `protobuf:"varint,3,opt,name=incarnation,proto3" json:"incarnation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingAck) Reset() {
+	*x = PingAck{}
+	mi := &file_bus_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingAck) ProtoMessage() {}
+
+func (x *PingAck) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingAck.ProtoReflect.Descriptor instead.
+func (*PingAck) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *PingAck) GetAck() bool {
+	if x != nil {
+		return x.Ack
+	}
+	return false
+}
+
+func (x *PingAck) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *PingAck) GetIncarnation() uint64 {
+	if x != nil {
+		return x.Incarnation
+	}
+	return 0
+}
+
+type NodeDeadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReporterId    string                 `protobuf:"bytes,1,opt,name=reporter_id,json=reporterId,proto3" json:"reporter_id,omitempty"`
+	TargetId      string                 `protobuf:"bytes,2,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeDeadRequest) Reset() {
+	*x = NodeDeadRequest{}
+	mi := &file_bus_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeDeadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeDeadRequest) ProtoMessage() {}
+
+func (x *NodeDeadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeDeadRequest.ProtoReflect.Descriptor instead.
+func (*NodeDeadRequest) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *NodeDeadRequest) GetReporterId() string {
+	if x != nil {
+		return x.ReporterId
+	}
+	return ""
+}
+
+func (x *NodeDeadRequest) GetTargetId() string {
+	if x != nil {
+		return x.TargetId
+	}
+	return ""
+}
+
+// Hello is exchanged when a bus connection opens, both sides learn the protocol
+// version and the optional features of the other node.
+type Hello struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ServerId        string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	ProtocolVersion uint32                 `protobuf:"varint,2,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	Capabilities    []string               `protobuf:"bytes,3,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_bus_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *Hello) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *Hello) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *Hello) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+type ShowResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShowResponse) Reset() {
+	*x = ShowResponse{}
+	mi := &file_bus_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShowResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShowResponse) ProtoMessage() {}
+
+func (x *ShowResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bus_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShowResponse.ProtoReflect.Descriptor instead.
+func (*ShowResponse) Descriptor() ([]byte, []int) {
+	return file_bus_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *ShowResponse) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+var File_bus_proto protoreflect.FileDescriptor
+
+const file_bus_proto_rawDesc = "" +
+	"\n" +
+	"\tbus.proto\x12\x04main\"L\n" +
+	"\n" +
+	"BusRequest\x12*\n" +
+	"\acommand\x18\x01 \x01(\x0e2\x10.main.BusCommandR\acommand\x12\x12\n" +
+	"\x04body\x18\x02 \x01(\fR\x04body\"7\n" +
+	"\vBusResponse\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x12\x12\n" +
+	"\x04body\x18\x02 \x01(\fR\x04body\"\a\n" +
+	"\x05Empty\"\x8c\x01\n" +
+	"\x04Node\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\x12\x12\n" +
+	"\x04addr\x18\x02 \x01(\tR\x04addr\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\x05R\x06status\x12\x14\n" +
+	"\x05group\x18\x04 \x01(\tR\x05group\x12%\n" +
+	"\x0eresource_score\x18\x05 \x01(\x01R\rresourceScore\"\x92\x01\n" +
+	"\tSlotRange\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\rR\x03end\x12\x1b\n" +
+	"\tmaster_id\x18\x03 \x01(\tR\bmasterId\x12\x14\n" +
+	"\x05nodes\x18\x04 \x03(\tR\x05nodes\x12*\n" +
+	"\x11async_cross_group\x18\x05 \x01(\bR\x0fasyncCrossGroup\"\xf1\x01\n" +
+	"\x0fClusterSnapshot\x12'\n" +
+	"\x0fcluster_version\x18\x01 \x01(\x04R\x0eclusterVersion\x12\x1f\n" +
+	"\vtotal_nodes\x18\x02 \x01(\rR\n" +
+	"totalNodes\x12\x1f\n" +
+	"\vtotal_slots\x18\x03 \x01(\rR\n" +
+	"totalSlots\x12 \n" +
+	"\x05nodes\x18\x04 \x03(\v2\n" +
+	".main.NodeR\x05nodes\x12+\n" +
+	"\bmetadata\x18\x05 \x03(\v2\x0f.main.SlotRangeR\bmetadata\x12$\n" +
+	"\x0emaster_node_id\x18\x06 \x01(\tR\fmasterNodeId\"\\\n" +
+	"\x0fClusterMetadata\x12'\n" +
+	"\x06ranges\x18\x01 \x03(\v2\x0f.main.SlotRangeR\x06ranges\x12 \n" +
+	"\x05nodes\x18\x02 \x03(\v2\n" +
+	".main.NodeR\x05nodes\"{\n" +
+	"\vJoinRequest\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\tR\x04port\x12%\n" +
+	"\x0eresource_score\x18\x03 \x01(\x01R\rresourceScore\x12\x14\n" +
+	"\x05group\x18\x04 \x01(\tR\x05group\"2\n" +
+	"\bSlotSpan\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\rR\x03end\"\xaa\x01\n" +
+	"\fJoinResponse\x121\n" +
+	"\bsnapshot\x18\x01 \x01(\v2\x15.main.ClusterSnapshotR\bsnapshot\x12\x16\n" +
+	"\x06rejoin\x18\x02 \x01(\bR\x06rejoin\x12&\n" +
+	"\x06ranges\x18\x03 \x03(\v2\x0e.main.SlotSpanR\x06ranges\x12'\n" +
+	"\x0fcluster_version\x18\x04 \x01(\x04R\x0eclusterVersion\"\xe4\x02\n" +
+	"\x0ePrepareRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\tR\tmessageId\x12$\n" +
+	"\x0etarget_node_id\x18\x02 \x01(\tR\ftargetNodeId\x12(\n" +
+	"\x10target_node_addr\x18\x03 \x01(\tR\x0etargetNodeAddr\x12\x14\n" +
+	"\x05start\x18\x04 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x05 \x01(\rR\x03end\x12(\n" +
+	"\x10modified_node_id\x18\x06 \x01(\tR\x0emodifiedNodeId\x12+\n" +
+	"\x11modified_replicas\x18\a \x03(\tR\x10modifiedReplicas\x12'\n" +
+	"\x0ftarget_replicas\x18\b \x03(\tR\x0etargetReplicas\x12%\n" +
+	"\x0eresource_score\x18\t \x01(\x01R\rresourceScore\x12\x14\n" +
+	"\x05group\x18\n" +
+	" \x01(\tR\x05group\".\n" +
+	"\rCommitRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\tR\tmessageId\"\x97\x01\n" +
+	"\x0eMetadataUpdate\x12&\n" +
+	"\x02op\x18\x01 \x01(\x0e2\x16.main.MetadataUpdateOpR\x02op\x12\x1b\n" +
+	"\tserver_id\x18\x02 \x01(\tR\bserverId\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\rR\x03end\x12\x18\n" +
+	"\aenabled\x18\x05 \x01(\bR\aenabled\"+\n" +
+	"\fLeaveRequest\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\"\x90\x01\n" +
+	"\x10HeartbeatRequest\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\x12 \n" +
+	"\vunreachable\x18\x02 \x03(\tR\vunreachable\x12\x14\n" +
+	"\x05group\x18\x03 \x01(\tR\x05group\x12'\n" +
+	"\x0fcluster_version\x18\x04 \x01(\x04R\x0eclusterVersion\"B\n" +
+	"\x11HeartbeatResponse\x12-\n" +
+	"\x06status\x18\x01 \x01(\x0e2\x15.main.HeartbeatStatusR\x06status\"\x83\x01\n" +
+	"\vVoteRequest\x12!\n" +
+	"\fcandidate_id\x18\x01 \x01(\tR\vcandidateId\x12(\n" +
+	"\x10failed_master_id\x18\x02 \x01(\tR\x0efailedMasterId\x12'\n" +
+	"\x0fcluster_version\x18\x03 \x01(\x04R\x0eclusterVersion\"(\n" +
+	"\fVoteResponse\x12\x18\n" +
+	"\agranted\x18\x01 \x01(\bR\agranted\"y\n" +
+	"\x14SuspectLeaderRequest\x12\x1b\n" +
+	"\tsender_id\x18\x01 \x01(\tR\bsenderId\x12\x1b\n" +
+	"\tmaster_id\x18\x02 \x01(\tR\bmasterId\x12'\n" +
+	"\x0fcluster_version\x18\x03 \x01(\x04R\x0eclusterVersion\"\x85\x01\n" +
+	"\rInsertRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12\x1e\n" +
+	"\n" +
+	"durability\x18\x03 \x01(\tR\n" +
+	"durability\x12\x1f\n" +
+	"\bchecksum\x18\x04 \x01(\rH\x00R\bchecksum\x88\x01\x01B\v\n" +
+	"\t_checksum\"\xd3\x01\n" +
+	"\x10ReplicateRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12\x15\n" +
+	"\x06hlc_ts\x18\x03 \x01(\x04R\x05hlcTs\x12\x1f\n" +
+	"\bchecksum\x18\x04 \x01(\rH\x00R\bchecksum\x88\x01\x01\x12\x16\n" +
+	"\x06sealed\x18\x05 \x01(\bR\x06sealed\x12 \n" +
+	"\vcompression\x18\x06 \x01(\rR\vcompression\x12\x18\n" +
+	"\adeleted\x18\a \x01(\bR\adeletedB\v\n" +
+	"\t_checksum\"\xb6\x01\n" +
+	"\x0eReplicateBatch\x12\x1b\n" +
+	"\tmaster_id\x18\x01 \x01(\tR\bmasterId\x12\x1b\n" +
+	"\tfirst_seq\x18\x02 \x01(\x04R\bfirstSeq\x120\n" +
+	"\aentries\x18\x03 \x03(\v2\x16.main.ReplicateRequestR\aentries\x12\x1b\n" +
+	"\tstream_id\x18\x04 \x01(\x04R\bstreamId\x12\x1b\n" +
+	"\tacked_seq\x18\x05 \x01(\x04R\backedSeq\"J\n" +
+	"\x11ReplicateBatchAck\x12\x1b\n" +
+	"\tacked_seq\x18\x01 \x01(\x04R\backedSeq\x12\x18\n" +
+	"\aapplied\x18\x02 \x01(\rR\aapplied\"\x87\x01\n" +
+	"\bSstChunk\x12\x1f\n" +
+	"\vtransfer_id\x18\x01 \x01(\tR\n" +
+	"transferId\x12\x12\n" +
+	"\x04file\x18\x02 \x01(\rR\x04file\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x04R\x06offset\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\x12\x1a\n" +
+	"\bchecksum\x18\x05 \x01(\rR\bchecksum\"M\n" +
+	"\aSstFile\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\rR\x04file\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x04R\x04size\x12\x1a\n" +
+	"\bchecksum\x18\x03 \x01(\rR\bchecksum\"y\n" +
+	"\tSstIngest\x12\x1f\n" +
+	"\vtransfer_id\x18\x01 \x01(\tR\n" +
+	"transferId\x12\x14\n" +
+	"\x05start\x18\x02 \x01(\rR\x05start\x12\x10\n" +
+	"\x03end\x18\x03 \x01(\rR\x03end\x12#\n" +
+	"\x05files\x18\x04 \x03(\v2\r.main.SstFileR\x05files\"$\n" +
+	"\fSstIngestAck\x12\x14\n" +
+	"\x05bytes\x18\x01 \x01(\x04R\x05bytes\"\xbc\x01\n" +
+	"\x11ReplicationOffset\x12\x1b\n" +
+	"\tmaster_id\x18\x01 \x01(\tR\bmasterId\x12\x10\n" +
+	"\x03seq\x18\x02 \x01(\x04R\x03seq\x12$\n" +
+	"\x0emaster_unix_ms\x18\x03 \x01(\x03R\fmasterUnixMs\x12\x18\n" +
+	"\adropped\x18\x04 \x01(\x04R\adropped\x12\x1b\n" +
+	"\tstream_id\x18\x05 \x01(\x04R\bstreamId\x12\x1b\n" +
+	"\tacked_seq\x18\x06 \x01(\x04R\backedSeq\"N\n" +
+	"\x10RemoteGetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12(\n" +
+	"\x10max_staleness_ms\x18\x02 \x01(\x03R\x0emaxStalenessMs\"\xd4\x01\n" +
+	"\x11RemoteGetResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x14\n" +
+	"\x05stale\x18\x02 \x01(\bR\x05stale\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\fR\x05value\x12\x15\n" +
+	"\x06hlc_ts\x18\x04 \x01(\x04R\x05hlcTs\x12\x1f\n" +
+	"\bchecksum\x18\x05 \x01(\rH\x00R\bchecksum\x88\x01\x01\x12\x16\n" +
+	"\x06sealed\x18\x06 \x01(\bR\x06sealed\x12 \n" +
+	"\vcompression\x18\a \x01(\rR\vcompressionB\v\n" +
+	"\t_checksum\"*\n" +
+	"\vPingRequest\x12\x1b\n" +
+	"\tsender_id\x18\x01 \x01(\tR\bsenderId\"J\n" +
+	"\x0ePingReqRequest\x12\x1b\n" +
+	"\tsender_id\x18\x01 \x01(\tR\bsenderId\x12\x1b\n" +
+	"\ttarget_id\x18\x02 \x01(\tR\btargetId\"V\n" +
+	"\aPingAck\x12\x10\n" +
+	"\x03ack\x18\x01 \x01(\bR\x03ack\x12\x17\n" +
+	"\anode_id\x18\x02 \x01(\tR\x06nodeId\x12 \n" +
+	"\vincarnation\x18\x03 \x01(\x04R\vincarnation\"O\n" +
+	"\x0fNodeDeadRequest\x12\x1f\n" +
+	"\vreporter_id\x18\x01 \x01(\tR\n" +
+	"reporterId\x12\x1b\n" +
+	"\ttarget_id\x18\x02 \x01(\tR\btargetId\"s\n" +
+	"\x05Hello\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\x12)\n" +
+	"\x10protocol_version\x18\x02 \x01(\rR\x0fprotocolVersion\x12\"\n" +
+	"\fcapabilities\x18\x03 \x03(\tR\fcapabilities\"\"\n" +
+	"\fShowResponse\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text*\xf0\x02\n" +
+	"\n" +
+	"BusCommand\x12\x13\n" +
+	"\x0fUNKNOWN_COMMAND\x10\x00\x12\f\n" +
+	"\bBUS_PING\x10\x01\x12\b\n" +
+	"\x04JOIN\x10\x02\x12\v\n" +
+	"\aPREPARE\x10\x03\x12\n" +
+	"\n" +
+	"\x06COMMIT\x10\x04\x12\f\n" +
+	"\bSNAPSHOT\x10\x05\x12\x10\n" +
+	"\fREQ_METADATA\x10\x06\x12\x14\n" +
+	"\x10CLUSTER_METADATA\x10\a\x12\a\n" +
+	"\x03CMU\x10\b\x12\t\n" +
+	"\x05LEAVE\x10\t\x12\r\n" +
+	"\tHEARTBEAT\x10\n" +
+	"\x12\f\n" +
+	"\bREQ_VOTE\x10\v\x12\x12\n" +
+	"\x0eSUSPECT_LEADER\x10\f\x12\a\n" +
+	"\x03INS\x10\r\x12\a\n" +
+	"\x03REP\x10\x0e\x12\x0f\n" +
+	"\vREPL_OFFSET\x10\x0f\x12\b\n" +
+	"\x04RGET\x10\x10\x12\n" +
+	"\n" +
+	"\x06GOSSIP\x10\x11\x12\b\n" +
+	"\x04PING\x10\x12\x12\f\n" +
+	"\bPING_REQ\x10\x13\x12\r\n" +
+	"\tNODE_DEAD\x10\x14\x12\b\n" +
+	"\x04SHOW\x10\x15\x12\t\n" +
+	"\x05HELLO\x10\x16\x12\r\n" +
+	"\tREP_BATCH\x10\x17\x12\r\n" +
+	"\tSST_CHUNK\x10\x18\x12\x0e\n" +
+	"\n" +
+	"SST_INGEST\x10\x19*N\n" +
+	"\x10MetadataUpdateOp\x12\x0f\n" +
+	"\vREPLICA_ADD\x10\x00\x12\x12\n" +
+	"\x0eREPAIR_REQUEST\x10\x01\x12\x15\n" +
+	"\x11ASYNC_REPLICATION\x10\x02*X\n" +
+	"\x0fHeartbeatStatus\x12\x10\n" +
+	"\fHEARTBEAT_OK\x10\x00\x12\x1e\n" +
+	"\x1aHEARTBEAT_VERSION_MISMATCH\x10\x01\x12\x13\n" +
+	"\x0fHEARTBEAT_ERROR\x10\x02B\x06Z\x04./pbb\x06proto3"
+
+var (
+	file_bus_proto_rawDescOnce sync.Once
+	file_bus_proto_rawDescData []byte
+)
+
+func file_bus_proto_rawDescGZIP() []byte {
+	file_bus_proto_rawDescOnce.Do(func() {
+		file_bus_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_bus_proto_rawDesc), len(file_bus_proto_rawDesc)))
+	})
+	return file_bus_proto_rawDescData
+}
+
+var file_bus_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_bus_proto_msgTypes = make([]protoimpl.MessageInfo, 36)
+var file_bus_proto_goTypes = []any{
+	(BusCommand)(0),              // 0: main.BusCommand
+	(MetadataUpdateOp)(0),        // 1: main.MetadataUpdateOp
+	(HeartbeatStatus)(0),         // 2: main.HeartbeatStatus
+	(*BusRequest)(nil),           // 3: main.BusRequest
+	(*BusResponse)(nil),          // 4: main.BusResponse
+	(*Empty)(nil),                // 5: main.Empty
+	(*Node)(nil),                 // 6: main.Node
+	(*SlotRange)(nil),            // 7: main.SlotRange
+	(*ClusterSnapshot)(nil),      // 8: main.ClusterSnapshot
+	(*ClusterMetadata)(nil),      // 9: main.ClusterMetadata
+	(*JoinRequest)(nil),          // 10: main.JoinRequest
+	(*SlotSpan)(nil),             // 11: main.SlotSpan
+	(*JoinResponse)(nil),         // 12: main.JoinResponse
+	(*PrepareRequest)(nil),       // 13: main.PrepareRequest
+	(*CommitRequest)(nil),        // 14: main.CommitRequest
+	(*MetadataUpdate)(nil),       // 15: main.MetadataUpdate
+	(*LeaveRequest)(nil),         // 16: main.LeaveRequest
+	(*HeartbeatRequest)(nil),     // 17: main.HeartbeatRequest
+	(*HeartbeatResponse)(nil),    // 18: main.HeartbeatResponse
+	(*VoteRequest)(nil),          // 19: main.VoteRequest
+	(*VoteResponse)(nil),         // 20: main.VoteResponse
+	(*SuspectLeaderRequest)(nil), // 21: main.SuspectLeaderRequest
+	(*InsertRequest)(nil),        // 22: main.InsertRequest
+	(*ReplicateRequest)(nil),     // 23: main.ReplicateRequest
+	(*ReplicateBatch)(nil),       // 24: main.ReplicateBatch
+	(*ReplicateBatchAck)(nil),    // 25: main.ReplicateBatchAck
+	(*SstChunk)(nil),             // 26: main.SstChunk
+	(*SstFile)(nil),              // 27: main.SstFile
+	(*SstIngest)(nil),            // 28: main.SstIngest
+	(*SstIngestAck)(nil),         // 29: main.SstIngestAck
+	(*ReplicationOffset)(nil),    // 30: main.ReplicationOffset
+	(*RemoteGetRequest)(nil),     // 31: main.RemoteGetRequest
+	(*RemoteGetResponse)(nil),    // 32: main.RemoteGetResponse
+	(*PingRequest)(nil),          // 33: main.PingRequest
+	(*PingReqRequest)(nil),       // 34: main.PingReqRequest
+	(*PingAck)(nil),              // 35: main.PingAck
+	(*NodeDeadRequest)(nil),      // 36: main.NodeDeadRequest
+	(*Hello)(nil),                // 37: main.Hello
+	(*ShowResponse)(nil),         // 38: main.ShowResponse
+}
+var file_bus_proto_depIdxs = []int32{
+	0,  // 0: main.BusRequest.command:type_name -> main.BusCommand
+	6,  // 1: main.ClusterSnapshot.nodes:type_name -> main.Node
+	7,  // 2: main.ClusterSnapshot.metadata:type_name -> main.SlotRange
+	7,  // 3: main.ClusterMetadata.ranges:type_name -> main.SlotRange
+	6,  // 4: main.ClusterMetadata.nodes:type_name -> main.Node
+	8,  // 5: main.JoinResponse.snapshot:type_name -> main.ClusterSnapshot
+	11, // 6: main.JoinResponse.ranges:type_name -> main.SlotSpan
+	1,  // 7: main.MetadataUpdate.op:type_name -> main.MetadataUpdateOp
+	2,  // 8: main.HeartbeatResponse.status:type_name -> main.HeartbeatStatus
+	23, // 9: main.ReplicateBatch.entries:type_name -> main.ReplicateRequest
+	27, // 10: main.SstIngest.files:type_name -> main.SstFile
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_bus_proto_init() }
+func file_bus_proto_init() {
+	if File_bus_proto != nil {
+		return
+	}
+	file_bus_proto_msgTypes[19].OneofWrappers = []any{}
+	file_bus_proto_msgTypes[20].OneofWrappers = []any{}
+	file_bus_proto_msgTypes[29].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_bus_proto_rawDesc), len(file_bus_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   36,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_bus_proto_goTypes,
+		DependencyIndexes: file_bus_proto_depIdxs,
+		EnumInfos:         file_bus_proto_enumTypes,
+		MessageInfos:      file_bus_proto_msgTypes,
+	}.Build()
+	File_bus_proto = out.File
+	file_bus_proto_goTypes = nil
+	file_bus_proto_depIdxs = nil
+}
@@ -125,8 +125,12 @@ type NodeState struct {
 	LastSeen       int64  `protobuf:"varint,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
 	SuspicionCount int32  `protobuf:"varint,5,opt,name=suspicion_count,json=suspicionCount,proto3" json:"suspicion_count,omitempty"`
 	Version        uint64 `protobuf:"varint,6,opt,name=version,proto3" json:"version,omitempty"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+	// incremented by the owning node on every gossip round
+	Heartbeat uint64 `protobuf:"varint,7,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
+	// SWIM incarnation number, only the owning node increments it to refute suspicion
+	Incarnation   uint64 `protobuf:"varint,8,opt,name=incarnation,proto3" json:"incarnation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *NodeState) Reset() {
@@ -201,13 +205,31 @@ func (x *NodeState) GetVersion() uint64 {
 	return 0
 }
 
+func (x *NodeState) GetHeartbeat() uint64 {
+	if x != nil {
+		return x.Heartbeat
+	}
+	return 0
+}
+
+func (x *NodeState) GetIncarnation() uint64 {
+	if x != nil {
+		return x.Incarnation
+	}
+	return 0
+}
+
 type GossipMessage struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	MessageType   MessageType            `protobuf:"varint,1,opt,name=message_type,json=messageType,proto3,enum=main.MessageType" json:"message_type,omitempty"`
-	SenderId      string                 `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
-	States        []*NodeState           `protobuf:"bytes,3,rep,name=states,proto3" json:"states,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	MessageType MessageType            `protobuf:"varint,1,opt,name=message_type,json=messageType,proto3,enum=main.MessageType" json:"message_type,omitempty"`
+	SenderId    string                 `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	States      []*NodeState           `protobuf:"bytes,3,rep,name=states,proto3" json:"states,omitempty"`
+	// the sender's view of the cluster metadata, lets metadata changes spread
+	// through gossip even when the master is unreachable
+	ClusterVersion uint64 `protobuf:"varint,4,opt,name=cluster_version,json=clusterVersion,proto3" json:"cluster_version,omitempty"`
+	MetadataHash   uint64 `protobuf:"varint,5,opt,name=metadata_hash,json=metadataHash,proto3" json:"metadata_hash,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *GossipMessage) Reset() {
@@ -261,22 +283,40 @@ func (x *GossipMessage) GetStates() []*NodeState {
 	return nil
 }
 
+func (x *GossipMessage) GetClusterVersion() uint64 {
+	if x != nil {
+		return x.ClusterVersion
+	}
+	return 0
+}
+
+func (x *GossipMessage) GetMetadataHash() uint64 {
+	if x != nil {
+		return x.MetadataHash
+	}
+	return 0
+}
+
 var File_gossip_proto protoreflect.FileDescriptor
 
 const file_gossip_proto_rawDesc = "" +
 	"\n" +
-	"\fgossip.proto\x12\x04main\"\xc4\x01\n" +
+	"\fgossip.proto\x12\x04main\"\x84\x02\n" +
 	"\tNodeState\x12\x17\n" +
 	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x14\n" +
 	"\x05group\x18\x02 \x01(\tR\x05group\x12(\n" +
 	"\x06health\x18\x03 \x01(\x0e2\x10.main.NodeHealthR\x06health\x12\x1b\n" +
 	"\tlast_seen\x18\x04 \x01(\x03R\blastSeen\x12'\n" +
 	"\x0fsuspicion_count\x18\x05 \x01(\x05R\x0esuspicionCount\x12\x18\n" +
-	"\aversion\x18\x06 \x01(\x04R\aversion\"\x8b\x01\n" +
+	"\aversion\x18\x06 \x01(\x04R\aversion\x12\x1c\n" +
+	"\theartbeat\x18\a \x01(\x04R\theartbeat\x12 \n" +
+	"\vincarnation\x18\b \x01(\x04R\vincarnation\"\xd9\x01\n" +
 	"\rGossipMessage\x124\n" +
 	"\fmessage_type\x18\x01 \x01(\x0e2\x11.main.MessageTypeR\vmessageType\x12\x1b\n" +
 	"\tsender_id\x18\x02 \x01(\tR\bsenderId\x12'\n" +
-	"\x06states\x18\x03 \x03(\v2\x0f.main.NodeStateR\x06states*.\n" +
+	"\x06states\x18\x03 \x03(\v2\x0f.main.NodeStateR\x06states\x12'\n" +
+	"\x0fcluster_version\x18\x04 \x01(\x04R\x0eclusterVersion\x12#\n" +
+	"\rmetadata_hash\x18\x05 \x01(\x04R\fmetadataHash*.\n" +
 	"\n" +
 	"NodeHealth\x12\t\n" +
 	"\x05ALIVE\x10\x00\x12\v\n" +
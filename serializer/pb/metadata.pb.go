@@ -0,0 +1,193 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v7.35.0--rc2
+// source: metadata.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// NodeMetadata is the state a node persists to come back with the same identity after a
+// restart. It is stored in a versioned envelope, see config/metadata_store.go. Only
+// durable state goes here, everything the node rebuilds at runtime (prepared messages,
+// votes, heartbeats, failure detector state) is left out.
+type NodeMetadata struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	ServerId          string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	Host              string                 `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+	Addr              string                 `protobuf:"bytes,3,opt,name=addr,proto3" json:"addr,omitempty"`
+	Port              string                 `protobuf:"bytes,4,opt,name=port,proto3" json:"port,omitempty"`
+	BusPort           string                 `protobuf:"bytes,5,opt,name=bus_port,json=busPort,proto3" json:"bus_port,omitempty"`
+	ReplicationFactor int32                  `protobuf:"varint,6,opt,name=replication_factor,json=replicationFactor,proto3" json:"replication_factor,omitempty"`
+	ResourceScore     float64                `protobuf:"fixed64,7,opt,name=resource_score,json=resourceScore,proto3" json:"resource_score,omitempty"`
+	// the last view of the cluster: nodes, slot ranges, version and master
+	Cluster       *ClusterSnapshot `protobuf:"bytes,8,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeMetadata) Reset() {
+	*x = NodeMetadata{}
+	mi := &file_metadata_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeMetadata) ProtoMessage() {}
+
+func (x *NodeMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_metadata_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeMetadata.ProtoReflect.Descriptor instead.
+func (*NodeMetadata) Descriptor() ([]byte, []int) {
+	return file_metadata_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *NodeMetadata) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *NodeMetadata) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *NodeMetadata) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *NodeMetadata) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *NodeMetadata) GetBusPort() string {
+	if x != nil {
+		return x.BusPort
+	}
+	return ""
+}
+
+func (x *NodeMetadata) GetReplicationFactor() int32 {
+	if x != nil {
+		return x.ReplicationFactor
+	}
+	return 0
+}
+
+func (x *NodeMetadata) GetResourceScore() float64 {
+	if x != nil {
+		return x.ResourceScore
+	}
+	return 0
+}
+
+func (x *NodeMetadata) GetCluster() *ClusterSnapshot {
+	if x != nil {
+		return x.Cluster
+	}
+	return nil
+}
+
+var File_metadata_proto protoreflect.FileDescriptor
+
+const file_metadata_proto_rawDesc = "" +
+	"\n" +
+	"\x0emetadata.proto\x12\x04main\x1a\tbus.proto\"\x89\x02\n" +
+	"\fNodeMetadata\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\x12\x12\n" +
+	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
+	"\x04addr\x18\x03 \x01(\tR\x04addr\x12\x12\n" +
+	"\x04port\x18\x04 \x01(\tR\x04port\x12\x19\n" +
+	"\bbus_port\x18\x05 \x01(\tR\abusPort\x12-\n" +
+	"\x12replication_factor\x18\x06 \x01(\x05R\x11replicationFactor\x12%\n" +
+	"\x0eresource_score\x18\a \x01(\x01R\rresourceScore\x12/\n" +
+	"\acluster\x18\b \x01(\v2\x15.main.ClusterSnapshotR\aclusterB\x06Z\x04./pbb\x06proto3"
+
+var (
+	file_metadata_proto_rawDescOnce sync.Once
+	file_metadata_proto_rawDescData []byte
+)
+
+func file_metadata_proto_rawDescGZIP() []byte {
+	file_metadata_proto_rawDescOnce.Do(func() {
+		file_metadata_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_metadata_proto_rawDesc), len(file_metadata_proto_rawDesc)))
+	})
+	return file_metadata_proto_rawDescData
+}
+
+var file_metadata_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_metadata_proto_goTypes = []any{
+	(*NodeMetadata)(nil),    // 0: main.NodeMetadata
+	(*ClusterSnapshot)(nil), // 1: main.ClusterSnapshot
+}
+var file_metadata_proto_depIdxs = []int32{
+	1, // 0: main.NodeMetadata.cluster:type_name -> main.ClusterSnapshot
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_metadata_proto_init() }
+func file_metadata_proto_init() {
+	if File_metadata_proto != nil {
+		return
+	}
+	file_bus_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_metadata_proto_rawDesc), len(file_metadata_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_metadata_proto_goTypes,
+		DependencyIndexes: file_metadata_proto_depIdxs,
+		MessageInfos:      file_metadata_proto_msgTypes,
+	}.Build()
+	File_metadata_proto = out.File
+	file_metadata_proto_goTypes = nil
+	file_metadata_proto_depIdxs = nil
+}
@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+/*
+In-memory backend.
+
+The keys live in a map, a sorted index of the keys is rebuilt on the first scan after a
+write. Gets and writes don't depend on the number of keys, a scan sorts the keys once per
+burst of writes. Iterators and snapshots copy what they read, they never see later writes.
+Durability settings are ignored, there is nothing to sync.
+*/
+
+const KIND_MEMORY = "memory"
+
+type Memory struct {
+	mu     sync.RWMutex
+	data   map[string][]byte
+	sorted []string // keys of data in order, nil after a write
+	size   uint64   // bytes of keys and values
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: make(map[string][]byte)}
+}
+
+func (m *Memory) Get(key []byte) ([]byte, io.Closer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, nil, ErrClosed
+	}
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return value, noopCloser{}, nil
+}
+
+// keysIn returns the sorted keys in span, the index is rebuilt if a write dropped it.
+// The slice is never modified, a rebuild allocates a new one.
+func (m *Memory) keysIn(span Span) []string {
+	m.mu.RLock()
+	sorted := m.sorted
+	m.mu.RUnlock()
+
+	if sorted == nil {
+		m.mu.Lock()
+		if m.sorted == nil {
+			m.sorted = make([]string, 0, len(m.data))
+			for key := range m.data {
+				m.sorted = append(m.sorted, key)
+			}
+			sort.Strings(m.sorted)
+		}
+		sorted = m.sorted
+		m.mu.Unlock()
+	}
+
+	from := 0
+	if span.Lower != nil {
+		from = sort.SearchStrings(sorted, string(span.Lower))
+	}
+	to := len(sorted)
+	if span.Upper != nil {
+		to = sort.SearchStrings(sorted, string(span.Upper))
+	}
+	if from >= to {
+		return nil
+	}
+	return sorted[from:to]
+}
+
+func (m *Memory) NewIter(span Span) (Iterator, error) {
+	keys := m.keysIn(span)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	it := &memIterator{pos: -1}
+	for _, key := range keys {
+		// the index may be older than a delete
+		if value, ok := m.data[key]; ok {
+			it.keys = append(it.keys, []byte(key))
+			it.values = append(it.values, value)
+		}
+	}
+	return it, nil
+}
+
+// write applies ops under the write lock, m.sorted is dropped when a key is added or removed.
+func (m *Memory) write(ops []memOp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	for _, op := range ops {
+		if op.deleteUpTo != nil {
+			for key, value := range m.data {
+				if key >= string(op.key) && key < string(op.deleteUpTo) {
+					delete(m.data, key)
+					m.size -= uint64(len(key) + len(value))
+					m.sorted = nil
+				}
+			}
+			continue
+		}
+
+		old, existed := m.data[string(op.key)]
+		if existed {
+			m.size -= uint64(len(op.key) + len(old))
+		}
+		if op.delete {
+			if existed {
+				delete(m.data, string(op.key))
+				m.sorted = nil
+			}
+		} else {
+			// values are never modified in place, readers keep the slice they got
+			m.data[string(op.key)] = append([]byte{}, op.value...)
+			m.size += uint64(len(op.key) + len(op.value))
+			if !existed {
+				m.sorted = nil
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Set(key, value []byte, _ bool) error {
+	return m.write([]memOp{{key: key, value: value}})
+}
+
+func (m *Memory) Delete(key []byte, _ bool) error {
+	return m.write([]memOp{{key: key, delete: true}})
+}
+
+func (m *Memory) DeleteRange(span Span, _ bool) error {
+	upper := span.Upper
+	if upper == nil {
+		return fmt.Errorf("DeleteRange needs an upper bound")
+	}
+	return m.write([]memOp{{key: span.Lower, deleteUpTo: upper}})
+}
+
+func (m *Memory) NewBatch() Batch        { return &memBatch{m: m} }
+func (m *Memory) NewIndexedBatch() Batch { return &memBatch{m: m, index: make(map[string]memOp)} }
+
+// NewSnapshot copies the whole map, keep snapshots for bulk operations.
+func (m *Memory) NewSnapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snap := NewMemory()
+	for key, value := range m.data {
+		snap.data[key] = value
+	}
+	snap.size = m.size
+	return snap
+}
+
+// Ingest reads the keys of SST files into the map, in one write.
+func (m *Memory) Ingest(paths []string) error {
+	var ops []memOp
+	for _, path := range paths {
+		if err := readSST(path, func(key, value []byte) {
+			ops = append(ops, memOp{key: append([]byte{}, key...), value: value})
+		}); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return m.write(ops)
+}
+
+func readSST(path string, fn func(key, value []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r, err := sstable.NewReader(readable, sstable.ReaderOptions{})
+	if err != nil {
+		readable.Close()
+		return err
+	}
+	defer r.Close()
+
+	iter, err := r.NewIter(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for k, lv := iter.First(); k != nil; k, lv = iter.Next() {
+		value, _, err := lv.Value(nil)
+		if err != nil {
+			return err
+		}
+		fn(k.UserKey, append([]byte{}, value...))
+	}
+	return iter.Error()
+}
+
+func (m *Memory) SyncWAL() error { return nil }
+func (m *Memory) Flush() error   { return nil }
+
+func (m *Memory) Compact(Span) error { return nil }
+
+// EstimateDiskUsage returns the bytes of the keys and values in span, nothing is on disk.
+func (m *Memory) EstimateDiskUsage(span Span) (uint64, error) {
+	keys := m.keysIn(span)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	total := uint64(0)
+	for _, key := range keys {
+		if value, ok := m.data[key]; ok {
+			total += uint64(len(key) + len(value))
+		}
+	}
+	return total, nil
+}
+
+func (m *Memory) Metrics() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fmt.Sprintf("Memory Storage | Keys: %d | Bytes: %d\n", len(m.data), m.size)
+}
+
+func (m *Memory) Kind() string { return KIND_MEMORY }
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.data = nil
+	m.sorted = nil
+	return nil
+}
+
+type memOp struct {
+	key, value []byte
+	delete     bool
+	deleteUpTo []byte // DeleteRange of [key, deleteUpTo)
+}
+
+type memBatch struct {
+	m     *Memory
+	ops   []memOp
+	index map[string]memOp // last write of every key, only in indexed batches
+}
+
+func (b *memBatch) Get(key []byte) ([]byte, io.Closer, error) {
+	if b.index != nil {
+		if op, ok := b.index[string(key)]; ok {
+			if op.delete {
+				return nil, nil, ErrNotFound
+			}
+			return op.value, noopCloser{}, nil
+		}
+	}
+	return b.m.Get(key)
+}
+
+func (b *memBatch) add(op memOp) {
+	b.ops = append(b.ops, op)
+	if b.index != nil {
+		b.index[string(op.key)] = op
+	}
+}
+
+func (b *memBatch) Set(key, value []byte) error {
+	b.add(memOp{key: append([]byte{}, key...), value: append([]byte{}, value...)})
+	return nil
+}
+
+func (b *memBatch) Delete(key []byte) error {
+	b.add(memOp{key: append([]byte{}, key...), delete: true})
+	return nil
+}
+
+func (b *memBatch) Apply(other Batch) error {
+	o, ok := other.(*memBatch)
+	if !ok {
+		return fmt.Errorf("can't apply a %T to a memory batch", other)
+	}
+	for _, op := range o.ops {
+		b.add(op)
+	}
+	return nil
+}
+
+func (b *memBatch) Empty() bool         { return len(b.ops) == 0 }
+func (b *memBatch) Commit(_ bool) error { return b.m.write(b.ops) }
+func (b *memBatch) Close() error        { b.ops, b.index = nil, nil; return nil }
+
+type memIterator struct {
+	keys, values [][]byte
+	pos          int
+}
+
+func (it *memIterator) First() bool {
+	it.pos = 0
+	return it.Valid()
+}
+
+func (it *memIterator) Next() bool {
+	it.pos++
+	return it.Valid()
+}
+
+func (it *memIterator) Valid() bool   { return it.pos >= 0 && it.pos < len(it.keys) }
+func (it *memIterator) Key() []byte   { return it.keys[it.pos] }
+func (it *memIterator) Value() []byte { return it.values[it.pos] }
+func (it *memIterator) Error() error  { return nil }
+func (it *memIterator) Close() error  { return nil }
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const KIND_PEBBLE = "pebble"
+
+// Pebble is the Store on disk.
+type Pebble struct {
+	db *pebble.DB
+}
+
+func NewPebble(db *pebble.DB) *Pebble {
+	return &Pebble{db: db}
+}
+
+func writeOptions(sync bool) *pebble.WriteOptions {
+	if sync {
+		return pebble.Sync
+	}
+	return pebble.NoSync
+}
+
+func pebbleGet(r pebble.Reader, key []byte) ([]byte, io.Closer, error) {
+	value, closer, err := r.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, nil, ErrNotFound
+	}
+	return value, closer, err
+}
+
+func pebbleIter(r pebble.Reader, span Span) (Iterator, error) {
+	return r.NewIter(&pebble.IterOptions{LowerBound: span.Lower, UpperBound: span.Upper})
+}
+
+func (p *Pebble) Get(key []byte) ([]byte, io.Closer, error) { return pebbleGet(p.db, key) }
+func (p *Pebble) NewIter(span Span) (Iterator, error)       { return pebbleIter(p.db, span) }
+
+func (p *Pebble) Set(key, value []byte, sync bool) error {
+	return p.db.Set(key, value, writeOptions(sync))
+}
+
+func (p *Pebble) Delete(key []byte, sync bool) error {
+	return p.db.Delete(key, writeOptions(sync))
+}
+
+func (p *Pebble) DeleteRange(span Span, sync bool) error {
+	return p.db.DeleteRange(span.Lower, span.Upper, writeOptions(sync))
+}
+
+func (p *Pebble) NewBatch() Batch        { return &pebbleBatch{b: p.db.NewBatch()} }
+func (p *Pebble) NewIndexedBatch() Batch { return &pebbleBatch{b: p.db.NewIndexedBatch()} }
+func (p *Pebble) NewSnapshot() Snapshot  { return &pebbleSnapshot{s: p.db.NewSnapshot()} }
+
+func (p *Pebble) Ingest(paths []string) error { return p.db.Ingest(paths) }
+
+// SyncWAL writes an empty synced record, the WAL is flushed with everything before it.
+func (p *Pebble) SyncWAL() error { return p.db.LogData(nil, pebble.Sync) }
+
+func (p *Pebble) Flush() error { return p.db.Flush() }
+
+func (p *Pebble) Compact(span Span) error {
+	return p.db.Compact(span.Lower, span.Upper, true)
+}
+
+func (p *Pebble) EstimateDiskUsage(span Span) (uint64, error) {
+	return p.db.EstimateDiskUsage(span.Lower, span.Upper)
+}
+
+// Metrics renders the shape of the LSM and the pebble counters.
+func (p *Pebble) Metrics() string {
+	m := p.db.Metrics()
+	total := m.Total()
+	return fmt.Sprintf(
+		"Disk Usage: %d bytes | Write Amplification: %.2f | Read Amplification: %d | Memtables: %d (%d bytes) | Compactions: %d (in progress: %d)\n%s",
+		m.DiskSpaceUsage(), total.WriteAmp(), m.ReadAmp(), m.MemTable.Count, m.MemTable.Size, m.Compact.Count, m.Compact.NumInProgress, m.String(),
+	)
+}
+
+func (p *Pebble) Kind() string { return KIND_PEBBLE }
+func (p *Pebble) Close() error { return p.db.Close() }
+
+type pebbleBatch struct {
+	b *pebble.Batch
+}
+
+func (b *pebbleBatch) Get(key []byte) ([]byte, io.Closer, error) { return pebbleGet(b.b, key) }
+func (b *pebbleBatch) Set(key, value []byte) error               { return b.b.Set(key, value, nil) }
+func (b *pebbleBatch) Delete(key []byte) error                   { return b.b.Delete(key, nil) }
+func (b *pebbleBatch) Empty() bool                               { return b.b.Empty() }
+func (b *pebbleBatch) Commit(sync bool) error                    { return b.b.Commit(writeOptions(sync)) }
+func (b *pebbleBatch) Close() error                              { return b.b.Close() }
+
+func (b *pebbleBatch) Apply(other Batch) error {
+	o, ok := other.(*pebbleBatch)
+	if !ok {
+		return fmt.Errorf("can't apply a %T to a pebble batch", other)
+	}
+	return b.b.Apply(o.b, nil)
+}
+
+type pebbleSnapshot struct {
+	s *pebble.Snapshot
+}
+
+func (s *pebbleSnapshot) Get(key []byte) ([]byte, io.Closer, error) { return pebbleGet(s.s, key) }
+func (s *pebbleSnapshot) NewIter(span Span) (Iterator, error)       { return pebbleIter(s.s, span) }
+func (s *pebbleSnapshot) Close() error                              { return s.s.Close() }
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+/*
+Storage backends of the engine.
+
+The engine reads and writes through Store, the backend is picked in the config with
+storage_engine:
+
+	pebble  (default) the LSM on disk, see pebble.go
+	memory  a sorted map in memory, nothing survives a restart, see memory.go
+
+Keys and values are opaque to the backends, the layout of the keyspace is decided by the
+engine (engine/keyspace.go). Range transfers ship pebble SST files whatever the backend,
+Ingest of the memory backend reads them into the map.
+*/
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrClosed   = errors.New("storage is closed")
+)
+
+// Span bounds an iterator, Lower is inclusive and Upper exclusive. A nil bound is open.
+type Span struct {
+	Lower []byte
+	Upper []byte
+}
+
+type Iterator interface {
+	First() bool
+	Next() bool
+	Valid() bool
+	// Key and Value are only valid until the iterator moves
+	Key() []byte
+	Value() []byte
+	Error() error
+	Close() error
+}
+
+type Reader interface {
+	// Get returns ErrNotFound for a missing key, the value is only valid until the closer is closed.
+	Get(key []byte) ([]byte, io.Closer, error)
+	NewIter(span Span) (Iterator, error)
+}
+
+// Batch collects writes applied atomically by Commit. The reads of an indexed batch see
+// its own writes.
+type Batch interface {
+	Get(key []byte) ([]byte, io.Closer, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Apply appends the writes of another batch of the same store.
+	Apply(other Batch) error
+	Empty() bool
+	// Commit writes the batch, sync waits until it is durable.
+	Commit(sync bool) error
+	Close() error
+}
+
+// Snapshot is a consistent read-only view of the store at the time it was taken.
+type Snapshot interface {
+	Reader
+	Close() error
+}
+
+type Store interface {
+	Reader
+	Set(key, value []byte, sync bool) error
+	Delete(key []byte, sync bool) error
+	DeleteRange(span Span, sync bool) error
+	NewBatch() Batch
+	NewIndexedBatch() Batch
+	NewSnapshot() Snapshot
+
+	// Ingest adds the keys of SST files, replacing the stored values.
+	Ingest(paths []string) error
+	// SyncWAL makes every write acknowledged so far durable.
+	SyncWAL() error
+	Flush() error
+	Compact(span Span) error
+	EstimateDiskUsage(span Span) (uint64, error)
+	// Metrics renders the state of the backend for the METRICS admin command.
+	Metrics() string
+	// Kind names the backend in the config and the logs.
+	Kind() string
+	Close() error
+}
+
+type noopCloser struct{}
+
+func (noopCloser) Close() error { return nil }
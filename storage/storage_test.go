@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// backends open an empty store of every kind.
+var backends = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{KIND_PEBBLE, func(t *testing.T) Store {
+		db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("open pebble: %v", err)
+		}
+		return NewPebble(db)
+	}},
+	{KIND_MEMORY, func(t *testing.T) Store { return NewMemory() }},
+}
+
+var storeTests = []struct {
+	name string
+	run  func(t *testing.T, s Store)
+}{
+	{"GetSetDelete", testGetSetDelete},
+	{"IteratorBounds", testIteratorBounds},
+	{"IndexedBatch", testIndexedBatch},
+	{"DeleteRange", testDeleteRange},
+	{"SnapshotIsolation", testSnapshotIsolation},
+	{"IndexedBatchDeleteRange", testIndexedBatchDeleteRange},
+	{"SnapshotAfterWrites", testSnapshotAfterWrites},
+	{"Ingest", testIngest},
+}
+
+func TestStore(t *testing.T) {
+	for _, backend := range backends {
+		for _, tt := range storeTests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				s := backend.open(t)
+				defer s.Close()
+				tt.run(t, s)
+			})
+		}
+	}
+}
+
+// getter is a store, a batch or a snapshot.
+type getter interface {
+	Get(key []byte) ([]byte, io.Closer, error)
+}
+
+// get returns a copy of the value of key, false if it is missing.
+func get(t *testing.T, r getter, key string) (string, bool) {
+	t.Helper()
+	value, closer, err := r.Get([]byte(key))
+	if errors.Is(err, ErrNotFound) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	defer closer.Close()
+	return string(value), true
+}
+
+// scan returns the pairs of span as key=value.
+func scan(t *testing.T, r Reader, span Span) []string {
+	t.Helper()
+	iter, err := r.NewIter(span)
+	if err != nil {
+		t.Fatalf("new iterator: %v", err)
+	}
+	var pairs []string
+	for ok := iter.First(); ok; ok = iter.Next() {
+		pairs = append(pairs, string(iter.Key())+"="+string(iter.Value()))
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatalf("close iterator: %v", err)
+	}
+	return pairs
+}
+
+func set(t *testing.T, s Store, pairs ...string) {
+	t.Helper()
+	for i := 0; i < len(pairs); i += 2 {
+		if err := s.Set([]byte(pairs[i]), []byte(pairs[i+1]), false); err != nil {
+			t.Fatalf("set %q: %v", pairs[i], err)
+		}
+	}
+}
+
+func testGetSetDelete(t *testing.T, s Store) {
+	steps := []struct {
+		op, key, value string
+		want           string
+		found          bool
+	}{
+		{op: "get", key: "a"},
+		{op: "set", key: "a", value: "1", want: "1", found: true},
+		{op: "set", key: "a", value: "2", want: "2", found: true},
+		{op: "set", key: "b", value: "", want: "", found: true},
+		{op: "delete", key: "a"},
+		{op: "delete", key: "missing"},
+		{op: "set", key: "a", value: "3", want: "3", found: true},
+	}
+	for i, step := range steps {
+		var err error
+		switch step.op {
+		case "set":
+			err = s.Set([]byte(step.key), []byte(step.value), i%2 == 0)
+		case "delete":
+			err = s.Delete([]byte(step.key), i%2 == 0)
+		}
+		if err != nil {
+			t.Fatalf("step %d: %s %q: %v", i, step.op, step.key, err)
+		}
+		value, found := get(t, s, step.key)
+		if found != step.found || value != step.want {
+			t.Errorf("step %d: %s %q: got %q (found %t), want %q (found %t)", i, step.op, step.key, value, found, step.want, step.found)
+		}
+	}
+}
+
+func testIteratorBounds(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2", "ba", "3", "c", "4", "d", "5")
+
+	tests := []struct {
+		name string
+		span Span
+		want []string
+	}{
+		{"open", Span{}, []string{"a=1", "b=2", "ba=3", "c=4", "d=5"}},
+		{"lower inclusive", Span{Lower: []byte("b")}, []string{"b=2", "ba=3", "c=4", "d=5"}},
+		{"upper exclusive", Span{Upper: []byte("c")}, []string{"a=1", "b=2", "ba=3"}},
+		{"both", Span{Lower: []byte("b"), Upper: []byte("d")}, []string{"b=2", "ba=3", "c=4"}},
+		{"between keys", Span{Lower: []byte("bb"), Upper: []byte("cc")}, []string{"c=4"}},
+		{"empty", Span{Lower: []byte("x"), Upper: []byte("z")}, nil},
+	}
+	for _, tt := range tests {
+		if got := scan(t, s, tt.span); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testIndexedBatch(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2")
+
+	batch := s.NewIndexedBatch()
+	defer batch.Close()
+	if !batch.Empty() {
+		t.Fatal("new batch isn't empty")
+	}
+	for _, err := range []error{
+		batch.Set([]byte("a"), []byte("10")),
+		batch.Delete([]byte("b")),
+		batch.Set([]byte("c"), []byte("30")),
+		batch.Set([]byte("c"), []byte("31")),
+	} {
+		if err != nil {
+			t.Fatalf("batch write: %v", err)
+		}
+	}
+
+	tests := []struct {
+		key           string
+		batch, before string
+		inBatch       bool
+		stored        bool
+	}{
+		{key: "a", batch: "10", inBatch: true, before: "1", stored: true},
+		{key: "b", before: "2", stored: true},
+		{key: "c", batch: "31", inBatch: true},
+	}
+	for _, tt := range tests {
+		if value, found := get(t, batch, tt.key); found != tt.inBatch || value != tt.batch {
+			t.Errorf("batch get %q: got %q (found %t), want %q (found %t)", tt.key, value, found, tt.batch, tt.inBatch)
+		}
+		// the store doesn't see the batch before it is committed
+		if value, found := get(t, s, tt.key); found != tt.stored || value != tt.before {
+			t.Errorf("store get %q before commit: got %q (found %t), want %q (found %t)", tt.key, value, found, tt.before, tt.stored)
+		}
+	}
+
+	if err := batch.Commit(true); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if got, want := scan(t, s, Span{}), []string{"a=10", "c=31"}; !slices.Equal(got, want) {
+		t.Errorf("after commit: got %v, want %v", got, want)
+	}
+}
+
+func testDeleteRange(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2", "ba", "3", "c", "4", "d", "5")
+
+	if err := s.DeleteRange(Span{Lower: []byte("b"), Upper: []byte("d")}, false); err != nil {
+		t.Fatalf("delete range: %v", err)
+	}
+	if got, want := scan(t, s, Span{}), []string{"a=1", "d=5"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, key := range []string{"b", "ba", "c"} {
+		if _, found := get(t, s, key); found {
+			t.Errorf("%q survived the range delete", key)
+		}
+	}
+}
+
+func testSnapshotIsolation(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2")
+
+	snap := s.NewSnapshot()
+	defer snap.Close()
+
+	set(t, s, "a", "10", "c", "3")
+	if err := s.Delete([]byte("b"), false); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	batch := s.NewBatch()
+	batch.Set([]byte("d"), []byte("4"))
+	if err := batch.Commit(false); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	batch.Close()
+
+	tests := []struct {
+		key   string
+		want  string
+		found bool
+	}{
+		{key: "a", want: "1", found: true},
+		{key: "b", want: "2", found: true},
+		{key: "c"},
+		{key: "d"},
+	}
+	for _, tt := range tests {
+		if value, found := get(t, snap, tt.key); found != tt.found || value != tt.want {
+			t.Errorf("snapshot get %q: got %q (found %t), want %q (found %t)", tt.key, value, found, tt.want, tt.found)
+		}
+	}
+	if got, want := scan(t, snap, Span{}), []string{"a=1", "b=2"}; !slices.Equal(got, want) {
+		t.Errorf("snapshot scan: got %v, want %v", got, want)
+	}
+	if got, want := scan(t, s, Span{}), []string{"a=10", "c=3", "d=4"}; !slices.Equal(got, want) {
+		t.Errorf("live scan: got %v, want %v", got, want)
+	}
+}
+
+func testIndexedBatchDeleteRange(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2", "ba", "3", "c", "4", "d", "5")
+	if err := s.DeleteRange(Span{Lower: []byte("b"), Upper: []byte("d")}, false); err != nil {
+		t.Fatalf("delete range: %v", err)
+	}
+
+	batch := s.NewIndexedBatch()
+	defer batch.Close()
+	for _, err := range []error{
+		batch.Set([]byte("ba"), []byte("30")),
+		batch.Set([]byte("bb"), []byte("40")),
+		batch.Delete([]byte("d")),
+	} {
+		if err != nil {
+			t.Fatalf("batch write: %v", err)
+		}
+	}
+
+	tests := []struct {
+		key   string
+		want  string
+		found bool
+	}{
+		{key: "a", want: "1", found: true},
+		{key: "b"},
+		{key: "ba", want: "30", found: true},
+		{key: "bb", want: "40", found: true},
+		{key: "c"},
+		{key: "d"},
+	}
+	for _, tt := range tests {
+		if value, found := get(t, batch, tt.key); found != tt.found || value != tt.want {
+			t.Errorf("batch get %q: got %q (found %t), want %q (found %t)", tt.key, value, found, tt.want, tt.found)
+		}
+	}
+
+	if err := batch.Commit(false); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if got, want := scan(t, s, Span{}), []string{"a=1", "ba=30", "bb=40"}; !slices.Equal(got, want) {
+		t.Errorf("after commit: got %v, want %v", got, want)
+	}
+}
+
+func testSnapshotAfterWrites(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2", "c", "3")
+
+	// a snapshot taken after the writes sees them
+	snap := s.NewSnapshot()
+	defer snap.Close()
+	if got, want := scan(t, snap, Span{}), []string{"a=1", "b=2", "c=3"}; !slices.Equal(got, want) {
+		t.Fatalf("snapshot scan: got %v, want %v", got, want)
+	}
+
+	set(t, s, "b", "20", "bb", "25")
+	if err := s.DeleteRange(Span{Lower: []byte("c"), Upper: []byte("d")}, false); err != nil {
+		t.Fatalf("delete range: %v", err)
+	}
+	batch := s.NewBatch()
+	batch.Delete([]byte("a"))
+	if err := batch.Commit(false); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	batch.Close()
+
+	// and keeps reading them after later writes, range deletes and batches
+	tests := []struct {
+		name string
+		span Span
+		want []string
+	}{
+		{"open", Span{}, []string{"a=1", "b=2", "c=3"}},
+		{"bounded", Span{Lower: []byte("b"), Upper: []byte("c")}, []string{"b=2"}},
+		{"deleted range", Span{Lower: []byte("c")}, []string{"c=3"}},
+	}
+	for _, tt := range tests {
+		if got := scan(t, snap, tt.span); !slices.Equal(got, tt.want) {
+			t.Errorf("snapshot %s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if value, found := get(t, snap, "b"); !found || value != "2" {
+		t.Errorf("snapshot get %q: got %q (found %t), want %q", "b", value, found, "2")
+	}
+
+	later := s.NewSnapshot()
+	defer later.Close()
+	if got, want := scan(t, later, Span{}), []string{"b=20", "bb=25"}; !slices.Equal(got, want) {
+		t.Errorf("later snapshot scan: got %v, want %v", got, want)
+	}
+}
+
+// writeSST writes the pairs, in key order, into a new SST file of dir.
+func writeSST(t *testing.T, dir, name string, pairs ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := vfs.Default.Create(path)
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{TableFormat: pebble.FormatMostCompatible.MaxTableFormat()})
+	for i := 0; i < len(pairs); i += 2 {
+		if err := w.Set([]byte(pairs[i]), []byte(pairs[i+1])); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close %s: %v", name, err)
+	}
+	return path
+}
+
+func testIngest(t *testing.T, s Store) {
+	set(t, s, "a", "1", "b", "2", "e", "5")
+
+	dir := t.TempDir()
+	paths := []string{
+		writeSST(t, dir, "000000.sst", "b", "20", "c", "30"),
+		writeSST(t, dir, "000001.sst", "d", "40"),
+	}
+	if err := s.Ingest(paths); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	// the ingested keys replace the stored ones, the others are kept
+	if got, want := scan(t, s, Span{}), []string{"a=1", "b=20", "c=30", "d=40", "e=5"}; !slices.Equal(got, want) {
+		t.Errorf("after ingest: got %v, want %v", got, want)
+	}
+	if value, found := get(t, s, "c"); !found || value != "30" {
+		t.Errorf("get %q: got %q (found %t), want %q", "c", value, found, "30")
+	}
+}
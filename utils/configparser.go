@@ -13,6 +13,47 @@ type Config struct {
 	ClusterAddr         string `json:"cluster_addr"`
 	RocksDBPath         string `json:"rocksdb_path"`
 	ReplicationFactor   int    `json:"replication_factor"`
+
+	// failure detection on the master, all values in seconds
+	SuspectTimeout      int `json:"suspect_timeout"`
+	DeadTimeout         int `json:"dead_timeout"`
+	EvictionGracePeriod int `json:"eviction_grace_period"`
+
+	// phi-accrual failure detector in the gossip layer
+	PhiSuspectThreshold float64 `json:"phi_suspect_threshold"`
+	PhiDeadThreshold    float64 `json:"phi_dead_threshold"`
+
+	// what a node on the minority side of a network split does: reject | stale_reads | continue
+	PartitionPolicy string `json:"partition_policy"`
+
+	// staleness bound of READONLY (follower) reads in milliseconds
+	MaxReadStalenessMs int `json:"max_read_staleness_ms"`
+
+	// garbage collection of the ranges the node no longer holds, grace period in seconds
+	GCGracePeriod int  `json:"gc_grace_period"`
+	GCDryRun      bool `json:"gc_dry_run"`
+
+	// durability of the client writes: sync | group | periodic, see engine/durability.go
+	Durability               string `json:"durability"`
+	DurabilitySyncIntervalMs int    `json:"durability_sync_interval_ms"`
+
+	// storage backend: pebble | memory, see storage/storage.go
+	StorageEngine string `json:"storage_engine"`
+
+	// AES-GCM encryption of the stored values, key file format in engine/encryption.go.
+	// The keys themselves stay in clear.
+	EncryptionKeyFile string `json:"encryption_key_file"`
+
+	// value compression: none | snappy | zstd, payloads from compression_min_size bytes, see engine/compression.go
+	Compression        string `json:"compression"`
+	CompressionMinSize int    `json:"compression_min_size"`
+
+	// pebble tuning, 0 keeps the default of pebble, see engine/tuning.go
+	PebbleCacheSizeMB              int `json:"pebble_cache_size_mb"`
+	PebbleMemTableSizeMB           int `json:"pebble_memtable_size_mb"`
+	PebbleMaxConcurrentCompactions int `json:"pebble_max_concurrent_compactions"`
+	PebbleL0CompactionThreshold    int `json:"pebble_l0_compaction_threshold"`
+	PebbleL0StopWritesThreshold    int `json:"pebble_l0_stop_writes_threshold"`
 }
 
 func ReadConfigFile(path *string) *Config {